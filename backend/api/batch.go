@@ -0,0 +1,288 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Promptzy/terminal-devtool/backend/jobs"
+	"github.com/Promptzy/terminal-devtool/backend/media"
+)
+
+// MaxBatchFiles limits the inputs of one batch
+const MaxBatchFiles = 1000
+
+// BatchRequest represents a request to process every file in a directory or
+// matching a glob pattern with the same options
+type BatchRequest struct {
+	Source        string            `json:"source"`                   // Directory or glob pattern under the media base directory
+	Recursive     bool              `json:"recursive,omitempty"`      // Include subdirectories of a directory source
+	Template      json.RawMessage   `json:"template"`                 // Process request without input; preset_name and callback_url are applied
+	OutputPattern string            `json:"output_pattern,omitempty"` // Output path with {name}, {ext}, {dir} and {index} placeholders
+	Priority      string            `json:"priority,omitempty"`
+	Retry         *jobs.RetryPolicy `json:"retry,omitempty"`
+}
+
+// Batches handles listing batches (GET) and submitting them (POST)
+func (h *Handler) Batches(w http.ResponseWriter, r *http.Request) {
+	if h.Queue == nil {
+		http.Error(w, "Jobs are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.Queue.Batches())
+
+	case http.MethodPost:
+		var req BatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		children, err := h.batchJobs(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		batch := h.Queue.SubmitBatch(jobs.Batch{Source: req.Source, Client: jobClient(r)}, children)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(batch)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GetBatch handles requests for the status of one batch
+func (h *Handler) GetBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Queue == nil {
+		http.Error(w, "Jobs are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	batch, err := h.Queue.GetBatch(r.PathValue("id"))
+	if errors.Is(err, jobs.ErrUnknownBatch) {
+		http.Error(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Batch lookup failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batch)
+}
+
+// batchJobs expands a batch request into one process job per input file
+func (h *Handler) batchJobs(req BatchRequest) ([]jobs.Job, error) {
+	if req.Source == "" {
+		return nil, fmt.Errorf("source is required")
+	}
+
+	var template map[string]json.RawMessage
+	if len(req.Template) == 0 {
+		req.Template = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(req.Template, &template); err != nil {
+		return nil, fmt.Errorf("invalid template: must be a process request")
+	}
+	if _, ok := template["input"]; ok {
+		return nil, fmt.Errorf("the template must not set input")
+	}
+	if _, ok := template["output"]; ok {
+		return nil, fmt.Errorf("use output_pattern instead of output in the template")
+	}
+
+	// The preset may choose the format, which decides the default extension
+	var options media.ProcessRequest
+	if err := h.decodeWithPreset(bytes.NewReader(req.Template), &options); err != nil {
+		return nil, err
+	}
+
+	inputs, err := h.expandSource(req.Source, req.Recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	// Outputs of an earlier run of the same batch are not inputs again
+	inputs = slices.DeleteFunc(inputs, func(input string) bool { return h.isBatchOutput(req.OutputPattern, input) })
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no files match %s apart from batch outputs", req.Source)
+	}
+
+	outputs := make(map[string]string, len(inputs))
+	children := make([]jobs.Job, 0, len(inputs))
+	for i, input := range inputs {
+		output, err := h.batchOutput(req.OutputPattern, input, i+1, options)
+		if err != nil {
+			return nil, err
+		}
+		if output == input {
+			return nil, fmt.Errorf("output for %s would overwrite the input", h.relativePath(input))
+		}
+		if other, ok := outputs[output]; ok {
+			return nil, fmt.Errorf("%s and %s would both write %s: add {name} or {index} to output_pattern", h.relativePath(other), h.relativePath(input), h.relativePath(output))
+		}
+		outputs[output] = input
+
+		template["input"], _ = json.Marshal(input)
+		template["output"], _ = json.Marshal(output)
+		request, err := json.Marshal(template)
+		if err != nil {
+			return nil, err
+		}
+
+		job, err := h.newJob(SubmitJobRequest{Type: jobs.TypeProcess, Request: request, Priority: req.Priority, Retry: req.Retry})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", h.relativePath(input), err)
+		}
+		children = append(children, job)
+	}
+	return children, nil
+}
+
+// expandSource lists the files of a directory or glob pattern in the base
+// directory. Hidden files are skipped, as are matches that resolve outside
+// the base directory through symlinks.
+func (h *Handler) expandSource(source string, recursive bool) ([]string, error) {
+	pattern := filepath.Clean(h.resolvePath(source))
+	if !withinDir(h.BaseDir, pattern) {
+		return nil, fmt.Errorf("source must be inside the media directory")
+	}
+
+	var candidates []string
+	if strings.ContainsAny(pattern, "*?[") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern: %w", err)
+		}
+		candidates = matches
+	} else {
+		stat, err := os.Stat(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("source not found: %s", source)
+		}
+		if !stat.IsDir() {
+			candidates = []string{pattern}
+		} else {
+			err := filepath.WalkDir(pattern, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if path == pattern {
+					return nil
+				}
+				if entry.IsDir() {
+					if !recursive || strings.HasPrefix(entry.Name(), ".") {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				candidates = append(candidates, path)
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to list %s: %w", source, err)
+			}
+		}
+	}
+
+	// Symlinks are compared with the real location of the base directory
+	base, err := filepath.EvalSymlinks(h.BaseDir)
+	if err != nil {
+		base = h.BaseDir
+	}
+
+	var inputs []string
+	for _, path := range candidates {
+		if strings.HasPrefix(filepath.Base(path), ".") {
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil || !stat.Mode().IsRegular() {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(path); err != nil || !withinDir(base, resolved) {
+			continue
+		}
+		inputs = append(inputs, path)
+	}
+
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no files match %s", source)
+	}
+	if len(inputs) > MaxBatchFiles {
+		return nil, fmt.Errorf("%d files match %s: a batch takes at most %d", len(inputs), source, MaxBatchFiles)
+	}
+	return inputs, nil
+}
+
+// batchOutput returns the output path of a batch input. The pattern is
+// relative to the base directory; without one, outputs are named like
+// single process requests and written next to their inputs.
+func (h *Handler) batchOutput(pattern, input string, index int, options media.ProcessRequest) (string, error) {
+	if pattern == "" {
+		options.Input = input
+		return filepath.Join(filepath.Dir(input), filepath.Base(options.OutputPath())), nil
+	}
+
+	name := filepath.Base(input)
+	ext := filepath.Ext(name)
+	replacer := strings.NewReplacer(
+		"{name}", strings.TrimSuffix(name, ext),
+		"{ext}", strings.TrimPrefix(ext, "."),
+		"{dir}", filepath.Dir(h.relativePath(input)),
+		"{index}", strconv.Itoa(index),
+	)
+
+	output := filepath.Clean(h.resolvePath(replacer.Replace(pattern)))
+	if !withinDir(h.BaseDir, output) {
+		return "", fmt.Errorf("output_pattern must stay inside the media directory")
+	}
+	return output, nil
+}
+
+// isBatchOutput reports whether a file is named like an output of a batch
+// with the given output pattern: processed_<name> without a pattern, or a
+// match of the pattern with every placeholder standing for any name
+func (h *Handler) isBatchOutput(pattern, path string) bool {
+	if pattern == "" {
+		return strings.HasPrefix(filepath.Base(path), media.DefaultOutputPrefix)
+	}
+
+	replacer := strings.NewReplacer("{name}", "*", "{ext}", "*", "{dir}", "*", "{index}", "*")
+	matched, err := filepath.Match(filepath.Clean(h.resolvePath(replacer.Replace(pattern))), path)
+	return err == nil && matched
+}
+
+// withinDir reports whether path is dir or inside it
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// relativePath returns path relative to the base directory for messages
+func (h *Handler) relativePath(path string) string {
+	if rel, err := filepath.Rel(h.BaseDir, path); err == nil {
+		return rel
+	}
+	return path
+}
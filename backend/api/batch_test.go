@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBatchSkipsOutputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		req     BatchRequest
+		want    []string // Inputs of the jobs, relative to the base directory
+		wantErr string
+	}{
+		{
+			name:  "default output names",
+			files: []string{"raw/a.mov", "raw/processed_a.mp4", "raw/b.mov"},
+			req:   BatchRequest{Source: "raw"},
+			want:  []string{"raw/a.mov", "raw/b.mov"},
+		},
+		{
+			name:  "output pattern in the source directory",
+			files: []string{"raw/a.mov", "raw/a_small.mp4", "raw/b.mov"},
+			req:   BatchRequest{Source: "raw", OutputPattern: "raw/{name}_small.mp4"},
+			want:  []string{"raw/a.mov", "raw/b.mov"},
+		},
+		{
+			name:  "output pattern in a subdirectory",
+			files: []string{"raw/a.mov", "raw/webm/a.webm", "raw/webm/notes.txt"},
+			req:   BatchRequest{Source: "raw", Recursive: true, OutputPattern: "raw/webm/{name}.webm"},
+			want:  []string{"raw/a.mov", "raw/webm/notes.txt"},
+		},
+		{
+			name:    "only outputs",
+			files:   []string{"raw/processed_a.mp4"},
+			req:     BatchRequest{Source: "raw/*.mp4"},
+			wantErr: "no files match raw/*.mp4 apart from batch outputs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := t.TempDir()
+			for _, file := range tt.files {
+				path := filepath.Join(base, file)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte("media"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			h := NewHandler(base)
+			children, err := h.batchJobs(tt.req)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("batchJobs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("batchJobs() error = %v", err)
+			}
+
+			var inputs []string
+			for _, job := range children {
+				var request struct {
+					Input string `json:"input"`
+				}
+				json.Unmarshal(job.Request, &request)
+				inputs = append(inputs, h.relativePath(request.Input))
+			}
+			if !reflect.DeepEqual(inputs, tt.want) {
+				t.Errorf("inputs = %v, want %v", inputs, tt.want)
+			}
+		})
+	}
+}
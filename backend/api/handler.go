@@ -2,15 +2,36 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"time"
 
+	"github.com/Promptzy/terminal-devtool/backend/jobs"
 	"github.com/Promptzy/terminal-devtool/backend/media"
+	"github.com/Promptzy/terminal-devtool/backend/pipeline"
+	"github.com/Promptzy/terminal-devtool/backend/presets"
+	"github.com/Promptzy/terminal-devtool/backend/watch"
+	"github.com/Promptzy/terminal-devtool/backend/webhooks"
 )
 
+// errInvalidBody is returned by decodeRequest for malformed request bodies
+var errInvalidBody = errors.New("invalid request body")
+
 // Handler processes HTTP requests for the media API
 type Handler struct {
-	BaseDir string
+	BaseDir  string
+	Presets  *presets.Store     // Named presets for preset_name; nil disables presets
+	Queue    *jobs.Queue        // Job queue for /api/jobs; nil disables jobs
+	Notifier *webhooks.Notifier // Delivers job events; nil disables webhooks
+	Watcher  *watch.Watcher     // Watch folders shown by /api/watch; nil if none are configured
+
+	Runs      *pipeline.Manager       // Runs pipelines for /api/pipelines; nil disables pipelines
+	Templates *pipeline.TemplateStore // Stored pipeline templates
 }
 
 // NewHandler creates a new API handler
@@ -27,9 +48,14 @@ func (h *Handler) ProcessMedia(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// With a callback_url the request runs as a job and the result is delivered
+	if h.queueCallback(w, r, jobs.TypeProcess) {
+		return
+	}
+
 	var req media.ProcessRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := h.decodeRequest(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -42,6 +68,12 @@ func (h *Handler) ProcessMedia(w http.ResponseWriter, r *http.Request) {
 		req.Output = filepath.Join(h.BaseDir, req.Output)
 	}
 
+	// Several renditions are encoded together from one decode
+	if len(req.Outputs) > 0 {
+		h.processMulti(w, r, req)
+		return
+	}
+
 	// Process the media file
 	outputPath, err := media.ProcessMedia(req)
 	if err != nil {
@@ -58,6 +90,131 @@ func (h *Handler) ProcessMedia(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// processMulti encodes a multi-output process request. With ?stream=true the
+// response is newline-delimited JSON: progress events followed by the result.
+func (h *Handler) processMulti(w http.ResponseWriter, r *http.Request, req media.ProcessRequest) {
+	for i := range req.Outputs {
+		if req.Outputs[i].Output != "" && !filepath.IsAbs(req.Outputs[i].Output) {
+			req.Outputs[i].Output = filepath.Join(h.BaseDir, req.Outputs[i].Output)
+		}
+	}
+
+	if r.URL.Query().Get("stream") != "true" {
+		result, err := media.ProcessMulti(req, nil)
+		if err != nil {
+			http.Error(w, "Processing failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	// Encodes outlast the server's write timeout, so lift it for this response
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	result, err := media.ProcessMulti(req, func(progress media.ProcessProgress) {
+		encoder.Encode(map[string]any{"progress": progress})
+		rc.Flush()
+	})
+	if err != nil {
+		// The status line may already be sent, so errors are reported in the stream
+		encoder.Encode(map[string]string{"error": "Processing failed: " + err.Error()})
+		return
+	}
+	encoder.Encode(map[string]any{"result": result})
+}
+
+// RemuxMedia handles requests to change a file's container without re-encoding
+func (h *Handler) RemuxMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req media.RemuxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Input == "" {
+		http.Error(w, "Input path is required", http.StatusBadRequest)
+		return
+	}
+
+	// Resolve paths relative to base directory if not absolute
+	if !filepath.IsAbs(req.Input) {
+		req.Input = filepath.Join(h.BaseDir, req.Input)
+	}
+
+	if req.Output != "" && !filepath.IsAbs(req.Output) {
+		req.Output = filepath.Join(h.BaseDir, req.Output)
+	}
+
+	// Remux the media file
+	result, err := media.Remux(req)
+	if err != nil {
+		http.Error(w, "Remux failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the result
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// EditMetadata handles requests to edit metadata and chapters without re-encoding
+func (h *Handler) EditMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req media.EditRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Input == "" {
+		http.Error(w, "Input path is required", http.StatusBadRequest)
+		return
+	}
+
+	// Resolve paths relative to base directory if not absolute
+	if !filepath.IsAbs(req.Input) {
+		req.Input = filepath.Join(h.BaseDir, req.Input)
+	}
+
+	if req.Output != "" && !filepath.IsAbs(req.Output) {
+		req.Output = filepath.Join(h.BaseDir, req.Output)
+	}
+
+	if req.CopyFrom != "" && !filepath.IsAbs(req.CopyFrom) {
+		req.CopyFrom = filepath.Join(h.BaseDir, req.CopyFrom)
+	}
+
+	if req.ChaptersFile != "" && !filepath.IsAbs(req.ChaptersFile) {
+		req.ChaptersFile = filepath.Join(h.BaseDir, req.ChaptersFile)
+	}
+
+	// Edit the media file
+	result, err := media.EditMetadata(req)
+	if err != nil {
+		http.Error(w, "Edit failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the result
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
 // CompareMedia handles requests to compare original and processed media files
 func (h *Handler) CompareMedia(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -65,11 +222,12 @@ func (h *Handler) CompareMedia(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Original  string `json:"original"`
-		Processed string `json:"processed"`
+	// With a callback_url the request runs as a job and the result is delivered
+	if h.queueCallback(w, r, jobs.TypeCompare) {
+		return
 	}
 
+	var req media.CompareRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
@@ -103,14 +261,14 @@ func (h *Handler) CompressMedia(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Input   string `json:"input"`
-		Output  string `json:"output,omitempty"`
-		Bitrate string `json:"bitrate"`
+	// With a callback_url the request runs as a job and the result is delivered
+	if h.queueCallback(w, r, jobs.TypeCompress) {
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req media.CompressRequest
+	if err := h.decodeRequest(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -135,7 +293,7 @@ func (h *Handler) CompressMedia(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Compress the media file
-	err := media.CompressMedia(req.Input, req.Output, req.Bitrate)
+	outputPath, err := media.Compress(req)
 	if err != nil {
 		http.Error(w, "Compression failed: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -143,7 +301,7 @@ func (h *Handler) CompressMedia(w http.ResponseWriter, r *http.Request) {
 
 	// Return the result
 	response := map[string]string{
-		"output":  req.Output,
+		"output":  outputPath,
 		"status":  "success",
 		"message": "Video compressed successfully",
 	}
@@ -182,3 +340,247 @@ func (h *Handler) GetMediaInfo(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(info)
 }
+
+// DetectCrop handles requests to detect black bars in a video file
+func (h *Handler) DetectCrop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		http.Error(w, "Missing path parameter", http.StatusBadRequest)
+		return
+	}
+
+	samples := 0
+	if s := r.URL.Query().Get("samples"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid samples parameter", http.StatusBadRequest)
+			return
+		}
+		samples = n
+	}
+
+	// Resolve path relative to base directory if not absolute
+	filePath := path
+	if !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(h.BaseDir, filePath)
+	}
+
+	// Detect crop rectangle
+	result, err := media.DetectCrop(filePath, samples)
+	if err != nil {
+		http.Error(w, "Crop detection failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the result
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// AnalyzeGOP handles requests for keyframe, GOP and bitrate analysis
+func (h *Handler) AnalyzeGOP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		http.Error(w, "Missing path parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Counting frame types decodes the whole stream, so it can be skipped
+	frameTypes := true
+	if s := r.URL.Query().Get("frame_types"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			http.Error(w, "Invalid frame_types parameter", http.StatusBadRequest)
+			return
+		}
+		frameTypes = b
+	}
+
+	// Resolve path relative to base directory if not absolute
+	filePath := path
+	if !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(h.BaseDir, filePath)
+	}
+
+	// Analyze keyframes and bitrate
+	report, err := media.AnalyzeGOP(filePath, frameTypes)
+	if err != nil {
+		http.Error(w, "GOP analysis failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the result
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// VerifyMedia handles requests to check that a file decodes without errors
+func (h *Handler) VerifyMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req media.VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Input == "" {
+		http.Error(w, "Input path is required", http.StatusBadRequest)
+		return
+	}
+
+	// Resolve path relative to base directory if not absolute
+	if !filepath.IsAbs(req.Input) {
+		req.Input = filepath.Join(h.BaseDir, req.Input)
+	}
+
+	// Decode the whole file
+	report, err := media.VerifyMedia(req)
+	if err != nil {
+		http.Error(w, "Verification failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the report
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// DetectScenes handles requests to detect scene changes in a video file
+func (h *Handler) DetectScenes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req media.SceneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Input == "" {
+		http.Error(w, "Input path is required", http.StatusBadRequest)
+		return
+	}
+
+	// Resolve paths relative to base directory if not absolute
+	if !filepath.IsAbs(req.Input) {
+		req.Input = filepath.Join(h.BaseDir, req.Input)
+	}
+
+	if req.ExportPath != "" && !filepath.IsAbs(req.ExportPath) {
+		req.ExportPath = filepath.Join(h.BaseDir, req.ExportPath)
+	}
+
+	if req.KeyframeDir != "" && !filepath.IsAbs(req.KeyframeDir) {
+		req.KeyframeDir = filepath.Join(h.BaseDir, req.KeyframeDir)
+	}
+
+	// Detect scenes
+	result, err := media.DetectScenes(req)
+	if err != nil {
+		http.Error(w, "Scene detection failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the result
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// DetectSegments handles requests to detect silent and black segments
+func (h *Handler) DetectSegments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req media.DetectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Input == "" {
+		http.Error(w, "Input path is required", http.StatusBadRequest)
+		return
+	}
+
+	// Resolve path relative to base directory if not absolute
+	if !filepath.IsAbs(req.Input) {
+		req.Input = filepath.Join(h.BaseDir, req.Input)
+	}
+
+	// Detect silent and black segments
+	report, err := media.DetectSegments(req)
+	if err != nil {
+		http.Error(w, "Detection failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the result
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// decodeRequest decodes a JSON request body into v. When the body names a
+// preset in preset_name, the preset's options are applied first and every
+// field present in the body overrides them.
+func (h *Handler) decodeRequest(r *http.Request, v any) error {
+	return h.decodeWithPreset(r.Body, v)
+}
+
+// decodeWithPreset decodes a JSON request from body, applying its preset_name
+func (h *Handler) decodeWithPreset(body io.Reader, v any) error {
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&fields); err != nil {
+		return errInvalidBody
+	}
+
+	var name string
+	if raw, ok := fields["preset_name"]; ok {
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return errInvalidBody
+		}
+		delete(fields, "preset_name")
+	}
+
+	data, err := json.Marshal(fields)
+	if name != "" {
+		if h.Presets == nil {
+			return fmt.Errorf("unknown preset '%s': no presets are configured", name)
+		}
+		preset, ok := h.Presets.Get(name)
+		if !ok {
+			return fmt.Errorf("unknown preset '%s'", name)
+		}
+		// Presets are validated as process requests; compress requests take
+		// fewer fields, so reject presets setting options they would ignore
+		if err := preset.Decode(reflect.New(reflect.TypeOf(v).Elem()).Interface()); err != nil {
+			return fmt.Errorf("cannot apply %w", err)
+		}
+		data, err = preset.Merge(fields)
+	}
+	if err != nil {
+		return errInvalidBody
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return errInvalidBody
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Promptzy/terminal-devtool/backend/media"
+	"github.com/Promptzy/terminal-devtool/backend/presets"
+)
+
+func TestDecodeWithPreset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "presets.json")
+	data := `{"presets": [
+		{"name": "web-720p", "options": {"codec": "libx264", "crf": "23", "height": 720}},
+		{"name": "small", "options": {"bitrate": "800k", "preset": "fast"}}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := presets.NewStore(path)
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{Presets: store}
+
+	var process media.ProcessRequest
+	if err := h.decodeWithPreset(strings.NewReader(`{"preset_name": "web-720p", "input": "a.mov", "crf": "18"}`), &process); err != nil {
+		t.Fatalf("process with preset error = %v", err)
+	}
+	if process.Input != "a.mov" || process.Codec != "libx264" || process.CRF != "18" || process.Height != 720 {
+		t.Errorf("process request = %+v", process)
+	}
+
+	var compress media.CompressRequest
+	if err := h.decodeWithPreset(strings.NewReader(`{"preset_name": "small", "input": "a.mov", "preset": "slow"}`), &compress); err != nil {
+		t.Fatalf("compress with preset error = %v", err)
+	}
+	if compress.Bitrate != "800k" || compress.Preset != "slow" {
+		t.Errorf("compress request = %+v", compress)
+	}
+
+	// Compress cannot honour the size and quality of a process preset
+	err := h.decodeWithPreset(strings.NewReader(`{"preset_name": "web-720p", "input": "a.mov", "bitrate": "1M"}`), &media.CompressRequest{})
+	if err == nil || !strings.Contains(err.Error(), "cannot apply preset 'web-720p'") {
+		t.Errorf("compress with process preset error = %v", err)
+	}
+
+	err = h.decodeWithPreset(strings.NewReader(`{"preset_name": "missing"}`), &media.ProcessRequest{})
+	if err == nil || !strings.Contains(err.Error(), "unknown preset 'missing'") {
+		t.Errorf("unknown preset error = %v", err)
+	}
+	if err := h.decodeWithPreset(strings.NewReader(`[]`), &media.ProcessRequest{}); !errors.Is(err, errInvalidBody) {
+		t.Errorf("malformed body error = %v, want errInvalidBody", err)
+	}
+}
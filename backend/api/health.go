@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"os/exec"
 	"strings"
+
+	"github.com/Promptzy/terminal-devtool/backend/media"
 )
 
 // HealthCheckResponse represents the response structure for the health check endpoint
@@ -14,6 +16,7 @@ type HealthCheckResponse struct {
 	FFmpegAvailable bool              `json:"ffmpeg_available"`
 	FFmpegVersion   string            `json:"ffmpeg_version,omitempty"`
 	Components      map[string]string `json:"components,omitempty"`
+	Encoders        []string          `json:"encoders,omitempty"` // All encoders of the installed ffmpeg
 }
 
 // HealthCheck verifies the availability of required tools and components
@@ -39,6 +42,10 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		response.Components["libx264"] = checkFFmpegComponent("libx264")
 		response.Components["libvpx"] = checkFFmpegComponent("libvpx")
 		response.Components["libopus"] = checkFFmpegComponent("libopus")
+
+		if encoders, err := media.ListEncoders(); err == nil {
+			response.Encoders = encoders
+		}
 	} else {
 		response.Status = "Warning"
 	}
@@ -0,0 +1,288 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/Promptzy/terminal-devtool/backend/jobs"
+	"github.com/Promptzy/terminal-devtool/backend/media"
+	"github.com/Promptzy/terminal-devtool/backend/webhooks"
+)
+
+// SubmitJobRequest represents a request to queue a job
+type SubmitJobRequest struct {
+	Type     string            `json:"type"`               // process, compress or compare
+	Request  json.RawMessage   `json:"request"`            // Body of the matching endpoint; preset_name and callback_url are applied
+	Priority string            `json:"priority,omitempty"` // high, normal (default) or low
+	Retry    *jobs.RetryPolicy `json:"retry,omitempty"`    // Retries of transient failures; 3 attempts by default
+}
+
+// Jobs handles listing jobs (GET) and submitting them (POST)
+func (h *Handler) Jobs(w http.ResponseWriter, r *http.Request) {
+	if h.Queue == nil {
+		http.Error(w, "Jobs are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.Queue.List())
+
+	case http.MethodPost:
+		var req SubmitJobRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		h.submitJob(w, r, req)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// submitJob queues a job and responds with it
+func (h *Handler) submitJob(w http.ResponseWriter, r *http.Request, req SubmitJobRequest) {
+	if h.Queue == nil {
+		http.Error(w, "Jobs are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	job, err := h.QueueJob(req, jobClient(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// QueueJob validates a job request and queues it for client. The returned
+// job has its queue position set.
+func (h *Handler) QueueJob(req SubmitJobRequest, client string) (jobs.Job, error) {
+	job, err := h.newJob(req)
+	if err != nil {
+		return job, err
+	}
+	job.Client = client
+	job = h.Queue.Submit(job)
+
+	// Report the position the job was queued at
+	job, _ = h.Queue.Get(job.ID)
+	return job, nil
+}
+
+// queueCallback queues a request that names a callback_url as a job of
+// jobType instead of running it while the client waits, and reports whether
+// it handled the request. Other requests are left to the caller.
+func (h *Handler) queueCallback(w http.ResponseWriter, r *http.Request, jobType string) bool {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return true
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	var body struct {
+		CallbackURL string `json:"callback_url"`
+	}
+	if json.Unmarshal(data, &body) != nil || body.CallbackURL == "" {
+		return false
+	}
+
+	h.submitJob(w, r, SubmitJobRequest{Type: jobType, Request: data})
+	return true
+}
+
+// GetJob handles requests for the status of one job
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Queue == nil {
+		http.Error(w, "Jobs are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	job, ok := h.Queue.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// DeadLetterJobs handles requests for the jobs that failed for good
+func (h *Handler) DeadLetterJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Queue == nil {
+		http.Error(w, "Jobs are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	failed := h.Queue.DeadLetter()
+	if failed == nil {
+		failed = []jobs.Job{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(failed)
+}
+
+// ResubmitJob handles requests to queue a failed job again
+func (h *Handler) ResubmitJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Queue == nil {
+		http.Error(w, "Jobs are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	job, err := h.Queue.Resubmit(r.PathValue("id"))
+	switch {
+	case errors.Is(err, jobs.ErrUnknownJob):
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	case errors.Is(err, jobs.ErrNotFailed):
+		http.Error(w, "Only failed jobs can be resubmitted", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Resubmit failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// newJob validates a submitted request and builds its job with absolute
+// input and output paths, so any runner can execute it
+func (h *Handler) newJob(req SubmitJobRequest) (jobs.Job, error) {
+	job := jobs.Job{Type: req.Type, Priority: req.Priority}
+	if len(req.Request) == 0 {
+		return job, fmt.Errorf("request is required")
+	}
+	if req.Priority != "" && !jobs.ValidPriority(req.Priority) {
+		return job, fmt.Errorf("invalid priority '%s': must be %s, %s or %s", req.Priority, jobs.PriorityHigh, jobs.PriorityNormal, jobs.PriorityLow)
+	}
+	if req.Retry != nil {
+		if err := req.Retry.Validate(); err != nil {
+			return job, fmt.Errorf("invalid retry: %w", err)
+		}
+		job.Retry = *req.Retry
+	}
+
+	var callback struct {
+		CallbackURL string `json:"callback_url"`
+	}
+	if err := json.Unmarshal(req.Request, &callback); err != nil {
+		return job, errInvalidBody
+	}
+	if callback.CallbackURL != "" {
+		if err := webhooks.ValidateURL(callback.CallbackURL); err != nil {
+			return job, fmt.Errorf("invalid callback_url: %w", err)
+		}
+		job.CallbackURL = callback.CallbackURL
+	}
+
+	var request any
+	switch req.Type {
+	case jobs.TypeProcess:
+		var process media.ProcessRequest
+		if err := h.decodeWithPreset(bytes.NewReader(req.Request), &process); err != nil {
+			return job, err
+		}
+		if process.Input == "" {
+			return job, fmt.Errorf("input path is required")
+		}
+		if len(process.Outputs) > 0 {
+			return job, fmt.Errorf("multiple outputs are not supported for jobs")
+		}
+		process.Input = h.resolvePath(process.Input)
+		process.Output = h.resolvePath(process.OutputPath())
+		job.Output, job.Requires, request = process.Output, process.Encoders(), process
+
+	case jobs.TypeCompress:
+		var compress media.CompressRequest
+		if err := h.decodeWithPreset(bytes.NewReader(req.Request), &compress); err != nil {
+			return job, err
+		}
+		if compress.Input == "" {
+			return job, fmt.Errorf("input path is required")
+		}
+		if compress.Bitrate == "" {
+			return job, fmt.Errorf("bitrate is required")
+		}
+		compress.Input = h.resolvePath(compress.Input)
+		compress.Output = h.resolvePath(compress.OutputPath())
+		job.Output, job.Requires, request = compress.Output, compress.Encoders(), compress
+
+	case jobs.TypeCompare:
+		var compare media.CompareRequest
+		if err := json.Unmarshal(req.Request, &compare); err != nil {
+			return job, errInvalidBody
+		}
+		if compare.Original == "" || compare.Processed == "" {
+			return job, fmt.Errorf("original and processed paths are required")
+		}
+		compare.Original = h.resolvePath(compare.Original)
+		compare.Processed = h.resolvePath(compare.Processed)
+		request = compare
+
+	default:
+		return job, fmt.Errorf("unknown job type '%s': must be %s, %s or %s", req.Type, jobs.TypeProcess, jobs.TypeCompress, jobs.TypeCompare)
+	}
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return job, err
+	}
+	job.Request = data
+	return job, nil
+}
+
+// keyClientPrefix starts the client names derived from API keys
+const keyClientPrefix = "key-"
+
+// jobClient identifies who submitted a job for fair scheduling. An X-API-Key
+// header decides the client, shown as a fingerprint so the key itself never
+// appears in job status; X-Client-ID is only used without a key and cannot
+// name a key's client.
+func jobClient(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return keyClientPrefix + hex.EncodeToString(sum[:6])
+	}
+	if id := r.Header.Get("X-Client-ID"); id != "" && !strings.HasPrefix(id, keyClientPrefix) {
+		return id
+	}
+	return jobs.DefaultClient
+}
+
+// resolvePath resolves a path relative to the base directory if not absolute
+func (h *Handler) resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(h.BaseDir, path)
+}
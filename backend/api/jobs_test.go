@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Promptzy/terminal-devtool/backend/jobs"
+)
+
+func TestJobClient(t *testing.T) {
+	tests := []struct {
+		name     string
+		clientID string
+		apiKey   string
+		want     string
+	}{
+		{name: "no headers", want: jobs.DefaultClient},
+		{name: "client ID", clientID: "encoder-farm", want: "encoder-farm"},
+		{name: "API key wins over client ID", clientID: "someone-else", apiKey: "secret", want: "key-2bb80d537b1d"},
+		{name: "client ID cannot name a key client", clientID: "key-2bb80d537b1d", want: jobs.DefaultClient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/jobs", nil)
+			if tt.clientID != "" {
+				r.Header.Set("X-Client-ID", tt.clientID)
+			}
+			if tt.apiKey != "" {
+				r.Header.Set("X-API-Key", tt.apiKey)
+			}
+			got := jobClient(r)
+			if got != tt.want {
+				t.Errorf("jobClient() = %q, want %q", got, tt.want)
+			}
+			if tt.apiKey != "" && strings.Contains(got, tt.apiKey) {
+				t.Errorf("jobClient() = %q shows the API key", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Promptzy/terminal-devtool/backend/jobs"
+	"github.com/Promptzy/terminal-devtool/backend/pipeline"
+)
+
+// PipelineRequest represents a request to run a stored pipeline template or
+// an inline pipeline definition on an input file
+type PipelineRequest struct {
+	Template string                     `json:"template,omitempty"` // Name of a stored template
+	Pipeline *pipeline.Definition       `json:"pipeline,omitempty"` // Inline definition, instead of a template
+	Input    string                     `json:"input"`              // File for {{input}}
+	Params   map[string]json.RawMessage `json:"params,omitempty"`   // Values for {{params.<name>}}
+	Priority string                     `json:"priority,omitempty"` // Priority of the pipeline's jobs
+}
+
+// Pipelines handles listing pipeline runs (GET) and starting them (POST)
+func (h *Handler) Pipelines(w http.ResponseWriter, r *http.Request) {
+	if h.Runs == nil {
+		http.Error(w, "Pipelines are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.Runs.List())
+
+	case http.MethodPost:
+		var req PipelineRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		definition, err := h.pipelineDefinition(req)
+		if errors.Is(err, pipeline.ErrUnknownTemplate) {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Input == "" {
+			http.Error(w, "Input path is required", http.StatusBadRequest)
+			return
+		}
+		if req.Priority != "" && !jobs.ValidPriority(req.Priority) {
+			http.Error(w, fmt.Sprintf("Invalid priority '%s': must be %s, %s or %s", req.Priority, jobs.PriorityHigh, jobs.PriorityNormal, jobs.PriorityLow), http.StatusBadRequest)
+			return
+		}
+
+		run, err := h.Runs.Start(definition, pipeline.RunOptions{
+			Template: req.Template,
+			Input:    h.resolvePath(req.Input),
+			Params:   req.Params,
+			Priority: req.Priority,
+			Client:   jobClient(r),
+		})
+		if err != nil {
+			http.Error(w, "Invalid pipeline: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(run)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GetPipeline handles requests for the status of one pipeline run and its steps
+func (h *Handler) GetPipeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Runs == nil {
+		http.Error(w, "Pipelines are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	run, err := h.Runs.Get(r.PathValue("id"))
+	if errors.Is(err, pipeline.ErrUnknownRun) {
+		http.Error(w, "Pipeline not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Pipeline lookup failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// PipelineTemplates handles listing pipeline templates (GET) and storing
+// them (POST)
+func (h *Handler) PipelineTemplates(w http.ResponseWriter, r *http.Request) {
+	if h.Templates == nil {
+		http.Error(w, "Pipelines are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.Templates.List())
+
+	case http.MethodPost:
+		var template pipeline.Definition
+		if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		created, err := h.Templates.Put(template)
+		if err != nil {
+			http.Error(w, "Invalid template: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(template)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// PipelineTemplate handles reading (GET) and removing (DELETE) one pipeline
+// template
+func (h *Handler) PipelineTemplate(w http.ResponseWriter, r *http.Request) {
+	if h.Templates == nil {
+		http.Error(w, "Pipelines are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := r.PathValue("name")
+	switch r.Method {
+	case http.MethodGet:
+		template, ok := h.Templates.Get(name)
+		if !ok {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(template)
+
+	case http.MethodDelete:
+		err := h.Templates.Delete(name)
+		if errors.Is(err, pipeline.ErrUnknownTemplate) {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Delete failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// pipelineDefinition returns the definition a pipeline request runs: the
+// named template or the inline pipeline
+func (h *Handler) pipelineDefinition(req PipelineRequest) (pipeline.Definition, error) {
+	switch {
+	case req.Template != "" && req.Pipeline != nil:
+		return pipeline.Definition{}, fmt.Errorf("set either template or pipeline, not both")
+	case req.Pipeline != nil:
+		return *req.Pipeline, nil
+	case req.Template == "":
+		return pipeline.Definition{}, fmt.Errorf("template or pipeline is required")
+	case h.Templates == nil:
+		return pipeline.Definition{}, fmt.Errorf("%w '%s'", pipeline.ErrUnknownTemplate, req.Template)
+	}
+
+	definition, ok := h.Templates.Get(req.Template)
+	if !ok {
+		return pipeline.Definition{}, fmt.Errorf("%w '%s'", pipeline.ErrUnknownTemplate, req.Template)
+	}
+	return definition, nil
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Promptzy/terminal-devtool/backend/presets"
+)
+
+// PresetResponse describes a preset and the ffmpeg command it resolves to
+type PresetResponse struct {
+	presets.Preset
+	Command string `json:"command,omitempty"`
+	Error   string `json:"error,omitempty"` // Why the command could not be resolved
+}
+
+// PresetsResponse represents the response structure for the presets endpoint
+type PresetsResponse struct {
+	File    string           `json:"file,omitempty"`
+	Presets []PresetResponse `json:"presets"`
+}
+
+// ListPresets returns the configured presets with their resolved ffmpeg commands
+func (h *Handler) ListPresets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := PresetsResponse{Presets: []PresetResponse{}}
+	if h.Presets != nil {
+		response.File = h.Presets.Path()
+		for _, preset := range h.Presets.List() {
+			entry := PresetResponse{Preset: preset}
+			if command, err := preset.Command(); err != nil {
+				entry.Error = err.Error()
+			} else {
+				entry.Command = command
+			}
+			response.Presets = append(response.Presets, entry)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
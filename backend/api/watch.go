@@ -0,0 +1,25 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Promptzy/terminal-devtool/backend/watch"
+)
+
+// WatchFolders handles requests for the state and recent actions of the
+// watch folders
+func (h *Handler) WatchFolders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	folders := []watch.FolderStatus{}
+	if h.Watcher != nil {
+		folders = h.Watcher.Status()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(folders)
+}
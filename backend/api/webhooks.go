@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Promptzy/terminal-devtool/backend/webhooks"
+)
+
+// Webhooks handles listing webhook subscriptions (GET) and adding them (POST)
+func (h *Handler) Webhooks(w http.ResponseWriter, r *http.Request) {
+	if h.Notifier == nil {
+		http.Error(w, "Webhooks are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.Notifier.Subscriptions())
+
+	case http.MethodPost:
+		var req webhooks.Subscription
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		sub, err := h.Notifier.Subscribe(webhooks.Subscription{URL: req.URL, Secret: req.Secret, Events: req.Events})
+		if err != nil {
+			http.Error(w, "Invalid subscription: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(sub)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// DeleteWebhook handles requests to remove a webhook subscription
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Notifier == nil {
+		http.Error(w, "Webhooks are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	err := h.Notifier.Unsubscribe(r.PathValue("id"))
+	if errors.Is(err, webhooks.ErrUnknownSubscription) {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unsubscribe failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JobDeliveries handles requests for the webhook delivery log of a job
+func (h *Handler) JobDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Queue == nil || h.Notifier == nil {
+		http.Error(w, "Webhooks are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	id := r.PathValue("id")
+	if _, ok := h.Queue.Get(id); !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Notifier.Deliveries(id))
+}
@@ -0,0 +1,492 @@
+package cluster
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Promptzy/terminal-devtool/backend/jobs"
+)
+
+// Timing of the worker protocol
+const (
+	HeartbeatInterval = 5 * time.Second
+	WorkerTimeout     = 3 * HeartbeatInterval // Workers silent for longer are considered dead
+	PullWait          = 10 * time.Second      // How long a pull waits for a job; below the server write timeout
+)
+
+// WorkerInfo describes a registered worker
+type WorkerInfo struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Encoders      []string  `json:"encoders"`
+	Slots         int       `json:"slots"` // Jobs the worker runs at the same time
+	Jobs          []string  `json:"jobs"`  // IDs of jobs running on the worker
+	RegisteredAt  time.Time `json:"registered_at"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+}
+
+// RegisterRequest is sent by a worker to join the cluster
+type RegisterRequest struct {
+	Name     string   `json:"name"`
+	Encoders []string `json:"encoders"` // Encoders of the worker's ffmpeg, as listed by its health check
+	Slots    int      `json:"slots,omitempty"`
+}
+
+// RegisterResponse tells a worker its ID and how often to send heartbeats
+type RegisterResponse struct {
+	WorkerID          string  `json:"worker_id"`
+	HeartbeatInterval float64 `json:"heartbeat_interval"` // Seconds
+}
+
+// WorkerRequest identifies the worker sending a pull
+type WorkerRequest struct {
+	WorkerID string `json:"worker_id"`
+}
+
+// HeartbeatRequest tells the coordinator a worker is alive and which jobs it
+// is running. Jobs is nil for workers that do not report them.
+type HeartbeatRequest struct {
+	WorkerID string   `json:"worker_id"`
+	Jobs     []string `json:"jobs"`
+}
+
+// ProgressRequest reports the progress of a job
+type ProgressRequest struct {
+	WorkerID string  `json:"worker_id"`
+	JobID    string  `json:"job_id"`
+	Progress float64 `json:"progress"`
+}
+
+// CompleteRequest reports the outcome of a job. The output is uploaded first.
+type CompleteRequest struct {
+	WorkerID string `json:"worker_id"`
+	JobID    string `json:"job_id"`
+	Error    string `json:"error,omitempty"` // Empty when the job succeeded
+}
+
+// TokenHeader carries the shared cluster token on every worker request
+const TokenHeader = "X-Cluster-Token"
+
+// Coordinator hands out queued jobs to remote workers, serves their inputs,
+// stores their outputs and requeues the jobs of workers that stop sending
+// heartbeats
+type Coordinator struct {
+	Queue *jobs.Queue
+	Token string // Shared secret workers send in TokenHeader
+
+	mu      sync.Mutex
+	workers map[string]*WorkerInfo
+	seq     int
+}
+
+// NewCoordinator creates a coordinator for the jobs in queue that accepts
+// workers presenting token
+func NewCoordinator(queue *jobs.Queue, token string) *Coordinator {
+	return &Coordinator{
+		Queue:   queue,
+		Token:   token,
+		workers: make(map[string]*WorkerInfo),
+	}
+}
+
+// Routes registers the worker protocol endpoints on mux. Every endpoint
+// requires the cluster token.
+func (c *Coordinator) Routes(mux *http.ServeMux) {
+	mux.Handle("/api/cluster/register", c.authorize(c.Register))
+	mux.Handle("/api/cluster/heartbeat", c.authorize(c.Heartbeat))
+	mux.Handle("/api/cluster/pull", c.authorize(c.Pull))
+	mux.Handle("/api/cluster/progress", c.authorize(c.Progress))
+	mux.Handle("/api/cluster/input", c.authorize(c.Input))
+	mux.Handle("/api/cluster/output", c.authorize(c.Output))
+	mux.Handle("/api/cluster/complete", c.authorize(c.Complete))
+	mux.Handle("/api/cluster/workers", c.authorize(c.Workers))
+}
+
+// authorize is a middleware that rejects requests without the cluster token
+func (c *Coordinator) authorize(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(TokenHeader)
+		if c.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) != 1 {
+			http.Error(w, "Invalid cluster token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// Watch removes workers whose heartbeats stopped and requeues their jobs,
+// until stop is closed
+func (c *Coordinator) Watch(stop <-chan struct{}) {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.expireWorkers(time.Now().Add(-WorkerTimeout))
+		}
+	}
+}
+
+// expireWorkers removes workers last heard from before cutoff
+func (c *Coordinator) expireWorkers(cutoff time.Time) {
+	c.mu.Lock()
+	var expired []*WorkerInfo
+	for id, worker := range c.workers {
+		if worker.LastHeartbeat.Before(cutoff) {
+			expired = append(expired, worker)
+			delete(c.workers, id)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, worker := range expired {
+		requeued := c.Queue.Requeue(worker.ID)
+		log.Printf("Worker %s (%s) stopped responding; requeued %d jobs", worker.ID, worker.Name, len(requeued))
+	}
+}
+
+// Register handles worker registration
+func (c *Coordinator) Register(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "Worker name is required", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	c.seq++
+	worker := &WorkerInfo{
+		ID:            fmt.Sprintf("%s-%d", req.Name, c.seq),
+		Name:          req.Name,
+		Encoders:      req.Encoders,
+		Slots:         max(req.Slots, 1),
+		RegisteredAt:  now,
+		LastHeartbeat: now,
+	}
+	c.workers[worker.ID] = worker
+	c.mu.Unlock()
+
+	log.Printf("Worker %s registered with %d encoders and %d slots", worker.ID, len(worker.Encoders), worker.Slots)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RegisterResponse{
+		WorkerID:          worker.ID,
+		HeartbeatInterval: HeartbeatInterval.Seconds(),
+	})
+}
+
+// Heartbeat records that a worker is alive and requeues jobs assigned to it
+// that it does not report as running. Unknown workers get 404 and register
+// again.
+func (c *Coordinator) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req HeartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if _, ok := c.touch(req.WorkerID); !ok {
+		http.Error(w, "Unknown worker", http.StatusNotFound)
+		return
+	}
+
+	// A job claimed within the last interval may not have reached the worker yet
+	if req.Jobs != nil {
+		c.releaseLost(req.WorkerID, req.Jobs, time.Now().Add(-HeartbeatInterval))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// releaseLost puts jobs that were claimed by a worker before cutoff but are
+// not among the jobs it runs back in the queue. Such a claim never reached
+// the worker, for example because the pull response was lost on the way.
+func (c *Coordinator) releaseLost(workerID string, running []string, cutoff time.Time) []string {
+	var released []string
+	for _, job := range c.Queue.List() {
+		if job.Status != jobs.StatusRunning || job.Worker != workerID || slices.Contains(running, job.ID) {
+			continue
+		}
+		if job.StartedAt == nil || !job.StartedAt.Before(cutoff) {
+			continue
+		}
+		if err := c.Queue.Release(job.ID, workerID); err == nil {
+			log.Printf("Job %s never reached worker %s; requeued", job.ID, workerID)
+			released = append(released, job.ID)
+		}
+	}
+	return released
+}
+
+// Pull hands the oldest queued job the worker can run to the worker. It
+// waits up to PullWait for one and answers 204 if none arrives.
+func (c *Coordinator) Pull(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req WorkerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	worker, ok := c.touch(req.WorkerID)
+	if !ok {
+		http.Error(w, "Unknown worker", http.StatusNotFound)
+		return
+	}
+
+	// Only hand out jobs whose encoders the worker's ffmpeg has
+	accept := func(job jobs.Job) bool {
+		if !job.Remote() {
+			return false
+		}
+		for _, encoder := range job.Requires {
+			if !slices.Contains(worker.Encoders, encoder) {
+				return false
+			}
+		}
+		return true
+	}
+
+	timeout := time.NewTimer(PullWait)
+	defer timeout.Stop()
+	for {
+		ready := c.Queue.Ready()
+		if job, ok := c.Queue.Claim(worker.ID, accept); ok {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(job); err != nil {
+				// The worker never got the job, so hand it to the next pull
+				log.Printf("Job %s could not be sent to worker %s: %v", job.ID, worker.ID, err)
+				c.Queue.Release(job.ID, worker.ID)
+				return
+			}
+			log.Printf("Job %s assigned to worker %s", job.ID, worker.ID)
+			return
+		}
+
+		select {
+		case <-ready:
+		case <-timeout.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Progress records the progress a worker reports for a job
+func (c *Coordinator) Progress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ProgressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	c.touch(req.WorkerID)
+
+	if err := c.Queue.SetProgress(req.JobID, req.WorkerID, req.Progress); err != nil {
+		jobError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Input serves the input file of a job to the worker running it
+func (c *Coordinator) Input(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, err := c.assignedJob(r)
+	if err != nil {
+		jobError(w, err)
+		return
+	}
+
+	// Large files take longer than the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	http.ServeFile(w, r, job.Input())
+}
+
+// Output stores the output file a worker uploads for a job at the job's
+// output path
+func (c *Coordinator) Output(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, err := c.assignedJob(r)
+	if err != nil {
+		jobError(w, err)
+		return
+	}
+
+	// Large files take longer than the server's read timeout
+	http.NewResponseController(w).SetReadDeadline(time.Time{})
+
+	if err := os.MkdirAll(filepath.Dir(job.Output), 0755); err != nil {
+		http.Error(w, "Upload failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write next to the target and rename so a broken upload never replaces a file
+	tmp := job.Output + ".upload"
+	file, err := os.Create(tmp)
+	if err != nil {
+		http.Error(w, "Upload failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = io.Copy(file, r.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, job.Output)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		http.Error(w, "Upload failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Complete records the outcome a worker reports for a job
+func (c *Coordinator) Complete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CompleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	c.touch(req.WorkerID)
+
+	var jobErr error
+	if req.Error != "" {
+		jobErr = errors.New(req.Error)
+	}
+	if err := c.Queue.Finish(req.JobID, req.WorkerID, nil, jobErr); err != nil {
+		jobError(w, err)
+		return
+	}
+
+	if jobErr != nil {
+		log.Printf("Job %s failed on worker %s: %s", req.JobID, req.WorkerID, req.Error)
+	} else {
+		log.Printf("Job %s succeeded on worker %s", req.JobID, req.WorkerID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Workers lists the registered workers and the jobs running on them
+func (c *Coordinator) Workers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	running := make(map[string][]string)
+	for _, job := range c.Queue.List() {
+		if job.Status == jobs.StatusRunning {
+			running[job.Worker] = append(running[job.Worker], job.ID)
+		}
+	}
+
+	c.mu.Lock()
+	workers := make([]WorkerInfo, 0, len(c.workers))
+	for _, worker := range c.workers {
+		info := *worker
+		info.Jobs = running[worker.ID]
+		workers = append(workers, info)
+	}
+	c.mu.Unlock()
+	sort.Slice(workers, func(i, j int) bool { return workers[i].RegisteredAt.Before(workers[j].RegisteredAt) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workers)
+}
+
+// touch records a sign of life from a worker and returns a copy of it
+func (c *Coordinator) touch(id string) (WorkerInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	worker, ok := c.workers[id]
+	if !ok {
+		return WorkerInfo{}, false
+	}
+	worker.LastHeartbeat = time.Now()
+	return *worker, true
+}
+
+// assignedJob returns the job named by the job_id query parameter if it is
+// running on the worker named by worker_id
+func (c *Coordinator) assignedJob(r *http.Request) (jobs.Job, error) {
+	workerID := r.URL.Query().Get("worker_id")
+	c.touch(workerID)
+
+	job, ok := c.Queue.Get(r.URL.Query().Get("job_id"))
+	if !ok {
+		return job, jobs.ErrUnknownJob
+	}
+	if job.Status != jobs.StatusRunning || job.Worker != workerID {
+		return job, jobs.ErrNotAssigned
+	}
+	return job, nil
+}
+
+// jobError writes the HTTP error for a rejected job update
+func jobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrUnknownJob):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, jobs.ErrNotAssigned):
+		// The job was reassigned, usually after missed heartbeats
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Promptzy/terminal-devtool/backend/jobs"
+)
+
+func TestCoordinatorToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string // Token of the coordinator
+		header string // Token sent by the worker
+		want   int
+	}{
+		{name: "matching token", token: "secret", header: "secret", want: http.StatusOK},
+		{name: "missing token", token: "secret", header: "", want: http.StatusUnauthorized},
+		{name: "wrong token", token: "secret", header: "secreT", want: http.StatusUnauthorized},
+		{name: "coordinator without token", token: "", header: "", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			NewCoordinator(jobs.NewQueue(), tt.token).Routes(mux)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/cluster/workers", nil)
+			if tt.header != "" {
+				req.Header.Set(TokenHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeartbeatReleasesLostJobs(t *testing.T) {
+	queue := jobs.NewQueue()
+	c := NewCoordinator(queue, "secret")
+	worker := "w-1"
+	c.workers[worker] = &WorkerInfo{ID: worker, Name: "w", LastHeartbeat: time.Now()}
+
+	lost := queue.Submit(jobs.Job{Type: jobs.TypeProcess})
+	running := queue.Submit(jobs.Job{Type: jobs.TypeProcess})
+	queue.Claim(worker, nil)
+	queue.Claim(worker, nil)
+
+	heartbeat := func(body string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/cluster/heartbeat", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c.Heartbeat(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("heartbeat status = %d", rec.Code)
+		}
+	}
+
+	// Claims younger than a heartbeat interval may still be on their way
+	heartbeat(`{"worker_id": "w-1", "jobs": ["` + running.ID + `"]}`)
+	if job, _ := queue.Get(lost.ID); job.Status != jobs.StatusRunning {
+		t.Fatalf("fresh claim status = %s, want running", job.Status)
+	}
+
+	// Older claims the worker does not run are released without an attempt
+	if released := c.releaseLost(worker, []string{running.ID}, time.Now().Add(time.Minute)); len(released) != 1 || released[0] != lost.ID {
+		t.Fatalf("releaseLost() = %v, want the lost job", released)
+	}
+	if job, _ := queue.Get(lost.ID); job.Status != jobs.StatusQueued || len(job.Attempts) != 0 {
+		t.Fatalf("lost job = %s with %d attempts, want queued without attempts", job.Status, len(job.Attempts))
+	}
+	if job, _ := queue.Get(running.ID); job.Status != jobs.StatusRunning {
+		t.Fatalf("reported job status = %s, want running", job.Status)
+	}
+}
@@ -0,0 +1,331 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Promptzy/terminal-devtool/backend/jobs"
+)
+
+// Worker pulls jobs from a coordinator, runs them on local copies of the
+// input and uploads the outputs
+type Worker struct {
+	Coordinator string   // Base URL of the coordinator, e.g. http://build1:8080
+	Name        string   // Name shown by the coordinator
+	Encoders    []string // Encoders of the local ffmpeg
+	Slots       int      // Jobs run at the same time
+	Dir         string   // Directory for job files; the system temp directory if empty
+	Token       string   // Cluster token sent in TokenHeader
+
+	client  *http.Client
+	mu      sync.Mutex
+	id      string
+	running map[string]bool // IDs of the jobs being run, sent with heartbeats
+}
+
+// Run registers with the coordinator and runs jobs until stop is closed.
+// Jobs that are running when stop is closed are finished first.
+func (w *Worker) Run(stop <-chan struct{}) {
+	// Pulls wait up to PullWait, so the timeout has to be longer
+	w.client = &http.Client{Timeout: PullWait + 10*time.Second}
+
+	if !w.register(stop) {
+		return
+	}
+
+	go w.heartbeat(stop)
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(w.Slots, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work(stop)
+		}()
+	}
+	wg.Wait()
+}
+
+// register joins the cluster, retrying until it succeeds or stop is closed
+func (w *Worker) register(stop <-chan struct{}) bool {
+	for {
+		var resp RegisterResponse
+		_, err := w.post("/api/cluster/register", RegisterRequest{
+			Name:     w.Name,
+			Encoders: w.Encoders,
+			Slots:    w.Slots,
+		}, &resp)
+		if err == nil {
+			w.mu.Lock()
+			w.id = resp.WorkerID
+			w.mu.Unlock()
+			log.Printf("Registered with %s as %s", w.Coordinator, resp.WorkerID)
+			return true
+		}
+
+		log.Printf("Registration with %s failed: %v", w.Coordinator, err)
+		select {
+		case <-stop:
+			return false
+		case <-time.After(HeartbeatInterval):
+		}
+	}
+}
+
+// heartbeat tells the coordinator the worker is alive and registers again if
+// the coordinator has forgotten it, e.g. after a restart
+func (w *Worker) heartbeat(stop <-chan struct{}) {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			status, err := w.post("/api/cluster/heartbeat", HeartbeatRequest{WorkerID: w.workerID(), Jobs: w.runningJobs()}, nil)
+			if status == http.StatusNotFound {
+				w.register(stop)
+			} else if err != nil {
+				log.Printf("Heartbeat failed: %v", err)
+			}
+		}
+	}
+}
+
+// work pulls and runs jobs one at a time until stop is closed
+func (w *Worker) work(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		var job jobs.Job
+		status, err := w.post("/api/cluster/pull", WorkerRequest{WorkerID: w.workerID()}, &job)
+		if status == http.StatusNoContent {
+			continue
+		}
+		if err != nil {
+			// Back off while the coordinator is unreachable or re-registering
+			log.Printf("Pull failed: %v", err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(HeartbeatInterval):
+			}
+			continue
+		}
+
+		w.setRunning(job.ID, true)
+		w.runJob(job)
+		w.setRunning(job.ID, false)
+	}
+}
+
+// runJob downloads a job's input, runs the job and reports its outcome
+func (w *Worker) runJob(job jobs.Job) {
+	id := w.workerID()
+	log.Printf("Job %s: running %s of %s", job.ID, job.Type, job.Input())
+
+	jobErr := w.execute(job, id)
+	if jobErr != nil {
+		log.Printf("Job %s failed: %v", job.ID, jobErr)
+	} else {
+		log.Printf("Job %s succeeded", job.ID)
+	}
+
+	complete := CompleteRequest{WorkerID: id, JobID: job.ID}
+	if jobErr != nil {
+		complete.Error = jobErr.Error()
+	}
+	if _, err := w.post("/api/cluster/complete", complete, nil); err != nil {
+		log.Printf("Job %s: reporting the result failed: %v", job.ID, err)
+	}
+}
+
+// execute runs a job in its own directory and uploads the output
+func (w *Worker) execute(job jobs.Job, workerID string) error {
+	dir, err := os.MkdirTemp(w.Dir, "job-"+job.ID+"-")
+	if err != nil {
+		return fmt.Errorf("failed to create job directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The output goes into its own directory since it may have the input's name
+	input := filepath.Join(dir, filepath.Base(job.Input()))
+	output := filepath.Join(dir, "output", filepath.Base(job.Output))
+
+	query := url.Values{"worker_id": {workerID}, "job_id": {job.ID}}.Encode()
+	if err := w.download("/api/cluster/input?"+query, input); err != nil {
+		return fmt.Errorf("failed to download input: %w", err)
+	}
+
+	local, err := job.WithPaths(input, output)
+	if err != nil {
+		return err
+	}
+	_, err = jobs.Execute(local, func(progress float64) {
+		w.post("/api/cluster/progress", ProgressRequest{WorkerID: workerID, JobID: job.ID, Progress: progress}, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := w.upload("/api/cluster/output?"+query, output); err != nil {
+		return fmt.Errorf("failed to upload output: %w", err)
+	}
+	return nil
+}
+
+// workerID returns the ID the coordinator assigned
+func (w *Worker) workerID() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.id
+}
+
+// setRunning adds a job to or removes it from the jobs being run
+func (w *Worker) setRunning(id string, running bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running == nil {
+		w.running = make(map[string]bool)
+	}
+	if running {
+		w.running[id] = true
+	} else {
+		delete(w.running, id)
+	}
+}
+
+// runningJobs returns the IDs of the jobs being run. It is never nil, so the
+// coordinator can tell an idle worker from one that does not report jobs.
+func (w *Worker) runningJobs() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ids := make([]string, 0, len(w.running))
+	for id := range w.running {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// post sends a JSON request to the coordinator and decodes the response into
+// out unless it is nil or the response has no content
+func (w *Worker) post(path string, body, out any) (int, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := w.newRequest(http.MethodPost, path, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return resp.StatusCode, err
+	}
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("invalid response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// download saves the response to a GET request at path
+func (w *Worker) download(path, target string) error {
+	req, err := w.newRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+
+	// Transfers are not bound by the request timeout
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// upload sends a file to path with PUT
+func (w *Worker) upload(path, source string) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	req, err := w.newRequest(http.MethodPut, path, file)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp)
+}
+
+// newRequest builds a request to the coordinator carrying the cluster token
+func (w *Worker) newRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, w.url(path), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(TokenHeader, w.Token)
+	return req, nil
+}
+
+// url returns the coordinator URL for path
+func (w *Worker) url(path string) string {
+	return strings.TrimSuffix(w.Coordinator, "/") + path
+}
+
+// checkResponse turns an error status from the coordinator into an error
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("coordinator returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+}
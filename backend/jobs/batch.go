@@ -0,0 +1,189 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Batch statuses besides the job statuses. A batch is running while any of
+// its jobs is queued or running.
+const (
+	StatusPartial = "completed_with_errors" // Some jobs succeeded and some failed
+)
+
+// ErrUnknownBatch is returned when a batch does not exist
+var ErrUnknownBatch = errors.New("unknown batch")
+
+// Batch is a group of jobs submitted together, one per input file
+type Batch struct {
+	ID        string    `json:"id"`
+	Source    string    `json:"source"` // Directory or glob pattern the inputs came from
+	Client    string    `json:"client"`
+	CreatedAt time.Time `json:"created_at"`
+
+	jobIDs []string
+}
+
+// BatchFile is the state of one input of a batch
+type BatchFile struct {
+	Input    string  `json:"input"`
+	Output   string  `json:"output"`
+	JobID    string  `json:"job_id"`
+	Status   string  `json:"status"`
+	Progress float64 `json:"progress"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// BatchFailure summarises the inputs that failed with the same error
+type BatchFailure struct {
+	Error  string   `json:"error"`
+	Inputs []string `json:"inputs"`
+}
+
+// BatchStatus is a batch with the aggregate state of its jobs
+type BatchStatus struct {
+	Batch
+	Status     string         `json:"status"`   // queued, running, succeeded, failed or completed_with_errors
+	Progress   float64        `json:"progress"` // Percent of the batch done; finished jobs count as done
+	Total      int            `json:"total"`
+	Queued     int            `json:"queued"`
+	Running    int            `json:"running"`
+	Succeeded  int            `json:"succeeded"`
+	Failed     int            `json:"failed"`
+	Files      []BatchFile    `json:"files"`
+	Failures   []BatchFailure `json:"failures,omitempty"` // Failed inputs grouped by error
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
+
+// SubmitBatch queues the jobs of a batch and returns the batch with its ID
+// set. Each job is tagged with the batch ID and the batch's client.
+func (q *Queue) SubmitBatch(batch Batch, jobs []Job) BatchStatus {
+	batch.ID = newID()
+	batch.CreatedAt = time.Now()
+	if batch.Client == "" {
+		batch.Client = DefaultClient
+	}
+
+	for _, job := range jobs {
+		job.Batch = batch.ID
+		job.Client = batch.Client
+		batch.jobIDs = append(batch.jobIDs, q.Submit(job).ID)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.batches[batch.ID] = &batch
+	q.batchOrder = append(q.batchOrder, batch.ID)
+	return q.batchStatus(&batch)
+}
+
+// GetBatch returns the status of the batch with the given ID
+func (q *Queue) GetBatch(id string) (BatchStatus, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	batch, ok := q.batches[id]
+	if !ok {
+		return BatchStatus{}, fmt.Errorf("%w '%s'", ErrUnknownBatch, id)
+	}
+	return q.batchStatus(batch), nil
+}
+
+// Batches returns the status of all batches in submission order
+func (q *Queue) Batches() []BatchStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	batches := make([]BatchStatus, 0, len(q.batchOrder))
+	for _, id := range q.batchOrder {
+		batches = append(batches, q.batchStatus(q.batches[id]))
+	}
+	return batches
+}
+
+// pruneBatches drops the batches that finished longer than the retention
+// period before now. Their jobs are left for prune. Callers hold q.mu.
+func (q *Queue) pruneBatches(now time.Time) {
+	if q.Retention <= 0 {
+		return
+	}
+
+	kept := q.batchOrder[:0]
+	for _, id := range q.batchOrder {
+		status := q.batchStatus(q.batches[id])
+		if status.FinishedAt != nil && now.Sub(*status.FinishedAt) > q.Retention {
+			delete(q.batches, id)
+			continue
+		}
+		kept = append(kept, id)
+	}
+	q.batchOrder = kept
+}
+
+// batchStatus aggregates the jobs of a batch. Callers hold q.mu.
+func (q *Queue) batchStatus(batch *Batch) BatchStatus {
+	status := BatchStatus{Batch: *batch, Total: len(batch.jobIDs), Files: []BatchFile{}}
+	failures := make(map[string]int) // Index in status.Failures by error
+
+	var done float64
+	for _, id := range batch.jobIDs {
+		job := q.jobs[id]
+		status.Files = append(status.Files, BatchFile{
+			Input:    job.Input(),
+			Output:   job.Output,
+			JobID:    job.ID,
+			Status:   job.Status,
+			Progress: job.Progress,
+			Error:    job.Error,
+		})
+
+		switch job.Status {
+		case StatusQueued:
+			status.Queued++
+			done += job.Progress
+		case StatusRunning:
+			status.Running++
+			done += job.Progress
+		case StatusSucceeded:
+			status.Succeeded++
+			done += 100
+		case StatusFailed:
+			status.Failed++
+			done += 100
+
+			i, ok := failures[job.Error]
+			if !ok {
+				i = len(status.Failures)
+				failures[job.Error] = i
+				status.Failures = append(status.Failures, BatchFailure{Error: job.Error})
+			}
+			status.Failures[i].Inputs = append(status.Failures[i].Inputs, job.Input())
+		}
+
+		if job.FinishedAt != nil && (status.FinishedAt == nil || job.FinishedAt.After(*status.FinishedAt)) {
+			status.FinishedAt = job.FinishedAt
+		}
+	}
+	if status.Total > 0 {
+		status.Progress = done / float64(status.Total)
+	}
+
+	switch {
+	case status.Queued == status.Total:
+		status.Status = StatusQueued
+	case status.Queued > 0 || status.Running > 0:
+		status.Status = StatusRunning
+	case status.Failed == 0:
+		status.Status = StatusSucceeded
+	case status.Succeeded == 0:
+		status.Status = StatusFailed
+	default:
+		status.Status = StatusPartial
+	}
+	if status.Status == StatusQueued || status.Status == StatusRunning {
+		status.FinishedAt = nil
+	}
+	return status
+}
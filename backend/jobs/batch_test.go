@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPruneBatches(t *testing.T) {
+	q := NewQueue()
+	finished := q.SubmitBatch(Batch{}, []Job{{}})
+	running := q.SubmitBatch(Batch{}, []Job{{}, {}})
+
+	// Finish the first batch's job and start one of the second's
+	job, _ := q.Claim("w", nil)
+	if err := q.Finish(job.ID, "w", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	q.Claim("w", nil)
+
+	q.mu.Lock()
+	q.pruneBatches(time.Now().Add(q.Retention - time.Minute))
+	q.mu.Unlock()
+	if len(q.Batches()) != 2 {
+		t.Fatalf("batches within retention = %d, want 2", len(q.Batches()))
+	}
+
+	q.mu.Lock()
+	q.pruneBatches(time.Now().Add(q.Retention + time.Minute))
+	q.mu.Unlock()
+	if _, err := q.GetBatch(finished.ID); !errors.Is(err, ErrUnknownBatch) {
+		t.Fatalf("GetBatch() of expired batch error = %v, want ErrUnknownBatch", err)
+	}
+	if _, err := q.GetBatch(running.ID); err != nil {
+		t.Fatalf("GetBatch() of running batch error = %v", err)
+	}
+	if _, ok := q.Get(job.ID); !ok {
+		t.Fatalf("job of expired batch was dropped")
+	}
+}
@@ -0,0 +1,608 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Job statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Job types
+const (
+	TypeProcess  = "process"
+	TypeCompress = "compress"
+	TypeCompare  = "compare"
+)
+
+// Job events passed to Queue.OnEvent
+const (
+	EventStarted   = "job.started"
+	EventProgress  = "job.progress" // Sent when progress passes a milestone
+	EventSucceeded = "job.succeeded"
+	EventFailed    = "job.failed" // Sent once the job has failed for good, not for attempts that are retried
+)
+
+// progressMilestones are the percentages that trigger EventProgress
+var progressMilestones = []float64{25, 50, 75}
+
+// Job priorities. Queued jobs of a higher priority always start first; running
+// jobs are never interrupted.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// priorityRank orders priorities, highest first
+var priorityRank = map[string]int{PriorityHigh: 0, PriorityNormal: 1, PriorityLow: 2}
+
+// DefaultRetention is how long finished jobs and batches are kept
+const DefaultRetention = 24 * time.Hour
+
+// pruneInterval is how often submissions look for expired jobs and batches
+const pruneInterval = time.Minute
+
+// DefaultClient is the client of jobs submitted without a client ID or API key
+const DefaultClient = "anonymous"
+
+// Errors returned when a job update does not apply
+var (
+	ErrUnknownJob  = errors.New("unknown job")
+	ErrNotAssigned = errors.New("job is not running on this worker")
+	ErrNotFailed   = errors.New("job has not failed")
+)
+
+// Job is a media request queued for execution by a local runner or a remote worker
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`                   // process, compress or compare
+	Request     json.RawMessage `json:"request"`                // Request body with resolved paths
+	Output      string          `json:"output"`                 // File the job writes
+	Result      json.RawMessage `json:"result,omitempty"`       // Result of a compare job
+	CallbackURL string          `json:"callback_url,omitempty"` // Receives the job's events
+	Requires    []string        `json:"requires,omitempty"`     // Encoders a worker needs to run the job
+	Priority    string          `json:"priority"`               // high, normal or low
+	Client      string          `json:"client"`                 // Client ID or API key fingerprint the job is queued for
+	Batch       string          `json:"batch,omitempty"`        // ID of the batch the job belongs to
+	Status      string          `json:"status"`
+	Position    int             `json:"queue_position,omitempty"` // 1 for the next job to start, while queued
+	Progress    float64         `json:"progress"`                 // Percent of the encode done
+	Worker      string          `json:"worker,omitempty"`
+	Error       string          `json:"error,omitempty"` // Error of the last attempt
+	Retry       RetryPolicy     `json:"retry"`
+	Attempts    []Attempt       `json:"attempts,omitempty"`
+	RetryAt     *time.Time      `json:"retry_at,omitempty"` // When a job waiting to be retried may start again
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+
+	attemptBase int     // Attempts made before the job was last resubmitted
+	milestone   float64 // Last progress milestone reported for the current attempt
+}
+
+// Remote reports whether a remote worker can run the job. Compare jobs only
+// read file metadata, so they run on the server that holds the files.
+func (j Job) Remote() bool {
+	return j.Type != TypeCompare
+}
+
+// Done reports whether the job has finished
+func (j Job) Done() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+// ValidPriority reports whether priority is a known job priority
+func ValidPriority(priority string) bool {
+	_, ok := priorityRank[priority]
+	return ok
+}
+
+// Queue holds jobs and hands them out to runners by priority, sharing each
+// priority fairly between clients
+type Queue struct {
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	order  []string
+	ready  chan struct{}     // Closed and replaced whenever a job becomes claimable
+	served map[string]uint64 // Claim sequence number of each client's last started job
+	claims uint64
+
+	// Queue position of each queued job; nil after a status change until
+	// positions is called again
+	positionCache map[string]int
+
+	batches    map[string]*Batch
+	batchOrder []string
+	pruned     time.Time // Last time expired jobs and batches were dropped
+
+	// Retention is how long finished jobs and batches are kept before they
+	// are dropped; they are kept forever if zero
+	Retention time.Duration
+
+	// OnEvent, if set, is called with each job event. It runs with the queue
+	// locked, so it must not block or call back into the queue.
+	OnEvent func(event string, job Job)
+}
+
+// NewQueue creates an empty queue
+func NewQueue() *Queue {
+	return &Queue{
+		jobs:    make(map[string]*Job),
+		ready:   make(chan struct{}),
+		served:  make(map[string]uint64),
+		batches: make(map[string]*Batch),
+
+		Retention: DefaultRetention,
+	}
+}
+
+// Submit adds a job to the queue and returns it with its ID and status set
+func (q *Queue) Submit(job Job) Job {
+	job.ID = newID()
+	job.Status = StatusQueued
+	job.CreatedAt = time.Now()
+	if job.Priority == "" {
+		job.Priority = PriorityNormal
+	}
+	if job.Client == "" {
+		job.Client = DefaultClient
+	}
+	job.Retry = job.Retry.withDefaults()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if job.CreatedAt.Sub(q.pruned) >= pruneInterval {
+		q.prune(job.CreatedAt)
+	}
+	q.jobs[job.ID] = &job
+	q.order = append(q.order, job.ID)
+	q.statusChanged()
+	q.wake()
+	return job
+}
+
+// prune drops the jobs and batches that finished longer than the retention
+// period before now. Jobs of a batch that is kept are kept with it. Callers
+// hold q.mu.
+func (q *Queue) prune(now time.Time) {
+	q.pruned = now
+	if q.Retention <= 0 {
+		return
+	}
+	q.pruneBatches(now)
+
+	kept := q.order[:0]
+	clients := make(map[string]bool)
+	for _, id := range q.order {
+		job := q.jobs[id]
+		_, inBatch := q.batches[job.Batch]
+		if job.Done() && !inBatch && now.Sub(*job.FinishedAt) > q.Retention {
+			delete(q.jobs, id)
+			continue
+		}
+		kept = append(kept, id)
+		clients[job.Client] = true
+	}
+	q.order = kept
+
+	// Clients without jobs left count as served long ago
+	for client := range q.served {
+		if !clients[client] {
+			delete(q.served, client)
+		}
+	}
+}
+
+// Get returns the job with the given ID
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	result := *job
+	result.Position = q.positions()[id]
+	return result, true
+}
+
+// List returns all jobs in submission order
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	positions := q.positions()
+	jobs := make([]Job, 0, len(q.order))
+	for _, id := range q.order {
+		job := *q.jobs[id]
+		job.Position = positions[id]
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// Ready returns a channel that is closed when a job may have become claimable
+func (q *Queue) Ready() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.ready
+}
+
+// Claim marks the next queued job that accept allows as running on worker
+// and returns it. accept may be nil to take any job.
+func (q *Queue) Claim(worker string, accept func(Job) bool) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var candidates []*Job
+	for _, id := range q.order {
+		job := q.jobs[id]
+		if job.Status == StatusQueued && !job.waiting(now) && (accept == nil || accept(*job)) {
+			candidates = append(candidates, job)
+		}
+	}
+
+	job := nextJob(candidates, q.runningPerClient(), q.served)
+	if job == nil {
+		return Job{}, false
+	}
+
+	q.claims++
+	q.served[job.Client] = q.claims
+
+	job.Status = StatusRunning
+	q.statusChanged()
+	job.Worker = worker
+	job.Progress = 0
+	job.StartedAt = &now
+	job.RetryAt = nil
+	job.milestone = 0
+	q.notify(EventStarted, job)
+	return *job, true
+}
+
+// waiting reports whether a queued job is waiting out its retry backoff
+func (j *Job) waiting(now time.Time) bool {
+	return j.RetryAt != nil && now.Before(*j.RetryAt)
+}
+
+// nextJob picks the job to start next: the highest priority first; within a
+// priority the client with the fewest running jobs, then the client served
+// least recently, so one client's batch cannot starve the others; within a
+// client the oldest job. candidates are in submission order.
+func nextJob(candidates []*Job, running map[string]int, served map[string]uint64) *Job {
+	var best *Job
+	for _, job := range candidates {
+		if best == nil {
+			best = job
+			continue
+		}
+		if rank, bestRank := priorityRank[job.Priority], priorityRank[best.Priority]; rank != bestRank {
+			if rank < bestRank {
+				best = job
+			}
+			continue
+		}
+		if job.Client == best.Client {
+			continue
+		}
+		if running[job.Client] != running[best.Client] {
+			if running[job.Client] < running[best.Client] {
+				best = job
+			}
+			continue
+		}
+		if served[job.Client] < served[best.Client] {
+			best = job
+		}
+	}
+	return best
+}
+
+// positions returns the queue position of every queued job. They are
+// computed once per status change since Get and List need them on every
+// call. Callers hold q.mu and must not modify the map.
+func (q *Queue) positions() map[string]int {
+	if q.positionCache == nil {
+		q.positionCache = q.schedulePositions()
+	}
+	return q.positionCache
+}
+
+// statusChanged drops the cached queue positions. Callers hold q.mu.
+func (q *Queue) statusChanged() {
+	q.positionCache = nil
+}
+
+// schedulePositions finds the queue position of every queued job by
+// replaying the scheduling order as if each job started in turn. Callers
+// hold q.mu.
+func (q *Queue) schedulePositions() map[string]int {
+	var queued []*Job
+	for _, id := range q.order {
+		if job := q.jobs[id]; job.Status == StatusQueued {
+			queued = append(queued, job)
+		}
+	}
+
+	running := q.runningPerClient()
+	served := make(map[string]uint64, len(q.served))
+	for client, seq := range q.served {
+		served[client] = seq
+	}
+	claims := q.claims
+
+	positions := make(map[string]int, len(queued))
+	for position := 1; len(queued) > 0; position++ {
+		job := nextJob(queued, running, served)
+		positions[job.ID] = position
+
+		claims++
+		served[job.Client] = claims
+		running[job.Client]++
+		for i, queuedJob := range queued {
+			if queuedJob == job {
+				queued = append(queued[:i], queued[i+1:]...)
+				break
+			}
+		}
+	}
+	return positions
+}
+
+// runningPerClient counts the running jobs of each client. Callers hold q.mu.
+func (q *Queue) runningPerClient() map[string]int {
+	running := make(map[string]int)
+	for _, job := range q.jobs {
+		if job.Status == StatusRunning {
+			running[job.Client]++
+		}
+	}
+	return running
+}
+
+// SetProgress records the progress of a running job. Updates from a worker
+// the job is no longer assigned to are rejected.
+func (q *Queue) SetProgress(id, worker string, progress float64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.running(id, worker)
+	if err != nil {
+		return err
+	}
+	job.Progress = progress
+
+	// Report only the highest milestone passed since the last update
+	var passed float64
+	for _, milestone := range progressMilestones {
+		if progress >= milestone && milestone > job.milestone {
+			passed = milestone
+		}
+	}
+	if passed > 0 {
+		job.milestone = passed
+		q.notify(EventProgress, job)
+	}
+	return nil
+}
+
+// Finish records the outcome of a running job and the result it returned, if
+// any. A transient failure puts the job back in the queue to be retried after
+// its backoff while attempts remain.
+func (q *Queue) Finish(id, worker string, result json.RawMessage, jobErr error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.running(id, worker)
+	if err != nil {
+		return err
+	}
+
+	if jobErr != nil {
+		q.fail(job, jobErr.Error(), Retryable(jobErr.Error()))
+		return nil
+	}
+
+	q.recordAttempt(job, "", false)
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = StatusSucceeded
+	q.statusChanged()
+	job.Progress = 100
+	job.Error = ""
+	job.Result = result
+	q.notify(EventSucceeded, job)
+	return nil
+}
+
+// Requeue takes the running jobs away from a worker that stopped responding
+// and returns their IDs. The jobs keep their place in the queue and are
+// retried at once, unless they have used up their attempts.
+func (q *Queue) Requeue(worker string) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var ids []string
+	for _, id := range q.order {
+		job := q.jobs[id]
+		if job.Status != StatusRunning || job.Worker != worker {
+			continue
+		}
+		q.recordAttempt(job, fmt.Sprintf("worker %s stopped responding", worker), true)
+		if job.attempts() >= job.Retry.MaxAttempts {
+			q.finishFailed(job)
+			continue
+		}
+		q.requeue(job)
+		ids = append(ids, id)
+	}
+	if len(ids) > 0 {
+		q.wake()
+	}
+	return ids
+}
+
+// Release puts a job claimed by worker back in the queue at its old place
+// without counting an attempt, for a claim that never reached the worker
+func (q *Queue) Release(id, worker string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.running(id, worker)
+	if err != nil {
+		return err
+	}
+	q.requeue(job)
+	q.wake()
+	return nil
+}
+
+// DeadLetter returns the jobs that failed for good, in submission order
+func (q *Queue) DeadLetter() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var jobs []Job
+	for _, id := range q.order {
+		if job := q.jobs[id]; job.Status == StatusFailed {
+			jobs = append(jobs, *job)
+		}
+	}
+	return jobs
+}
+
+// Resubmit queues a failed job again with a fresh set of attempts. Its
+// earlier attempts are kept in its history.
+func (q *Queue) Resubmit(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w '%s'", ErrUnknownJob, id)
+	}
+	if job.Status != StatusFailed {
+		return Job{}, fmt.Errorf("job '%s': %w", id, ErrNotFailed)
+	}
+
+	job.attemptBase = len(job.Attempts)
+	job.Error = ""
+	job.FinishedAt = nil
+	q.requeue(job)
+	q.wake()
+
+	result := *job
+	result.Position = q.positions()[id]
+	return result, nil
+}
+
+// fail records a failed attempt and either schedules a retry or fails the
+// job. Callers hold q.mu.
+func (q *Queue) fail(job *Job, message string, retryable bool) {
+	q.recordAttempt(job, message, retryable)
+	if !retryable || job.attempts() >= job.Retry.MaxAttempts {
+		q.finishFailed(job)
+		return
+	}
+
+	delay := job.Retry.delay(job.attempts())
+	retryAt := time.Now().Add(delay)
+	q.requeue(job)
+	job.RetryAt = &retryAt
+
+	// Claims skip the job until its backoff has passed, so wake runners then
+	time.AfterFunc(delay, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.wake()
+	})
+}
+
+// recordAttempt adds the attempt that just ended to a running job's history
+// and keeps its error as the job's error. Callers hold q.mu.
+func (q *Queue) recordAttempt(job *Job, message string, retryable bool) {
+	attempt := Attempt{
+		Number:     len(job.Attempts) + 1,
+		Worker:     job.Worker,
+		FinishedAt: time.Now(),
+		Error:      message,
+		Retryable:  retryable,
+	}
+	if job.StartedAt != nil {
+		attempt.StartedAt = *job.StartedAt
+	}
+	job.Attempts = append(job.Attempts, attempt)
+	job.Error = message
+}
+
+// finishFailed marks a job as failed for good. Callers hold q.mu.
+func (q *Queue) finishFailed(job *Job) {
+	now := time.Now()
+	job.Status = StatusFailed
+	q.statusChanged()
+	job.FinishedAt = &now
+	job.RetryAt = nil
+	q.notify(EventFailed, job)
+}
+
+// notify passes a job event to OnEvent. Callers hold q.mu.
+func (q *Queue) notify(event string, job *Job) {
+	if q.OnEvent != nil {
+		q.OnEvent(event, *job)
+	}
+}
+
+// requeue puts a job back in the queue at its old place. Callers hold q.mu.
+func (q *Queue) requeue(job *Job) {
+	job.Status = StatusQueued
+	q.statusChanged()
+	job.Worker = ""
+	job.Progress = 0
+	job.StartedAt = nil
+	job.RetryAt = nil
+}
+
+// attempts counts the attempts since the job was last submitted
+func (j *Job) attempts() int {
+	return len(j.Attempts) - j.attemptBase
+}
+
+// running returns a job that is running on worker. Callers hold q.mu.
+func (q *Queue) running(id, worker string) (*Job, error) {
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownJob, id)
+	}
+	if job.Status != StatusRunning || job.Worker != worker {
+		return nil, fmt.Errorf("job '%s': %w", id, ErrNotAssigned)
+	}
+	return job, nil
+}
+
+// wake signals runners waiting on Ready. Callers hold q.mu.
+func (q *Queue) wake() {
+	close(q.ready)
+	q.ready = make(chan struct{})
+}
+
+// newID returns a random job ID
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
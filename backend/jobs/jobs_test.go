@@ -0,0 +1,170 @@
+package jobs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNextJob(t *testing.T) {
+	job := func(id, priority, client string) *Job {
+		return &Job{ID: id, Priority: priority, Client: client}
+	}
+
+	tests := []struct {
+		name       string
+		candidates []*Job
+		running    map[string]int
+		served     map[string]uint64
+		want       string
+	}{
+		{name: "no candidates", want: ""},
+		{
+			name:       "oldest job first",
+			candidates: []*Job{job("a", PriorityNormal, "x"), job("b", PriorityNormal, "x")},
+			want:       "a",
+		},
+		{
+			name:       "higher priority first",
+			candidates: []*Job{job("a", PriorityLow, "x"), job("b", PriorityNormal, "x"), job("c", PriorityHigh, "y")},
+			want:       "c",
+		},
+		{
+			name:       "client with fewer running jobs",
+			candidates: []*Job{job("a", PriorityNormal, "x"), job("b", PriorityNormal, "y")},
+			running:    map[string]int{"x": 2, "y": 1},
+			want:       "b",
+		},
+		{
+			name:       "client served least recently",
+			candidates: []*Job{job("a", PriorityNormal, "x"), job("b", PriorityNormal, "y")},
+			served:     map[string]uint64{"x": 5, "y": 3},
+			want:       "b",
+		},
+		{
+			name:       "priority before fairness",
+			candidates: []*Job{job("a", PriorityHigh, "x"), job("b", PriorityNormal, "y")},
+			running:    map[string]int{"x": 3},
+			want:       "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextJob(tt.candidates, tt.running, tt.served)
+			switch {
+			case got == nil && tt.want != "":
+				t.Fatalf("nextJob() = nil, want %s", tt.want)
+			case got != nil && got.ID != tt.want:
+				t.Fatalf("nextJob() = %s, want %q", got.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueuePositions(t *testing.T) {
+	q := NewQueue()
+	submit := func(priority, client string) string {
+		return q.Submit(Job{Priority: priority, Client: client}).ID
+	}
+
+	// Client x queues a batch before y and z each queue one job
+	x1 := submit(PriorityNormal, "x")
+	x2 := submit(PriorityNormal, "x")
+	x3 := submit(PriorityNormal, "x")
+	y1 := submit(PriorityNormal, "y")
+	z1 := submit(PriorityLow, "z")
+	h1 := submit(PriorityHigh, "x")
+
+	positions := func() []int {
+		var got []int
+		for _, id := range []string{x1, x2, x3, y1, z1, h1} {
+			job, _ := q.Get(id)
+			got = append(got, job.Position)
+		}
+		return got
+	}
+
+	if got, want := positions(), []int{3, 4, 5, 2, 6, 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("positions = %v, want %v", got, want)
+	}
+
+	// Starting a job moves everyone up; running jobs have no position
+	if job, ok := q.Claim("w", nil); !ok || job.ID != h1 {
+		t.Fatalf("Claim() = %s, %t, want %s", job.ID, ok, h1)
+	}
+	if got, want := positions(), []int{2, 3, 4, 1, 5, 0}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("positions after claim = %v, want %v", got, want)
+	}
+
+	for i, job := range q.List() {
+		if want := positions()[i]; job.Position != want {
+			t.Errorf("List()[%d].Position = %d, want %d", i, job.Position, want)
+		}
+	}
+}
+
+func TestQueueRelease(t *testing.T) {
+	q := NewQueue()
+	first := q.Submit(Job{}).ID
+	q.Submit(Job{})
+
+	job, _ := q.Claim("w1", nil)
+	if err := q.Release(job.ID, "w2"); !errors.Is(err, ErrNotAssigned) {
+		t.Fatalf("Release() by another worker error = %v, want ErrNotAssigned", err)
+	}
+	if err := q.Release(job.ID, "w1"); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	released, _ := q.Get(first)
+	if released.Status != StatusQueued || released.Worker != "" || released.Position != 1 || len(released.Attempts) != 0 {
+		t.Fatalf("released job = %+v, want queued first without attempts", released)
+	}
+	if job, _ := q.Claim("w2", nil); job.ID != first {
+		t.Fatalf("Claim() after release = %s, want %s", job.ID, first)
+	}
+}
+
+func TestQueuePrune(t *testing.T) {
+	q := NewQueue()
+	old := q.Submit(Job{Client: "x"}).ID
+	batch := q.SubmitBatch(Batch{}, []Job{{}})
+	queued := q.Submit(Job{Client: "y"}).ID
+
+	// Finish the lone job and the batch's job; the last job stays queued
+	for range 2 {
+		job, _ := q.Claim("w", func(j Job) bool { return j.ID != queued })
+		if err := q.Finish(job.ID, "w", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q.mu.Lock()
+	q.prune(time.Now().Add(q.Retention - time.Minute))
+	q.mu.Unlock()
+	if len(q.List()) != 3 {
+		t.Fatalf("jobs within retention = %d, want 3", len(q.List()))
+	}
+
+	q.mu.Lock()
+	q.prune(time.Now().Add(q.Retention + time.Minute))
+	q.mu.Unlock()
+	var ids []string
+	for _, job := range q.List() {
+		ids = append(ids, job.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{queued}) {
+		t.Fatalf("jobs after retention = %v, want only %s", ids, queued)
+	}
+	if _, err := q.GetBatch(batch.ID); !errors.Is(err, ErrUnknownBatch) {
+		t.Fatalf("GetBatch() error = %v, want ErrUnknownBatch", err)
+	}
+	if _, ok := q.served["x"]; ok {
+		t.Fatalf("served still tracks client x without jobs")
+	}
+	if _, ok := q.Get(old); ok {
+		t.Fatalf("Get() of expired job succeeded")
+	}
+}
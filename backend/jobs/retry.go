@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Retry defaults
+const (
+	DefaultMaxAttempts = 3
+	DefaultBackoff     = 5 * time.Second
+	DefaultMaxBackoff  = 5 * time.Minute
+	MaxAttemptsLimit   = 10
+)
+
+// transientErrors are fragments of errors that may go away on their own: a
+// full disk, a killed process, an input that is still being written, or a
+// dropped connection to the coordinator. Corrupt inputs are not retried.
+var transientErrors = []string{
+	"no space left on device",
+	"disk quota exceeded",
+	"cannot allocate memory",
+	"too many open files",
+	"resource temporarily unavailable",
+	"input/output error",
+	"signal: killed",
+	"signal: terminated",
+	"moov atom not found",
+	"partial file",
+	"unexpected eof",
+	"connection refused",
+	"connection reset",
+	"broken pipe",
+	"i/o timeout",
+	"stopped responding",
+}
+
+// RetryPolicy controls how often a failed job is retried. Only transient
+// failures are retried; the wait doubles after each attempt.
+type RetryPolicy struct {
+	MaxAttempts int     `json:"max_attempts,omitempty"` // Attempts including the first (default 3, at most 10); 1 disables retries
+	Backoff     float64 `json:"backoff,omitempty"`      // Seconds before the first retry (default 5)
+	MaxBackoff  float64 `json:"max_backoff,omitempty"`  // Longest wait between attempts in seconds (default 300)
+}
+
+// Attempt records one run of a job
+type Attempt struct {
+	Number     int       `json:"number"`
+	Worker     string    `json:"worker"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      string    `json:"error,omitempty"`
+	Retryable  bool      `json:"retryable,omitempty"` // The error was classified as transient
+}
+
+// Validate checks a retry policy for invalid values
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 || p.MaxAttempts > MaxAttemptsLimit {
+		return fmt.Errorf("max_attempts must be between 1 and %d", MaxAttemptsLimit)
+	}
+	if p.Backoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("backoff and max_backoff must not be negative")
+	}
+	return nil
+}
+
+// withDefaults fills unset fields with the defaults
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.Backoff == 0 {
+		p.Backoff = DefaultBackoff.Seconds()
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = DefaultMaxBackoff.Seconds()
+	}
+	return p
+}
+
+// delay returns the wait before the given retry, counting from 1
+func (p RetryPolicy) delay(retry int) time.Duration {
+	seconds := p.Backoff
+	for i := 1; i < retry && seconds < p.MaxBackoff; i++ {
+		seconds *= 2
+	}
+	return time.Duration(min(seconds, p.MaxBackoff) * float64(time.Second))
+}
+
+// Retryable reports whether a job error looks transient, so running the job
+// again may succeed. Only the summary of the error is classified.
+func Retryable(message string) bool {
+	summary := strings.ToLower(errorSummary(message))
+	for _, fragment := range transientErrors {
+		if strings.Contains(summary, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorSummary returns the lines of an error that say why it failed: the
+// first, which carries the exit status of a process, and the last, which for
+// an ffmpeg error with its stderr tail is ffmpeg's final error. Warnings
+// earlier in the tail do not decide whether a retry can help.
+func errorSummary(message string) string {
+	var lines []string
+	for _, line := range strings.Split(message, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	switch len(lines) {
+	case 0:
+		return ""
+	case 1:
+		return lines[0]
+	}
+	return lines[0] + "\n" + lines[len(lines)-1]
+}
@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Backoff: 5, MaxBackoff: 30}
+
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{3, 20 * time.Second},
+		{4, 30 * time.Second},
+		{10, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := policy.delay(tt.retry); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.retry, got, tt.want)
+		}
+	}
+
+	if got := (RetryPolicy{}).withDefaults().delay(1); got != DefaultBackoff {
+		t.Errorf("default delay(1) = %v, want %v", got, DefaultBackoff)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    bool
+	}{
+		{name: "killed process", message: "ffmpeg processing failed: signal: killed\nOutput: frame=  120 fps=30", want: true},
+		{name: "full disk", message: "failed to create output directory: mkdir /out: no space left on device", want: true},
+		{name: "input still being written", message: "ffmpeg processing failed: exit status 1\nOutput: Stream #0:0: Video: h264\n/media/in.mp4: moov atom not found", want: true},
+		{name: "coordinator unreachable", message: "dial tcp 10.0.0.2:8080: connect: connection refused", want: true},
+		{name: "worker lost", message: "worker w1-1 stopped responding", want: true},
+		{name: "corrupt input", message: "ffmpeg processing failed: exit status 1\nOutput: /media/in.mp4: Invalid data found when processing input", want: false},
+		{name: "truncated input", message: "ffmpeg processing failed: exit status 1\nOutput: /media/in.mp4: End of file", want: false},
+		{name: "unknown encoder", message: "ffmpeg processing failed: exit status 1\nOutput: Unknown encoder 'libfoo'", want: false},
+		{
+			name: "warning earlier in the tail",
+			message: "ffmpeg processing failed: exit status 1\nOutput: [mp4 @ 0x1] partial file, skipping\n" +
+				"[mp4 @ 0x1] connection reset in a metadata tag\nError initializing output stream 0:0 -- Error while opening encoder\n",
+			want: false,
+		},
+		{name: "empty", message: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.message); got != tt.want {
+				t.Errorf("Retryable() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
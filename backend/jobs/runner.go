@@ -0,0 +1,140 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/Promptzy/terminal-devtool/backend/media"
+)
+
+// Execute runs a job's request on this machine and reports the encode
+// progress in percent to onProgress, if set. Compare jobs return their
+// result; the other jobs write it to the job's output.
+func Execute(job Job, onProgress func(float64)) (json.RawMessage, error) {
+	switch job.Type {
+	case TypeProcess:
+		var req media.ProcessRequest
+		if err := json.Unmarshal(job.Request, &req); err != nil {
+			return nil, fmt.Errorf("invalid process request: %w", err)
+		}
+		_, err := media.ProcessMediaWithProgress(req, func(progress media.ProcessProgress) {
+			if onProgress != nil {
+				onProgress(progress.Progress)
+			}
+		})
+		return nil, err
+
+	case TypeCompress:
+		var req media.CompressRequest
+		if err := json.Unmarshal(job.Request, &req); err != nil {
+			return nil, fmt.Errorf("invalid compress request: %w", err)
+		}
+		_, err := media.Compress(req)
+		return nil, err
+
+	case TypeCompare:
+		var req media.CompareRequest
+		if err := json.Unmarshal(job.Request, &req); err != nil {
+			return nil, fmt.Errorf("invalid compare request: %w", err)
+		}
+		result, err := media.CompareMedia(req.Original, req.Processed)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(result)
+	}
+
+	return nil, fmt.Errorf("unknown job type '%s'", job.Type)
+}
+
+// Input returns the input path of the job's request, or the original of a
+// compare request
+func (j Job) Input() string {
+	var req struct {
+		Input    string `json:"input"`
+		Original string `json:"original"`
+	}
+	json.Unmarshal(j.Request, &req)
+	if req.Input == "" {
+		return req.Original
+	}
+	return req.Input
+}
+
+// WithPaths returns a copy of the job whose request reads input and writes
+// output. Workers use it to run a job on local copies of the files.
+func (j Job) WithPaths(input, output string) (Job, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(j.Request, &fields); err != nil {
+		return j, fmt.Errorf("invalid %s request: %w", j.Type, err)
+	}
+
+	fields["input"], _ = json.Marshal(input)
+	fields["output"], _ = json.Marshal(output)
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return j, err
+	}
+	j.Request = data
+	j.Output = output
+	return j, nil
+}
+
+// Runner executes queued jobs on this machine
+type Runner struct {
+	Queue   *Queue
+	Name    string         // Worker name recorded on claimed jobs
+	Workers int            // Jobs run at the same time
+	Accept  func(Job) bool // Jobs the runner takes; nil for all
+}
+
+// Run executes jobs until stop is closed. Jobs that are running when stop
+// is closed are finished first.
+func (r *Runner) Run(stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	for i := 0; i < max(r.Workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.work(stop)
+		}()
+	}
+	wg.Wait()
+}
+
+// work claims and executes jobs one at a time until stop is closed
+func (r *Runner) work(stop <-chan struct{}) {
+	for {
+		// Take the channel before claiming so a job submitted in between is not missed
+		ready := r.Queue.Ready()
+		job, ok := r.Queue.Claim(r.Name, r.Accept)
+		if !ok {
+			select {
+			case <-ready:
+				continue
+			case <-stop:
+				return
+			}
+		}
+
+		log.Printf("Job %s: running %s of %s", job.ID, job.Type, job.Input())
+		result, err := Execute(job, func(progress float64) {
+			r.Queue.SetProgress(job.ID, r.Name, progress)
+		})
+		if err != nil {
+			log.Printf("Job %s failed: %v", job.ID, err)
+		} else {
+			log.Printf("Job %s succeeded: %s", job.ID, job.Output)
+		}
+		r.Queue.Finish(job.ID, r.Name, result, err)
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+	}
+}
@@ -2,22 +2,50 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/Promptzy/terminal-devtool/backend/api"
+	"github.com/Promptzy/terminal-devtool/backend/cluster"
+	"github.com/Promptzy/terminal-devtool/backend/jobs"
+	"github.com/Promptzy/terminal-devtool/backend/media"
 	"github.com/Promptzy/terminal-devtool/backend/middleware"
+	"github.com/Promptzy/terminal-devtool/backend/pipeline"
+	"github.com/Promptzy/terminal-devtool/backend/presets"
+	"github.com/Promptzy/terminal-devtool/backend/watch"
+	"github.com/Promptzy/terminal-devtool/backend/webhooks"
 )
 
 const (
-	DefaultPort     = "8080"
-	DefaultHost     = "localhost"
-	ShutdownTimeout = 5 * time.Second
+	DefaultPort            = "8080"
+	DefaultHost            = "localhost"
+	DefaultCoordinatorHost = "0.0.0.0" // Coordinators must be reachable by remote workers
+	ShutdownTimeout        = 5 * time.Second
+
+	DefaultPresetsFile   = "presets.json"
+	PresetReloadInterval = 2 * time.Second
+
+	DefaultJobWorkers = 1
+
+	DefaultWatchFile = "watch.json"
+
+	DefaultPipelinesFile = "pipelines.json"
+)
+
+// Server modes, set with the MODE environment variable
+const (
+	ModeStandalone  = "standalone"  // Run the API and execute jobs locally
+	ModeCoordinator = "coordinator" // Run the API and hand jobs to remote workers
+	ModeWorker      = "worker"      // Execute jobs from the coordinator at COORDINATOR_URL
 )
 
 func main() {
@@ -34,17 +62,162 @@ func main() {
 	}
 	fmt.Printf("📁 Media base directory: %s\n", baseDir)
 
+	// Load encoding presets (PRESETS_FILE or presets.json in the base directory)
+	presetsPath := os.Getenv("PRESETS_FILE")
+	if presetsPath == "" {
+		presetsPath = filepath.Join(baseDir, DefaultPresetsFile)
+	}
+	presetStore := presets.NewStore(presetsPath)
+	if err := presetStore.Load(); err != nil {
+		log.Printf("No presets loaded: %v", err)
+	} else {
+		fmt.Printf("🎛️  Loaded %d presets from %s\n", len(presetStore.List()), presetsPath)
+	}
+
+	// Reload presets whenever the file changes
+	stopPresetWatch := make(chan struct{})
+	go presetStore.Watch(PresetReloadInterval, stopPresetWatch)
+
+	// Limit concurrent encodes (ENCODE_WORKERS, default one per CPU)
+	if workers, err := strconv.Atoi(os.Getenv("ENCODE_WORKERS")); err == nil && workers > 0 {
+		media.EncodePool = media.NewPool(workers)
+	}
+	fmt.Printf("⚙️  Encode workers: %d\n", media.EncodePool.Size())
+
+	// Jobs run at the same time by this process (JOB_WORKERS, default 1)
+	jobWorkers := DefaultJobWorkers
+	if n, err := strconv.Atoi(os.Getenv("JOB_WORKERS")); err == nil && n > 0 {
+		jobWorkers = n
+	}
+
+	mode := os.Getenv("MODE")
+	if mode == "" {
+		mode = ModeStandalone
+	}
+	if mode != ModeStandalone && mode != ModeCoordinator && mode != ModeWorker {
+		log.Fatalf("Unknown MODE '%s': must be %s, %s or %s", mode, ModeStandalone, ModeCoordinator, ModeWorker)
+	}
+	fmt.Printf("🧭 Mode: %s\n", mode)
+
+	// Coordinator and workers authenticate each other with a shared token
+	clusterToken := os.Getenv("CLUSTER_TOKEN")
+	if clusterToken == "" && mode != ModeStandalone {
+		log.Fatalf("CLUSTER_TOKEN is required in %s mode", mode)
+	}
+
+	// Workers only run jobs from the coordinator and serve no API
+	if mode == ModeWorker {
+		runWorker(jobWorkers, clusterToken)
+		close(stopPresetWatch)
+		return
+	}
+
 	// Create the API handler
 	apiHandler := api.NewHandler(baseDir)
+	apiHandler.Presets = presetStore
+	apiHandler.Queue = jobs.NewQueue()
+
+	// Keep finished jobs and batches for JOB_RETENTION (default 24h, 0 keeps them)
+	if retention, err := time.ParseDuration(os.Getenv("JOB_RETENTION")); err == nil && retention >= 0 {
+		apiHandler.Queue.Retention = retention
+	}
+
+	// Deliver job events to callback URLs and subscriptions, signing callback
+	// deliveries with WEBHOOK_SECRET
+	webhookSecret := os.Getenv("WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		log.Printf("WEBHOOK_SECRET is not set: callback_url deliveries are not signed")
+	}
+	apiHandler.Notifier = webhooks.NewNotifier(webhookSecret)
+	apiHandler.Queue.OnEvent = apiHandler.Notifier.JobEvent
 
 	// Create a new mux router and apply middleware
 	mux := http.NewServeMux()
 
+	// Execute jobs locally, or hand them to workers that register with this server
+	stopJobs := make(chan struct{})
+	if mode == ModeCoordinator {
+		coordinator := cluster.NewCoordinator(apiHandler.Queue, clusterToken)
+		coordinator.Routes(mux)
+		go coordinator.Watch(stopJobs)
+
+		// Jobs that need the files in place, like compare, run here
+		runner := &jobs.Runner{
+			Queue:   apiHandler.Queue,
+			Name:    "coordinator",
+			Workers: jobWorkers,
+			Accept:  func(job jobs.Job) bool { return !job.Remote() },
+		}
+		go runner.Run(stopJobs)
+	} else {
+		runner := &jobs.Runner{Queue: apiHandler.Queue, Name: "local", Workers: jobWorkers}
+		go runner.Run(stopJobs)
+	}
+
+	// Process files dropped into the watch folders (WATCH_FILE or watch.json in
+	// the base directory, if present)
+	watchPath := os.Getenv("WATCH_FILE")
+	if watchPath == "" {
+		watchPath = filepath.Join(baseDir, DefaultWatchFile)
+	}
+	if _, err := os.Stat(watchPath); err == nil || os.Getenv("WATCH_FILE") != "" {
+		config, err := watch.LoadConfig(watchPath, baseDir)
+		if err != nil {
+			log.Fatalf("Failed to load watch folders: %v", err)
+		}
+		submit := func(request json.RawMessage, priority, client string) (jobs.Job, error) {
+			return apiHandler.QueueJob(api.SubmitJobRequest{Type: jobs.TypeProcess, Request: request, Priority: priority}, client)
+		}
+		apiHandler.Watcher = watch.NewWatcher(config, presetStore, apiHandler.Queue, submit)
+		go apiHandler.Watcher.Run(stopJobs)
+		for _, folder := range config.Folders {
+			fmt.Printf("👀 Watching %s with preset %s\n", folder.Path, folder.Preset)
+		}
+	}
+
+	// Run multi-step pipelines, with templates stored in PIPELINES_FILE or
+	// pipelines.json in the base directory
+	pipelinesPath := os.Getenv("PIPELINES_FILE")
+	if pipelinesPath == "" {
+		pipelinesPath = filepath.Join(baseDir, DefaultPipelinesFile)
+	}
+	apiHandler.Templates = pipeline.NewTemplateStore(pipelinesPath)
+	if err := apiHandler.Templates.Load(); err != nil {
+		log.Fatalf("Failed to load pipeline templates: %v", err)
+	}
+	fmt.Printf("🧩 Loaded %d pipeline templates from %s\n", len(apiHandler.Templates.List()), pipelinesPath)
+	apiHandler.Runs = pipeline.NewManager(baseDir, apiHandler.Queue, func(jobType string, request json.RawMessage, priority, client string) (jobs.Job, error) {
+		return apiHandler.QueueJob(api.SubmitJobRequest{Type: jobType, Request: request, Priority: priority}, client)
+	})
+	apiHandler.Runs.Retention = apiHandler.Queue.Retention
+
 	// Register routes
 	mux.HandleFunc("/api/process", apiHandler.ProcessMedia)
 	mux.HandleFunc("/api/compare", apiHandler.CompareMedia)
 	mux.HandleFunc("/api/info", apiHandler.GetMediaInfo)
 	mux.HandleFunc("/api/compress", apiHandler.CompressMedia)
+	mux.HandleFunc("/api/presets", apiHandler.ListPresets)
+	mux.HandleFunc("/api/remux", apiHandler.RemuxMedia)
+	mux.HandleFunc("/api/edit", apiHandler.EditMetadata)
+	mux.HandleFunc("/api/cropdetect", apiHandler.DetectCrop)
+	mux.HandleFunc("/api/gop", apiHandler.AnalyzeGOP)
+	mux.HandleFunc("/api/verify", apiHandler.VerifyMedia)
+	mux.HandleFunc("/api/scenes", apiHandler.DetectScenes)
+	mux.HandleFunc("/api/detect", apiHandler.DetectSegments)
+	mux.HandleFunc("/api/jobs", apiHandler.Jobs)
+	mux.HandleFunc("/api/jobs/dead-letter", apiHandler.DeadLetterJobs)
+	mux.HandleFunc("/api/jobs/{id}", apiHandler.GetJob)
+	mux.HandleFunc("/api/jobs/{id}/resubmit", apiHandler.ResubmitJob)
+	mux.HandleFunc("/api/jobs/{id}/deliveries", apiHandler.JobDeliveries)
+	mux.HandleFunc("/api/batch", apiHandler.Batches)
+	mux.HandleFunc("/api/batch/{id}", apiHandler.GetBatch)
+	mux.HandleFunc("/api/watch", apiHandler.WatchFolders)
+	mux.HandleFunc("/api/pipelines", apiHandler.Pipelines)
+	mux.HandleFunc("/api/pipelines/{id}", apiHandler.GetPipeline)
+	mux.HandleFunc("/api/pipelines/templates", apiHandler.PipelineTemplates)
+	mux.HandleFunc("/api/pipelines/templates/{name}", apiHandler.PipelineTemplate)
+	mux.HandleFunc("/api/webhooks", apiHandler.Webhooks)
+	mux.HandleFunc("/api/webhooks/{id}", apiHandler.DeleteWebhook)
 
 	// Register health check endpoints
 	mux.HandleFunc("/health", apiHandler.HealthCheck)
@@ -64,8 +237,17 @@ func main() {
 		port = DefaultPort
 	}
 
+	// Get the listen address from HOST; coordinators listen on every interface by default
+	host := os.Getenv("HOST")
+	if host == "" {
+		host = DefaultHost
+		if mode == ModeCoordinator {
+			host = DefaultCoordinatorHost
+		}
+	}
+
 	// Create server
-	address := fmt.Sprintf("%s:%s", DefaultHost, port)
+	address := net.JoinHostPort(host, port)
 	server := &http.Server{
 		Addr:         address,
 		Handler:      rootHandler,
@@ -87,6 +269,8 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	fmt.Println("\n🛑 Shutting down server...")
+	close(stopPresetWatch)
+	close(stopJobs)
 
 	// Create a deadline for graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
@@ -98,3 +282,48 @@ func main() {
 
 	fmt.Println("👋 Server successfully shut down")
 }
+
+// runWorker registers with the coordinator at COORDINATOR_URL and runs its
+// jobs, authenticating with token, until the process is interrupted
+func runWorker(slots int, token string) {
+	coordinatorURL := os.Getenv("COORDINATOR_URL")
+	if coordinatorURL == "" {
+		log.Fatalf("COORDINATOR_URL is required in %s mode", ModeWorker)
+	}
+
+	name := os.Getenv("WORKER_NAME")
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+
+	encoders, err := media.ListEncoders()
+	if err != nil {
+		log.Printf("No encoders found: %v", err)
+	}
+
+	worker := &cluster.Worker{
+		Coordinator: coordinatorURL,
+		Name:        name,
+		Encoders:    encoders,
+		Slots:       slots,
+		Dir:         os.Getenv("WORKER_DIR"),
+		Token:       token,
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		worker.Run(stop)
+		close(done)
+	}()
+	fmt.Printf("🛠️  Worker %s running %d jobs at a time for %s\n", name, slots, coordinatorURL)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	fmt.Println("\n🛑 Stopping worker after running jobs finish...")
+	close(stop)
+	<-done
+
+	fmt.Println("👋 Worker stopped")
+}
@@ -0,0 +1,245 @@
+package media
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Animation defaults
+const (
+	DefaultAnimationFPS    = 12.0         // Frame rate when none is requested
+	DefaultAnimationWidth  = 480          // Width when no size is requested (never upscaled)
+	DefaultDither          = "sierra2_4a" // paletteuse default dithering
+	DefaultWebPAnimQuality = 75
+
+	minAnimationFPS      = 5.0  // Size targeting never goes below this frame rate
+	minAnimationWidth    = 120  // Size targeting never goes below this width
+	maxSizeAttempts      = 8    // Encodes tried before giving up on MaxFileSize
+	sizeReductionFactor  = 0.85 // Dimension scale applied on each attempt
+	frameRateReduceRatio = 0.8  // Frame rate scale applied on every other attempt
+)
+
+// ditherModes lists the dithering algorithms supported by paletteuse
+var ditherModes = []string{"bayer", "heckbert", "floyd_steinberg", "sierra2", "sierra2_4a", "sierra3", "burkes", "atkinson", "none"}
+
+// isAnimationOutput reports whether an output path is an animated GIF or WebP
+func isAnimationOutput(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".gif" || ext == ".webp"
+}
+
+// processAnimation renders a high-quality animated GIF or WebP. GIFs use a
+// palette generated from the clip itself; with MaxFileSize set the clip is
+// re-encoded with lower frame rate and size until it fits. The request must
+// have been through prepareProcess.
+func processAnimation(req ProcessRequest, output string) (string, error) {
+	fps, width, height, err := animationDefaults(&req)
+	if err != nil {
+		return "", err
+	}
+
+	if !req.DryRun {
+		if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+			return "", fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	scale := 1.0
+	for attempt := 1; ; attempt++ {
+		req.Width = scaledDimension(width, scale)
+		req.Height = scaledDimension(height, scale)
+		req.FrameRate = strconv.FormatFloat(fps, 'f', -1, 64)
+
+		args, err := buildAnimationArgs(req, output)
+		if err != nil {
+			return "", err
+		}
+
+		cmdString := fmt.Sprintf("ffmpeg %s", strings.Join(args, " "))
+		fmt.Printf("Executing: %s\n", cmdString)
+
+		if req.DryRun {
+			fmt.Printf("[Dry Run] %s\n", cmdString)
+			return cmdString, nil
+		}
+
+		if out, err := runFFmpeg(args); err != nil {
+			return "", fmt.Errorf("animation encoding failed: %w\nOutput: %s", err, string(out))
+		}
+
+		if req.MaxFileSize <= 0 {
+			break
+		}
+
+		fileInfo, err := os.Stat(output)
+		if err != nil {
+			return "", fmt.Errorf("failed to get output size: %w", err)
+		}
+		if fileInfo.Size() <= req.MaxFileSize {
+			break
+		}
+
+		fmt.Printf("Animation is %d bytes, above the %d byte target (attempt %d)\n", fileInfo.Size(), req.MaxFileSize, attempt)
+
+		// Alternate between shrinking the picture and dropping frames; once the
+		// picture is at its minimum size only the frame rate is lowered
+		nextScale := scale * sizeReductionFactor
+		if float64(max(width, height))*nextScale < minAnimationWidth {
+			nextScale = scale
+		}
+		nextFPS := fps
+		if attempt%2 == 0 || nextScale == scale {
+			nextFPS = math.Max(fps*frameRateReduceRatio, minAnimationFPS)
+		}
+
+		if attempt == maxSizeAttempts || (nextScale == scale && nextFPS == fps) {
+			return "", fmt.Errorf("could not reach %d bytes: smallest result was %d bytes at %.2f fps", req.MaxFileSize, fileInfo.Size(), fps)
+		}
+		scale, fps = nextScale, nextFPS
+	}
+
+	fmt.Printf("Processing complete: %s\n", output)
+	return output, nil
+}
+
+// animationDefaults validates the animation options of a request and fills
+// in the default dither. It returns the frame rate and target size of the
+// first attempt; Resolution is folded into the returned size.
+func animationDefaults(req *ProcessRequest) (float64, int, int, error) {
+	if req.Dither == "" {
+		req.Dither = DefaultDither
+	}
+	if !slices.Contains(ditherModes, req.Dither) {
+		return 0, 0, 0, fmt.Errorf("invalid dither '%s': must be one of %s", req.Dither, strings.Join(ditherModes, ", "))
+	}
+	if req.Loop < 0 {
+		return 0, 0, 0, fmt.Errorf("invalid loop %d: must be 0 (forever) or a play count", req.Loop)
+	}
+	if req.Start < 0 || req.Duration < 0 {
+		return 0, 0, 0, fmt.Errorf("start and duration must not be negative")
+	}
+	if req.Quality < 0 || req.Quality > 100 {
+		return 0, 0, 0, fmt.Errorf("invalid quality %d: must be between 1 and 100, or 0 for the default", req.Quality)
+	}
+
+	fps := DefaultAnimationFPS
+	if req.FrameRate != "" {
+		rate, err := parseFrameRate(req.FrameRate)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		fps = rate
+	}
+
+	width, height, err := resizeTarget(*req)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if width == 0 && height == 0 {
+		width = DefaultAnimationWidth
+		req.NoUpscale = true
+	}
+	req.Resolution = ""
+	return fps, width, height, nil
+}
+
+// buildAnimationArgs builds the ffmpeg argument list for a GIF or animated WebP
+func buildAnimationArgs(req ProcessRequest, output string) ([]string, error) {
+	args := []string{"-hide_banner", "-y"}
+
+	if req.Start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(req.Start, 'f', 3, 64))
+	}
+	args = append(args, "-i", req.Input)
+	if req.Duration > 0 {
+		args = append(args, "-t", strconv.FormatFloat(req.Duration, 'f', 3, 64))
+	}
+
+	graph := NewFilterGraph()
+	frames := graph.Chain("0:v:0")
+
+	source, err := sourceFilters(req)
+	if err != nil {
+		return nil, err
+	}
+	frames.Add(source...)
+
+	// Drop frames before scaling so fewer frames are resized
+	frames.Add(NewFilter("fps").Set("fps", req.FrameRate))
+
+	resize, err := resizeFilters(req)
+	if err != nil {
+		return nil, err
+	}
+	frames.Add(resize...)
+
+	gif := strings.ToLower(filepath.Ext(output)) == ".gif"
+	if gif {
+		// Build a palette from the clip and map the frames onto it in one decode
+		frames.Add(NewFilter("split")).Output("frames", "palette_src")
+		graph.Chain("palette_src").
+			Add(NewFilter("palettegen").Set("stats_mode", "diff")).
+			Output("palette")
+		paletteUse := NewFilter("paletteuse").Set("dither", req.Dither).Set("diff_mode", "rectangle")
+		graph.Chain("frames", "palette").Add(paletteUse).Output("vout")
+	} else {
+		frames.Output("vout")
+	}
+
+	if err := graph.Validate(); err != nil {
+		return nil, err
+	}
+	args = append(args, "-filter_complex", graph.String(), "-map", "[vout]", "-an")
+
+	if gif {
+		args = append(args, "-c:v", "gif", "-loop", strconv.Itoa(gifLoopValue(req.Loop)))
+	} else {
+		quality := req.Quality
+		if quality == 0 {
+			quality = DefaultWebPAnimQuality
+		}
+		args = append(args, "-c:v", "libwebp", "-quality", strconv.Itoa(quality), "-loop", strconv.Itoa(req.Loop))
+		if req.Lossless {
+			args = append(args, "-lossless", "1")
+		}
+	}
+
+	return append(args, output), nil
+}
+
+// gifLoopValue converts a play count (0 = forever) to the GIF muxer's loop
+// option, which counts repeats after the first play and uses -1 for none
+func gifLoopValue(plays int) int {
+	switch {
+	case plays == 0:
+		return 0
+	case plays == 1:
+		return -1
+	default:
+		return plays - 1
+	}
+}
+
+// scaledDimension scales a dimension, keeping 0 as "derive from aspect ratio"
+func scaledDimension(size int, scale float64) int {
+	if size == 0 {
+		return 0
+	}
+	return evenDimension(int(float64(size) * scale))
+}
+
+// parseFrameRate parses a frame rate given as a number or a rational
+func parseFrameRate(value string) (float64, error) {
+	if fps, err := strconv.ParseFloat(value, 64); err == nil && fps > 0 {
+		return fps, nil
+	}
+	if rate, err := ParseRational(value); err == nil && rate.Valid() {
+		return rate.Float64(), nil
+	}
+	return 0, fmt.Errorf("invalid frame rate '%s'", value)
+}
@@ -0,0 +1,108 @@
+package media
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFrameRate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{"12", 12, false},
+		{"29.97", 29.97, false},
+		{"30000/1001", 30000.0 / 1001, false},
+		{"0", 0, true},
+		{"-5", 0, true},
+		{"0/1", 0, true},
+		{"fast", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseFrameRate(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFrameRate(%q) error = %v, want error %t", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseFrameRate(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBuildAnimationArgs(t *testing.T) {
+	req := ProcessRequest{
+		Input:     "clip.mp4",
+		Start:     2,
+		Duration:  3,
+		FrameRate: "10",
+		Width:     320,
+		Crop:      &CropRect{Width: 1920, Height: 800, Y: 140},
+		HDR:       HDRToneMap,
+		Dither:    DefaultDither,
+	}
+
+	args, err := buildAnimationArgs(req, "out.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(args, " ")
+	for _, want := range []string{
+		"-ss 2.000 -i clip.mp4 -t 3.000",
+		"[0:v:0]crop=w=1920:h=800:x=0:y=140,zscale=t=linear",
+		"tonemap=tonemap=hable",
+		"fps=fps=10,scale=",
+		"split[frames][palette_src]",
+		"-c:v gif -loop 0",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("args %q do not contain %q", got, want)
+		}
+	}
+
+	args, err = buildAnimationArgs(ProcessRequest{Input: "clip.mp4", FrameRate: "12", Width: 480, Loop: 2, Lossless: true}, "out.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(args, " "); !strings.HasSuffix(got, "-an -c:v libwebp -quality 75 -loop 2 -lossless 1 out.webp") {
+		t.Errorf("WebP args = %q", got)
+	}
+}
+
+func TestProcessAnimationValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ProcessRequest
+		wantErr string
+	}{
+		{name: "valid", req: ProcessRequest{Quality: 60}},
+		{name: "quality above 100", req: ProcessRequest{Quality: 150}, wantErr: "invalid quality 150"},
+		{name: "negative loop", req: ProcessRequest{Loop: -1}, wantErr: "invalid loop"},
+		{name: "unknown dither", req: ProcessRequest{Dither: "noise"}, wantErr: "invalid dither"},
+		{name: "invalid frame rate", req: ProcessRequest{FrameRate: "x"}, wantErr: "invalid frame rate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Input = "clip.mp4"
+			tt.req.DryRun = true
+			_, err := processAnimation(tt.req, "out.webp")
+			checkError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestProcessMediaRejectsAnimationPassthrough(t *testing.T) {
+	_, err := ProcessMedia(ProcessRequest{Input: "clip.mp4", Output: "out.gif", HDR: HDRPassthrough, DryRun: true})
+	checkError(t, err, "not supported for animations")
+}
+
+func TestGIFLoopValue(t *testing.T) {
+	for plays, want := range map[int]int{0: 0, 1: -1, 2: 1, 5: 4} {
+		if got := gifLoopValue(plays); got != want {
+			t.Errorf("gifLoopValue(%d) = %d, want %d", plays, got, want)
+		}
+	}
+}
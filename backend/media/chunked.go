@@ -0,0 +1,336 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MinChunkDuration is the shortest segment chunked encoding creates
+const MinChunkDuration = 10 * time.Second
+
+// chunkableCodecs lists video encoders whose segments can be joined by
+// stream copy. Every segment starts with a keyframe, so these need no
+// state from the previous segment.
+var chunkableCodecs = []string{"libx264", "libx265", "libvpx-vp9", "libaom-av1", "libsvtav1"}
+
+// videoEncoder returns the video encoder a process request uses, or an empty
+// string when ffmpeg picks the container's default
+func videoEncoder(req ProcessRequest) string {
+	switch {
+	case req.HDR == HDRPassthrough:
+		return "libx265"
+	case req.Codec != "":
+		return req.Codec
+	case req.Format == "webm":
+		return "libvpx-vp9"
+	case req.Format == "mp4":
+		return "libx264"
+	}
+	return ""
+}
+
+// planChunks splits the processed part of the input at keyframes into at most
+// req.Chunks segments. It returns the segment boundaries in seconds, or the
+// reason chunked encoding is unsafe for this request.
+func planChunks(req ProcessRequest, output string, info MediaInfo, duration time.Duration) ([]float64, string) {
+	if req.StreamSelection.Active() {
+		return nil, "stream selection needs every stream in one pass"
+	}
+	if req.FrameRate != "" {
+		return nil, "frame rate conversion is not continuous across segments"
+	}
+	codec := videoEncoder(req)
+	if codec == "" {
+		return nil, "no video codec or format is set"
+	}
+	if !slices.Contains(chunkableCodecs, codec) {
+		return nil, fmt.Sprintf("%s segments cannot be joined by stream copy", codec)
+	}
+	ext := strings.ToLower(filepath.Ext(output))
+	if _, ok := containers[ext]; !ok {
+		return nil, fmt.Sprintf("segments cannot be joined into %s", ext)
+	}
+	if len(info.StreamsOfType(StreamVideo)) == 0 {
+		return nil, "the input has no video stream"
+	}
+	if len(info.StreamsOfType(StreamSubtitle)) > 0 {
+		return nil, "subtitle streams cannot be split into segments"
+	}
+	if duration < 2*MinChunkDuration {
+		return nil, fmt.Sprintf("the input is shorter than two %s segments", MinChunkDuration)
+	}
+
+	report, err := AnalyzeGOP(req.Input, false)
+	if err != nil {
+		return nil, fmt.Sprintf("keyframes could not be read: %v", err)
+	}
+
+	bounds := chunkBounds(report.Keyframes, req.Start, duration.Seconds(), req.Chunks)
+	if len(bounds) < 3 {
+		return nil, "the input has too few keyframes to split"
+	}
+	return bounds, ""
+}
+
+// chunkBounds returns segment boundaries for the window [start, start+length]:
+// the window edges plus the keyframes closest to an even split. Segments are
+// at least MinChunkDuration long.
+func chunkBounds(keyframes []float64, start, length float64, chunks int) []float64 {
+	end := start + length
+	minLength := MinChunkDuration.Seconds()
+	chunks = min(chunks, int(length/minLength))
+
+	bounds := []float64{start}
+	for i := 1; i < chunks; i++ {
+		ideal := start + length*float64(i)/float64(chunks)
+		last := bounds[len(bounds)-1]
+
+		best := -1.0
+		for _, k := range keyframes {
+			if k < last+minLength || k > end-minLength {
+				continue
+			}
+			if best < 0 || math.Abs(k-ideal) < math.Abs(best-ideal) {
+				best = k
+			}
+		}
+		if best >= 0 {
+			bounds = append(bounds, best)
+		}
+	}
+
+	return append(bounds, end)
+}
+
+// processChunked encodes each segment of the input as its own ffmpeg process
+// on EncodePool, encodes the audio once as a single stream, and joins the
+// results with the concat demuxer. Segments are cut at keyframes with input
+// seeking, so each one starts on a keyframe and timestamps stay continuous.
+// onProgress, if set, receives the share of the window encoded so far.
+func processChunked(req ProcessRequest, output string, info MediaInfo, bounds []float64, onProgress func(ProcessProgress)) (string, error) {
+	dir := "<chunks>"
+	if !req.DryRun {
+		tmp, err := os.MkdirTemp("", "chunks-*")
+		if err != nil {
+			return "", fmt.Errorf("failed to create chunk directory: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+
+	graph, err := buildVideoFilters(req, "0:v:0")
+	if err != nil {
+		return "", err
+	}
+	video, err := videoEncoderArgs(req)
+	if err != nil {
+		return "", err
+	}
+
+	var commands [][]string
+	var chunkFiles []string
+	for i := 0; i+1 < len(bounds); i++ {
+		chunk := filepath.Join(dir, fmt.Sprintf("chunk_%03d.mkv", i))
+		chunkFiles = append(chunkFiles, chunk)
+
+		args := []string{"-hide_banner", "-y", "-nostats"}
+		if bounds[i] > 0 {
+			args = append(args, "-ss", strconv.FormatFloat(bounds[i], 'f', 3, 64))
+		}
+		args = append(args, "-i", req.Input, "-progress", "pipe:1", "-t", strconv.FormatFloat(bounds[i+1]-bounds[i], 'f', 3, 64))
+		if graph.Empty() {
+			args = append(args, "-map", "0:v:0")
+		} else {
+			args = append(args, "-filter_complex", graph.String(), "-map", "[vout]")
+		}
+		args = append(args, video...)
+		commands = append(commands, append(args, "-an", chunk))
+	}
+
+	// Audio is encoded once over the whole window so it has no gaps at the joins
+	audio := ""
+	if len(info.StreamsOfType(StreamAudio)) > 0 {
+		audio = filepath.Join(dir, "audio.mka")
+		start, end := bounds[0], bounds[len(bounds)-1]
+
+		args := []string{"-hide_banner", "-y"}
+		if start > 0 {
+			args = append(args, "-ss", strconv.FormatFloat(start, 'f', 3, 64))
+		}
+		args = append(args, "-i", req.Input, "-t", strconv.FormatFloat(end-start, 'f', 3, 64))
+		commands = append(commands, append(args, "-map", "0:a:0", "-vn", "-c:a", audioEncoder(req), audio))
+	}
+
+	list := filepath.Join(dir, "chunks.txt")
+	concat := []string{"-hide_banner", "-y", "-f", "concat", "-safe", "0", "-i", list}
+	if audio != "" {
+		concat = append(concat, "-i", audio, "-map", "0:v", "-map", "1:a")
+	} else {
+		concat = append(concat, "-map", "0:v")
+	}
+	concat = append(concat, "-c", "copy")
+	if support := containers[strings.ToLower(filepath.Ext(output))]; support.Faststart {
+		// Apple players only accept HEVC in MP4/MOV with the hvc1 tag
+		if videoEncoder(req) == "libx265" {
+			concat = append(concat, "-tag:v", "hvc1")
+		}
+		concat = append(concat, "-movflags", "+faststart")
+	}
+	concat = append(concat, output)
+
+	var lines []string
+	for _, args := range append(commands, concat) {
+		lines = append(lines, fmt.Sprintf("ffmpeg %s", strings.Join(args, " ")))
+	}
+	cmdString := strings.Join(lines, "\n")
+	fmt.Printf("Executing %d segments:\n%s\n", len(chunkFiles), cmdString)
+
+	if req.DryRun {
+		fmt.Printf("[Dry Run] %s\n", cmdString)
+		return cmdString, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	// Progress is the video encoded by all segments against the whole window;
+	// the audio encode is short next to it and is not counted
+	progress := newChunkProgress(bounds, onProgress)
+	tasks := make([]func() error, len(commands))
+	for i, args := range commands {
+		if i < len(chunkFiles) {
+			tasks[i] = func() error {
+				return runSegment(args, func(encoded float64) { progress.update(i, encoded) })
+			}
+			continue
+		}
+		tasks[i] = func() error {
+			cmd := exec.Command("ffmpeg", args...)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("audio encode failed: %w\nOutput: %s", err, string(out))
+			}
+			return nil
+		}
+	}
+	if err := EncodePool.Run(tasks...); err != nil {
+		return "", err
+	}
+
+	// Entries are relative to the list, which sits next to the segments
+	var sb strings.Builder
+	for _, chunk := range chunkFiles {
+		fmt.Fprintf(&sb, "file '%s'\n", filepath.Base(chunk))
+	}
+	if err := os.WriteFile(list, []byte(sb.String()), 0644); err != nil {
+		return "", fmt.Errorf("failed to write segment list: %w", err)
+	}
+
+	cmd := exec.Command("ffmpeg", concat...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("segment concat failed: %w\nOutput: %s", err, string(out))
+	}
+
+	fmt.Printf("Processing complete: %s\n", output)
+	return output, nil
+}
+
+// runSegment runs a segment encode with -progress pipe:1, passing the
+// seconds encoded so far to onEncoded after each progress block
+func runSegment(args []string, onEncoded func(float64)) error {
+	cmd := exec.Command("ffmpeg", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	encoded := 0.0
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "out_time_us":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us > 0 {
+				encoded = float64(us) / 1e6
+			}
+		case "progress":
+			onEncoded(encoded)
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("segment encode failed: %w\nOutput: %s", err, tailLines(stderr.String(), 20))
+	}
+	return nil
+}
+
+// chunkProgress adds up the seconds encoded by the segments of a chunked
+// encode and reports them as a share of the whole window
+type chunkProgress struct {
+	mu           sync.Mutex
+	lengths      []float64 // Length of each segment in seconds
+	encoded      []float64 // Seconds encoded by each segment
+	total        float64
+	lastReported float64
+	onProgress   func(ProcessProgress)
+}
+
+// newChunkProgress creates a tracker for the segments between bounds
+func newChunkProgress(bounds []float64, onProgress func(ProcessProgress)) *chunkProgress {
+	p := &chunkProgress{
+		lengths:      make([]float64, len(bounds)-1),
+		encoded:      make([]float64, len(bounds)-1),
+		total:        bounds[len(bounds)-1] - bounds[0],
+		lastReported: -1,
+		onProgress:   onProgress,
+	}
+	for i := range p.lengths {
+		p.lengths[i] = bounds[i+1] - bounds[i]
+	}
+	return p
+}
+
+// update records the seconds encoded by a segment and reports every 1% change
+func (p *chunkProgress) update(segment int, encoded float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.encoded[segment] = min(encoded, p.lengths[segment])
+	done := 0.0
+	for _, seconds := range p.encoded {
+		done += seconds
+	}
+	percent := 0.0
+	if p.total > 0 {
+		percent = min(done/p.total*100, 100)
+	}
+	if percent < p.lastReported+1 && (percent < 100 || p.lastReported == 100) {
+		return
+	}
+
+	p.lastReported = percent
+	fmt.Printf("Progress: %.1f%% (%.1fs of %.1fs encoded)\n", percent, done, p.total)
+	if p.onProgress != nil {
+		p.onProgress(ProcessProgress{Stage: StageEncoding, Progress: percent})
+	}
+}
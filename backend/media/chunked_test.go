@@ -0,0 +1,176 @@
+package media
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChunkBounds(t *testing.T) {
+	// A keyframe every 2 seconds
+	var keyframes []float64
+	for k := 0.0; k <= 120; k += 2 {
+		keyframes = append(keyframes, k)
+	}
+
+	tests := []struct {
+		name      string
+		keyframes []float64
+		start     float64
+		length    float64
+		chunks    int
+		want      []float64
+	}{
+		{name: "even split on keyframes", keyframes: keyframes, length: 120, chunks: 4, want: []float64{0, 30, 60, 90, 120}},
+		{name: "closest keyframe to the split", keyframes: keyframes, length: 100, chunks: 3, want: []float64{0, 34, 66, 100}},
+		{name: "window inside the input", keyframes: keyframes, start: 21, length: 60, chunks: 2, want: []float64{21, 50, 81}},
+		{name: "chunks limited by the minimum length", keyframes: keyframes, length: 35, chunks: 8, want: []float64{0, 12, 24, 35}},
+		{
+			name:      "sparse keyframes give fewer segments",
+			keyframes: []float64{0, 5, 58, 119},
+			length:    120, chunks: 4,
+			want: []float64{0, 58, 120},
+		},
+		{
+			name:      "keyframes too close to the edges are skipped",
+			keyframes: []float64{0, 4, 116},
+			length:    120, chunks: 2,
+			want: []float64{0, 120},
+		},
+		{name: "no keyframes", length: 120, chunks: 4, want: []float64{0, 120}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunkBounds(tt.keyframes, tt.start, tt.length, tt.chunks)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("chunkBounds() = %v, want %v", got, tt.want)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i]-got[i-1] < MinChunkDuration.Seconds() {
+					t.Errorf("segment %d is %.1fs, shorter than %s", i, got[i]-got[i-1], MinChunkDuration)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanChunks(t *testing.T) {
+	video := Stream{Index: 0, Type: StreamVideo, Codec: "h264"}
+	audio := Stream{Index: 1, Type: StreamAudio, Codec: "aac"}
+	subtitle := Stream{Index: 2, Type: StreamSubtitle, Codec: "subrip"}
+	info := MediaInfo{Streams: []Stream{video, audio}}
+	base := ProcessRequest{Codec: "libx264", Chunks: 4}
+
+	// Packets with a keyframe every 2 seconds of a 2 minute input
+	var packets []string
+	for k := 0; k <= 120; k += 2 {
+		packets = append(packets, fmt.Sprintf(`{"stream_index": 0, "pts_time": "%d.000000", "size": "1000", "flags": "K__"}`, k))
+	}
+	keyframes := `{"packets": [` + strings.Join(packets, ",") + `]}`
+	oneKeyframe := `{"packets": [{"stream_index": 0, "pts_time": "0.000000", "size": "1000", "flags": "K__"}, {"stream_index": 0, "pts_time": "1.000000", "size": "10", "flags": "___"}]}`
+
+	tests := []struct {
+		name       string
+		req        ProcessRequest
+		output     string
+		info       MediaInfo
+		duration   time.Duration
+		probe      string
+		want       []float64
+		wantReason string
+	}{
+		{name: "split at keyframes", req: base, output: "out.mp4", info: info, duration: 2 * time.Minute, probe: keyframes, want: []float64{0, 30, 60, 90, 120}},
+		{name: "stream selection", req: ProcessRequest{Codec: "libx264", StreamSelection: StreamSelection{AllAudio: true}}, output: "out.mp4", info: info, duration: time.Minute, wantReason: "stream selection"},
+		{name: "frame rate conversion", req: ProcessRequest{Codec: "libx264", FrameRate: "30"}, output: "out.mp4", info: info, duration: time.Minute, wantReason: "frame rate conversion"},
+		{name: "no codec or format", req: ProcessRequest{}, output: "out.mkv", info: info, duration: time.Minute, wantReason: "no video codec or format is set"},
+		{name: "format picks the codec", req: ProcessRequest{Format: "webm", Chunks: 4}, output: "out.webm", info: info, duration: 2 * time.Minute, probe: keyframes, want: []float64{0, 30, 60, 90, 120}},
+		{name: "codec without keyframe segments", req: ProcessRequest{Codec: "mpeg2video"}, output: "out.ts", info: info, duration: time.Minute, wantReason: "mpeg2video segments cannot be joined by stream copy"},
+		{name: "unsupported container", req: base, output: "out.avi", info: info, duration: time.Minute, wantReason: "segments cannot be joined into .avi"},
+		{name: "no video", req: base, output: "out.mp4", info: MediaInfo{Streams: []Stream{audio}}, duration: time.Minute, wantReason: "the input has no video stream"},
+		{name: "subtitles", req: base, output: "out.mkv", info: MediaInfo{Streams: []Stream{video, subtitle}}, duration: time.Minute, wantReason: "subtitle streams cannot be split"},
+		{name: "too short", req: base, output: "out.mp4", info: info, duration: 19 * time.Second, wantReason: "shorter than two 10s segments"},
+		{name: "keyframes unreadable", req: base, output: "out.mp4", info: info, duration: time.Minute, probe: `{"packets": []}`, wantReason: "keyframes could not be read: no video packets found"},
+		{name: "too few keyframes", req: base, output: "out.mp4", info: info, duration: time.Minute, probe: oneKeyframe, wantReason: "the input has too few keyframes to split"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			req.Input = "input.mkv"
+			if tt.probe != "" {
+				req.Input = fakeFFprobe(t, tt.probe)
+			}
+
+			bounds, reason := planChunks(req, tt.output, tt.info, tt.duration)
+			if tt.wantReason != "" {
+				if !strings.Contains(reason, tt.wantReason) {
+					t.Fatalf("planChunks() reason = %q, want %q", reason, tt.wantReason)
+				}
+				return
+			}
+			if reason != "" || !reflect.DeepEqual(bounds, tt.want) {
+				t.Fatalf("planChunks() = %v, %q, want %v", bounds, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkProgress(t *testing.T) {
+	var reported []float64
+	progress := newChunkProgress([]float64{10, 40, 70, 110}, func(p ProcessProgress) {
+		reported = append(reported, p.Progress)
+	})
+
+	progress.update(1, 15)   // 15 of 100 seconds
+	progress.update(1, 15.5) // below the next whole percent
+	progress.update(0, 30)   // 45.5
+	progress.update(2, 40)   // 85.5
+	progress.update(1, 31)   // capped at the segment length: 100
+	progress.update(2, 40)   // already complete
+
+	want := []float64{15, 45.5, 85.5, 100}
+	if !reflect.DeepEqual(reported, want) {
+		t.Errorf("reported = %v, want %v", reported, want)
+	}
+}
+
+func TestProcessChunkedProgress(t *testing.T) {
+	// An ffmpeg that reports each segment fully encoded and writes its output
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"for last; do :; done\n" +
+		"echo out_time_us=-9223372036854775807\n" +
+		"echo progress=continue\n" +
+		"echo out_time_us=30000000\n" +
+		"echo progress=end\n" +
+		"touch \"$last\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var mu sync.Mutex
+	var last ProcessProgress
+	output := filepath.Join(dir, "out.mkv")
+	req := ProcessRequest{Input: "input.mkv", Codec: "libx264"}
+	info := MediaInfo{Streams: []Stream{{Type: StreamVideo}}}
+	if _, err := processChunked(req, output, info, []float64{0, 30, 60, 90}, func(p ProcessProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		last = p
+	}); err != nil {
+		t.Fatalf("processChunked() error = %v", err)
+	}
+	if last.Stage != StageEncoding || last.Progress != 100 {
+		t.Errorf("last progress = %+v, want 100%%", last)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("output not written: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package media
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProcessCommand returns the ffmpeg command a process request runs, built
+// without reading the input or printing anything. Options resolved from the
+// input (auto crop, trimming, HDR handling, stream selection, chunking and
+// image orientation) are left out, and codec copy maps every stream since
+// the remux plan depends on the input streams.
+func ProcessCommand(req ProcessRequest) (string, error) {
+	req.AutoCrop = false
+	req.TrimSilence, req.TrimBlack = false, false
+	req.HDR = ""
+	req.StreamSelection = StreamSelection{}
+	req.Chunks = 0
+
+	args, err := processCommandArgs(req)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("ffmpeg %s", strings.Join(args, " ")), nil
+}
+
+// processCommandArgs builds the argument list for ProcessCommand, following
+// the same dispatch as ProcessMediaWithProgress and ProcessMulti
+func processCommandArgs(req ProcessRequest) ([]string, error) {
+	if req.Start < 0 || req.Duration < 0 {
+		return nil, fmt.Errorf("start and duration must not be negative")
+	}
+
+	if len(req.Outputs) > 0 {
+		if req.Codec == CodecCopy {
+			return nil, fmt.Errorf("codec copy and stream selection are not supported with multiple outputs")
+		}
+		renditions, outputs, err := resolveRenditions(req)
+		if err != nil {
+			return nil, err
+		}
+		return buildMultiArgs(req, renditions, outputs)
+	}
+
+	output := req.OutputPath()
+	switch {
+	case req.Codec == CodecCopy:
+		if err := checkCopyOptions(req); err != nil {
+			return nil, err
+		}
+		return copyCommandArgs(req, output)
+
+	case isAnimationOutput(output) && (!IsImageFile(req.Input) || strings.EqualFold(filepath.Ext(req.Input), ".gif")):
+		fps, width, height, err := animationDefaults(&req)
+		if err != nil {
+			return nil, err
+		}
+		req.Width, req.Height = width, height
+		req.FrameRate = strconv.FormatFloat(fps, 'f', -1, 64)
+		return buildAnimationArgs(req, output)
+
+	case IsImageFile(req.Input) && isImageOutput(output):
+		return buildImageArgs(req, output, 0)
+	}
+
+	return buildProcessArgs(req, output, nil)
+}
+
+// copyCommandArgs builds a stream copy of every input stream into output
+func copyCommandArgs(req ProcessRequest, output string) ([]string, error) {
+	ext := strings.ToLower(filepath.Ext(output))
+	support, ok := containers[ext]
+	if !ok {
+		return nil, fmt.Errorf("unsupported container '%s' for remux", ext)
+	}
+
+	args := []string{"-hide_banner", "-y"}
+	if req.Start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(req.Start, 'f', 3, 64))
+	}
+	args = append(args, "-i", req.Input)
+	if req.Duration > 0 {
+		args = append(args, "-t", strconv.FormatFloat(req.Duration, 'f', 3, 64))
+	}
+	args = append(args, "-map", "0", "-c", "copy")
+	if support.Faststart {
+		args = append(args, "-movflags", "+faststart")
+	}
+	return append(args, output), nil
+}
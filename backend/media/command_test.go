@@ -0,0 +1,83 @@
+package media
+
+import "testing"
+
+func TestProcessCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ProcessRequest
+		want    string
+		wantErr string
+	}{
+		{
+			name: "single pass",
+			req:  ProcessRequest{Input: "input.mp4", Output: "out.mp4", Width: 1280, CRF: "23"},
+			want: "ffmpeg -hide_banner -y -i input.mp4 -progress pipe:1 -filter_complex " +
+				"[0:v:0]scale=w=trunc(iw*sar/2)*2:h=ih,setsar=1,scale=w=1280:h=-2,setsar=1[vout] " +
+				"-map [vout] -map 0:a:0? -crf 23 -c:a aac out.mp4",
+		},
+		{
+			name: "input-dependent options are left out",
+			req:  ProcessRequest{Input: "input.mp4", Output: "out.mkv", AutoCrop: true, TrimSilence: true, HDR: HDRPassthrough, Chunks: 4},
+			want: "ffmpeg -hide_banner -y -i input.mp4 -progress pipe:1 -c:a aac out.mkv",
+		},
+		{
+			name: "codec copy",
+			req:  ProcessRequest{Input: "input.mkv", Output: "out.mp4", Codec: CodecCopy, Start: 5},
+			want: "ffmpeg -hide_banner -y -ss 5.000 -i input.mkv -map 0 -c copy -movflags +faststart out.mp4",
+		},
+		{
+			name: "animation",
+			req:  ProcessRequest{Input: "input.mp4", Output: "out.gif"},
+			want: "ffmpeg -hide_banner -y -i input.mp4 -filter_complex [0:v:0]fps=fps=12,scale=w=trunc(iw*sar/2)*2:h=ih,setsar=1," +
+				"scale=w=trunc(min(480\\,iw)/2)*2:h=-2,setsar=1,split[frames][palette_src];" +
+				"[palette_src]palettegen=stats_mode=diff[palette];[frames][palette]paletteuse=dither=sierra2_4a:diff_mode=rectangle[vout] " +
+				"-map [vout] -an -c:v gif -loop 0 out.gif",
+		},
+		{
+			name: "image",
+			req:  ProcessRequest{Input: "input.png", Output: "out.jpg", Quality: 100},
+			want: "ffmpeg -hide_banner -y -noautorotate -i input.png -map 0:v:0 -frames:v 1 -c:v mjpeg -q:v 2 -update 1 out.jpg",
+		},
+		{
+			name: "multiple outputs",
+			req: ProcessRequest{Input: "input.mp4", Outputs: []OutputSpec{
+				{Output: "a.mp4", Height: 720},
+				{Output: "b.mp4", Height: 480},
+			}},
+			want: "ffmpeg -hide_banner -y -nostats -i input.mp4 -progress pipe:1 -filter_complex " +
+				"[0:v:0]split=2[split1][split2];" +
+				"[split1]scale=w=trunc(iw*sar/2)*2:h=ih,setsar=1,scale=w=-2:h=720,setsar=1[vout3];" +
+				"[split2]scale=w=trunc(iw*sar/2)*2:h=ih,setsar=1,scale=w=-2:h=480,setsar=1[vout4] " +
+				"-map [vout3] -map 0:a:0? -c:v libx264 -c:a aac a.mp4 -map [vout4] -map 0:a:0? -c:v libx264 -c:a aac b.mp4",
+		},
+		{
+			name:    "copy with resize",
+			req:     ProcessRequest{Input: "input.mp4", Codec: CodecCopy, Width: 640},
+			wantErr: "codec copy cannot be combined with resize",
+		},
+		{
+			name:    "copy into unknown container",
+			req:     ProcessRequest{Input: "input.mp4", Output: "out.flv", Codec: CodecCopy},
+			wantErr: "unsupported container '.flv'",
+		},
+		{
+			name:    "negative start",
+			req:     ProcessRequest{Input: "input.mp4", Start: -1},
+			wantErr: "must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ProcessCommand(tt.req)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("command = %q\nwant      %q", got, tt.want)
+			}
+		})
+	}
+}
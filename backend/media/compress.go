@@ -3,52 +3,89 @@ package media
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 )
 
+// Compression defaults
+const (
+	DefaultCompressCodec  = "libx264"
+	DefaultCompressPreset = "medium"
+)
+
+// CompressRequest represents a request to compress a video to a bitrate
+type CompressRequest struct {
+	Input   string `json:"input"`
+	Output  string `json:"output,omitempty"`
+	Bitrate string `json:"bitrate"`
+	Codec   string `json:"codec,omitempty"`  // Video encoder (default libx264)
+	Preset  string `json:"preset,omitempty"` // Encoder preset (default medium)
+}
+
 // CompressMedia compresses a video file using a user-defined bitrate
 func CompressMedia(inputPath, outputPath, bitrate string) error {
+	_, err := Compress(CompressRequest{Input: inputPath, Output: outputPath, Bitrate: bitrate})
+	return err
+}
+
+// OutputPath returns the file a compress request writes: the requested
+// output, or <name>_compressed next to the input
+func (req CompressRequest) OutputPath() string {
+	if req.Output != "" {
+		return req.Output
+	}
+	dir := filepath.Dir(req.Input)
+	filename := filepath.Base(req.Input)
+	ext := filepath.Ext(filename)
+	name := filename[:len(filename)-len(ext)]
+	return filepath.Join(dir, fmt.Sprintf("%s_compressed%s", name, ext))
+}
+
+// Encoders returns the ffmpeg encoders a compress request needs
+func (req CompressRequest) Encoders() []string {
+	return []string{codecOrDefault(req.Codec, DefaultCompressCodec)}
+}
+
+// Compress compresses a video file to the requested bitrate and returns the output path
+func Compress(req CompressRequest) (string, error) {
+	inputPath, bitrate := req.Input, req.Bitrate
+
+	// Bitrate control only applies to video; images are compressed by quality
+	if IsImageFile(inputPath) {
+		return "", fmt.Errorf("cannot compress image '%s' by bitrate: use process with a quality setting instead", filepath.Base(inputPath))
+	}
+
 	// Validate bitrate format
 	if !isValidBitrate(bitrate) {
-		return fmt.Errorf("invalid bitrate format '%s': must end with 'k' or 'M'", bitrate)
+		return "", fmt.Errorf("invalid bitrate format '%s': must end with 'k' or 'M'", bitrate)
 	}
 
 	// If output path is not provided, generate one based on input
-	if outputPath == "" {
-		dir := filepath.Dir(inputPath)
-		filename := filepath.Base(inputPath)
-		ext := filepath.Ext(filename)
-		name := filename[:len(filename)-len(ext)]
-		outputPath = filepath.Join(dir, fmt.Sprintf("%s_compressed%s", name, ext))
-	}
+	outputPath := req.OutputPath()
 
 	// Create directory for output file if it doesn't exist
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+		return "", fmt.Errorf("failed to create output directory: %w", err)
 	}
 
 	// Build the FFmpeg command
 	args := []string{
 		"-i", inputPath,
 		"-b:v", bitrate,
-		"-c:v", "libx264", // Use H.264 codec for compression
-		"-preset", "medium", // Default preset for compression efficiency
+		"-c:v", codecOrDefault(req.Codec, DefaultCompressCodec), // H.264 unless another codec is requested
+		"-preset", codecOrDefault(req.Preset, DefaultCompressPreset), // Default preset for compression efficiency
 		"-c:a", "copy", // Copy audio stream without re-encoding
 		outputPath,
 	}
 
-	// Execute the FFmpeg command
-	cmd := exec.Command("ffmpeg", args...)
-	output, err := cmd.CombinedOutput()
-
+	// Execute the FFmpeg command in a slot of the encode pool
+	output, err := runFFmpeg(args)
 	if err != nil {
-		return fmt.Errorf("compression failed: %w\nOutput: %s", err, string(output))
+		return "", fmt.Errorf("compression failed: %w\nOutput: %s", err, string(output))
 	}
 
 	fmt.Printf("Successfully compressed video to %s with bitrate %s\n", outputPath, bitrate)
-	return nil
+	return outputPath, nil
 }
 
 // isValidBitrate checks if the bitrate has the correct format
@@ -0,0 +1,188 @@
+package media
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// Crop detection defaults
+const (
+	DefaultCropSamples     = 5   // Number of sections sampled across the input
+	CropSampleDuration     = 2.0 // Seconds analysed per sampled section
+	MinCropConfidence      = 0.5 // Share of frames that must agree before auto_crop applies
+	cropDetectLimit        = "24"
+	cropDetectRoundingStep = "2"
+)
+
+// cropRegex matches cropdetect output such as crop=1920:800:0:140
+var cropRegex = regexp.MustCompile(`crop=(\d+):(\d+):(\d+):(\d+)`)
+
+// CropRect represents a crop rectangle in source pixels
+type CropRect struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	X      int `json:"x"`
+	Y      int `json:"y"`
+}
+
+// CropDetectResult represents the outcome of black-bar detection
+type CropDetectResult struct {
+	Filename     string   `json:"filename"`
+	Crop         CropRect `json:"crop"`
+	Confidence   float64  `json:"confidence"`
+	Samples      int      `json:"samples"`
+	Frames       int      `json:"frames"`
+	SourceWidth  int      `json:"source_width"`
+	SourceHeight int      `json:"source_height"`
+	NeedsCrop    bool     `json:"needs_crop"`
+}
+
+// String renders the crop rectangle as W:H:X:Y
+func (c CropRect) String() string {
+	return fmt.Sprintf("%d:%d:%d:%d", c.Width, c.Height, c.X, c.Y)
+}
+
+// DetectCrop runs cropdetect over evenly spaced sections of the input and
+// returns the most common crop rectangle together with its confidence
+func DetectCrop(path string, samples int) (CropDetectResult, error) {
+	result := CropDetectResult{Filename: path}
+
+	if samples <= 0 {
+		samples = DefaultCropSamples
+	}
+
+	info, err := GetMediaInfo(path)
+	if err != nil {
+		return result, fmt.Errorf("failed to get media info: %w", err)
+	}
+	if info.Resolution == "" {
+		return result, fmt.Errorf("no video stream found in %s", path)
+	}
+
+	// cropdetect sees frames after autorotation, so compare against the
+	// display size
+	result.SourceWidth, result.SourceHeight = displaySize(info)
+
+	// Sample sections between 10% and 90% of the file to skip intros and credits
+	duration := info.DurationSeconds
+	var offsets []float64
+	if duration <= CropSampleDuration*float64(samples) {
+		offsets = []float64{0}
+	} else {
+		for i := 0; i < samples; i++ {
+			offsets = append(offsets, duration*(0.1+0.8*float64(i)/float64(max(samples-1, 1))))
+		}
+	}
+
+	counts := make(map[CropRect]int)
+	for _, offset := range offsets {
+		output, err := runCropDetect(path, offset)
+		if err != nil {
+			return result, err
+		}
+		for rect, n := range parseCropDetect(output) {
+			counts[rect] += n
+		}
+	}
+	result.Samples = len(offsets)
+
+	var frames int
+	result.Crop, frames, result.Frames = mostFrequentCrop(counts)
+	if result.Frames == 0 {
+		return result, fmt.Errorf("cropdetect reported no frames for %s", path)
+	}
+
+	result.Confidence = float64(frames) / float64(result.Frames)
+	result.NeedsCrop = result.Crop.Width < result.SourceWidth || result.Crop.Height < result.SourceHeight
+
+	return result, nil
+}
+
+// mostFrequentCrop returns the crop reported for the most frames, the frames
+// that reported it and the total frames. Ties go to the larger rectangle,
+// then the one nearest the top left, so the choice does not depend on map
+// order.
+func mostFrequentCrop(counts map[CropRect]int) (CropRect, int, int) {
+	var best CropRect
+	bestFrames, total := 0, 0
+	for rect, n := range counts {
+		total += n
+		if n > bestFrames || (n == bestFrames && cropPreferred(rect, best)) {
+			best, bestFrames = rect, n
+		}
+	}
+	return best, bestFrames, total
+}
+
+// cropPreferred reports whether a should win a tie against b
+func cropPreferred(a, b CropRect) bool {
+	if areaA, areaB := a.Width*a.Height, b.Width*b.Height; areaA != areaB {
+		return areaA > areaB
+	}
+	if a.Y != b.Y {
+		return a.Y < b.Y
+	}
+	if a.X != b.X {
+		return a.X < b.X
+	}
+	return a.Width > b.Width
+}
+
+// displaySize returns the size of the main video stream as displayed, with
+// width and height swapped for 90 and 270 degree rotation
+func displaySize(info MediaInfo) (int, int) {
+	for _, stream := range info.StreamsOfType(StreamVideo) {
+		if stream.Width > 0 && stream.Height > 0 && !stream.HasDisposition("attached_pic") {
+			return rotatedSize(stream.Width, stream.Height, stream.Rotation)
+		}
+	}
+	return info.Width, info.Height
+}
+
+// rotatedSize swaps width and height for quarter turns
+func rotatedSize(width, height, rotation int) (int, int) {
+	if rotation = ((rotation % 360) + 360) % 360; rotation == 90 || rotation == 270 {
+		return height, width
+	}
+	return width, height
+}
+
+// runCropDetect runs cropdetect on a single section of the input
+func runCropDetect(path string, offset float64) (string, error) {
+	cmd := exec.Command("ffmpeg",
+		"-hide_banner",
+		"-ss", strconv.FormatFloat(offset, 'f', 3, 64),
+		"-i", path,
+		"-t", strconv.FormatFloat(CropSampleDuration, 'f', 3, 64),
+		"-vf", NewFilter("cropdetect").
+			Set("limit", cropDetectLimit).
+			Set("round", cropDetectRoundingStep).
+			Set("reset", "0").
+			String(),
+		"-an",
+		"-f", "null",
+		"-")
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("cropdetect failed: %w\nOutput: %s", err, string(output))
+	}
+	return string(output), nil
+}
+
+// parseCropDetect counts the crop rectangles reported in cropdetect output
+func parseCropDetect(output string) map[CropRect]int {
+	counts := make(map[CropRect]int)
+	for _, matches := range cropRegex.FindAllStringSubmatch(output, -1) {
+		w, _ := strconv.Atoi(matches[1])
+		h, _ := strconv.Atoi(matches[2])
+		x, _ := strconv.Atoi(matches[3])
+		y, _ := strconv.Atoi(matches[4])
+		if w > 0 && h > 0 {
+			counts[CropRect{Width: w, Height: h, X: x, Y: y}]++
+		}
+	}
+	return counts
+}
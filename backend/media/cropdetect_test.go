@@ -0,0 +1,89 @@
+package media
+
+import "testing"
+
+func TestParseCropDetect(t *testing.T) {
+	output := `[Parsed_cropdetect_0 @ 0x1] x1:0 x2:1919 y1:140 y2:939 w:1920 h:800 x:0 y:140 pts:1 t:0.04 crop=1920:800:0:140
+[Parsed_cropdetect_0 @ 0x1] x1:0 x2:1919 y1:140 y2:939 w:1920 h:800 x:0 y:140 pts:2 t:0.08 crop=1920:800:0:140
+[Parsed_cropdetect_0 @ 0x1] x1:0 x2:1919 y1:0 y2:1079 w:1920 h:1080 x:0 y:0 pts:3 t:0.12 crop=1920:1080:0:0
+[Parsed_cropdetect_0 @ 0x1] crop=0:0:0:0`
+
+	counts := parseCropDetect(output)
+	if len(counts) != 2 {
+		t.Fatalf("got %d rectangles, want 2: %v", len(counts), counts)
+	}
+	if n := counts[CropRect{Width: 1920, Height: 800, X: 0, Y: 140}]; n != 2 {
+		t.Errorf("1920:800:0:140 counted %d times, want 2", n)
+	}
+	if n := counts[CropRect{Width: 1920, Height: 1080}]; n != 1 {
+		t.Errorf("1920:1080:0:0 counted %d times, want 1", n)
+	}
+}
+
+func TestMostFrequentCrop(t *testing.T) {
+	letterbox := CropRect{Width: 1920, Height: 800, Y: 140}
+	full := CropRect{Width: 1920, Height: 1080}
+	shifted := CropRect{Width: 1920, Height: 800, Y: 142}
+	narrow := CropRect{Width: 1440, Height: 1080, X: 240}
+
+	tests := []struct {
+		name       string
+		counts     map[CropRect]int
+		want       CropRect
+		wantFrames int
+		wantTotal  int
+	}{
+		{"empty", map[CropRect]int{}, CropRect{}, 0, 0},
+		{"most frames", map[CropRect]int{letterbox: 40, full: 10}, letterbox, 40, 50},
+		{"tie goes to larger area", map[CropRect]int{letterbox: 10, full: 10}, full, 10, 20},
+		{"tie of equal area goes to the top", map[CropRect]int{shifted: 10, letterbox: 10}, letterbox, 10, 20},
+		{"tie of three", map[CropRect]int{narrow: 5, letterbox: 5, shifted: 5}, narrow, 5, 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Map order is random, so repeat to catch order dependence
+			for i := 0; i < 20; i++ {
+				crop, frames, total := mostFrequentCrop(tt.counts)
+				if crop != tt.want || frames != tt.wantFrames || total != tt.wantTotal {
+					t.Fatalf("mostFrequentCrop() = %v, %d, %d, want %v, %d, %d", crop, frames, total, tt.want, tt.wantFrames, tt.wantTotal)
+				}
+			}
+		})
+	}
+}
+
+func TestRotatedSize(t *testing.T) {
+	tests := []struct {
+		rotation      int
+		width, height int
+	}{
+		{0, 1920, 1080},
+		{90, 1080, 1920},
+		{-90, 1080, 1920},
+		{180, 1920, 1080},
+		{270, 1080, 1920},
+		{-270, 1080, 1920},
+		{450, 1080, 1920},
+	}
+
+	for _, tt := range tests {
+		if w, h := rotatedSize(1920, 1080, tt.rotation); w != tt.width || h != tt.height {
+			t.Errorf("rotatedSize(1920, 1080, %d) = %dx%d, want %dx%d", tt.rotation, w, h, tt.width, tt.height)
+		}
+	}
+}
+
+func TestDisplaySize(t *testing.T) {
+	info := MediaInfo{
+		Width:  1920,
+		Height: 1080,
+		Streams: []Stream{
+			{Type: StreamVideo, Width: 600, Height: 600, Disposition: []string{"attached_pic"}},
+			{Type: StreamVideo, Width: 1920, Height: 1080, Rotation: -90},
+		},
+	}
+	if w, h := displaySize(info); w != 1080 || h != 1920 {
+		t.Errorf("displaySize() = %dx%d, want 1080x1920", w, h)
+	}
+}
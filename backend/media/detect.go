@@ -0,0 +1,229 @@
+package media
+
+import (
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Silence and black detection defaults
+const (
+	DefaultNoiseLevel       = -50.0 // dB below which audio counts as silence
+	DefaultMinSilence       = 2.0   // Seconds of silence before an interval is reported
+	DefaultMinBlack         = 2.0   // Seconds of black before an interval is reported
+	DefaultPictureThreshold = 0.98  // Share of black pixels for a frame to count as black
+	DefaultPixelThreshold   = 0.10  // Luminance below which a pixel counts as black
+	DefaultMinTrimDuration  = 0.5   // Shortest leading/trailing interval removed by trimming
+
+	// edgeTolerance is how close (in seconds) an interval must be to the start
+	// or end of the file to count as leading or trailing
+	edgeTolerance = 0.1
+)
+
+// Regular expressions for parsing silencedetect and blackdetect output
+var (
+	silenceStartRegex = regexp.MustCompile(`silence_start:\s*(-?\d+\.?\d*)`)
+	silenceEndRegex   = regexp.MustCompile(`silence_end:\s*(-?\d+\.?\d*)`)
+	blackRegex        = regexp.MustCompile(`black_start:\s*(\d+\.?\d*)\s+black_end:\s*(\d+\.?\d*)`)
+)
+
+// Interval represents a time range in seconds
+type Interval struct {
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Duration float64 `json:"duration"`
+}
+
+// DetectRequest represents a request to detect silent and black segments
+type DetectRequest struct {
+	Input            string  `json:"input"`
+	Silence          bool    `json:"silence,omitempty"`           // Run silencedetect on the first audio stream
+	Black            bool    `json:"black,omitempty"`             // Run blackdetect on the first video stream
+	NoiseLevel       float64 `json:"noise_db,omitempty"`          // Silence threshold in dB (default -50)
+	MinSilence       float64 `json:"min_silence,omitempty"`       // Minimum silence length in seconds (default 2)
+	MinBlack         float64 `json:"min_black,omitempty"`         // Minimum black length in seconds (default 2)
+	PictureThreshold float64 `json:"picture_threshold,omitempty"` // Black pixel ratio for a black frame (default 0.98)
+	PixelThreshold   float64 `json:"pixel_threshold,omitempty"`   // Luminance threshold for a black pixel (default 0.10)
+}
+
+// DetectReport represents silent and black segments found in a file
+type DetectReport struct {
+	Filename      string     `json:"filename"`
+	Duration      float64    `json:"duration"`
+	Silences      []Interval `json:"silences,omitempty"`
+	BlackSegments []Interval `json:"black_segments,omitempty"`
+	Unavailable   []string   `json:"unavailable,omitempty"` // Checks skipped because the file lacks the stream: silence or black
+}
+
+// DetectSegments runs silencedetect and/or blackdetect on the input.
+// If neither is requested explicitly, both are run. A check is skipped and
+// listed as unavailable when the input has no stream for it.
+func DetectSegments(req DetectRequest) (DetectReport, error) {
+	report := DetectReport{Filename: req.Input}
+
+	if !req.Silence && !req.Black {
+		req.Silence, req.Black = true, true
+	}
+	applyDetectDefaults(&req)
+
+	info, err := GetMediaInfo(req.Input)
+	if err != nil {
+		return report, fmt.Errorf("failed to get media info: %w", err)
+	}
+	report.Duration = info.DurationSeconds
+
+	if req.Silence && len(info.StreamsOfType(StreamAudio)) == 0 {
+		report.Unavailable = append(report.Unavailable, "silence")
+		req.Silence = false
+	}
+	if req.Black && info.Resolution == "" {
+		report.Unavailable = append(report.Unavailable, "black")
+		req.Black = false
+	}
+
+	if req.Silence {
+		filter := NewFilter("silencedetect").
+			Set("noise", strconv.FormatFloat(req.NoiseLevel, 'f', -1, 64)+"dB").
+			Set("duration", strconv.FormatFloat(req.MinSilence, 'f', -1, 64))
+
+		output, err := runDetectFilter(req.Input, "-af", filter, "-vn")
+		if err != nil {
+			return report, fmt.Errorf("silence detection failed: %w", err)
+		}
+		report.Silences = parseSilenceDetect(output, report.Duration)
+	}
+
+	if req.Black {
+		filter := NewFilter("blackdetect").
+			Set("d", strconv.FormatFloat(req.MinBlack, 'f', -1, 64)).
+			Set("pic_th", strconv.FormatFloat(req.PictureThreshold, 'f', -1, 64)).
+			Set("pix_th", strconv.FormatFloat(req.PixelThreshold, 'f', -1, 64))
+
+		output, err := runDetectFilter(req.Input, "-vf", filter, "-an")
+		if err != nil {
+			return report, fmt.Errorf("black detection failed: %w", err)
+		}
+		report.BlackSegments = parseBlackDetect(output)
+	}
+
+	return report, nil
+}
+
+// applyDetectDefaults fills in default thresholds for unset fields
+func applyDetectDefaults(req *DetectRequest) {
+	if req.NoiseLevel == 0 {
+		req.NoiseLevel = DefaultNoiseLevel
+	}
+	if req.MinSilence <= 0 {
+		req.MinSilence = DefaultMinSilence
+	}
+	if req.MinBlack <= 0 {
+		req.MinBlack = DefaultMinBlack
+	}
+	if req.PictureThreshold <= 0 {
+		req.PictureThreshold = DefaultPictureThreshold
+	}
+	if req.PixelThreshold <= 0 {
+		req.PixelThreshold = DefaultPixelThreshold
+	}
+}
+
+// runDetectFilter decodes the input through a single detection filter
+func runDetectFilter(input, filterFlag string, filter *Filter, disableFlag string) (string, error) {
+	cmd := exec.Command("ffmpeg",
+		"-hide_banner",
+		"-i", input,
+		filterFlag, filter.String(),
+		disableFlag,
+		"-f", "null",
+		"-")
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%w\nOutput: %s", err, string(output))
+	}
+	return string(output), nil
+}
+
+// parseSilenceDetect extracts silent intervals; a silence still open at the
+// end of the output is closed at the file duration
+func parseSilenceDetect(output string, duration float64) []Interval {
+	var intervals []Interval
+	start := -1.0
+
+	for _, line := range strings.Split(output, "\n") {
+		if matches := silenceStartRegex.FindStringSubmatch(line); len(matches) > 1 {
+			if t, err := strconv.ParseFloat(matches[1], 64); err == nil {
+				start = math.Max(t, 0)
+			}
+			continue
+		}
+		if matches := silenceEndRegex.FindStringSubmatch(line); len(matches) > 1 && start >= 0 {
+			if t, err := strconv.ParseFloat(matches[1], 64); err == nil {
+				intervals = append(intervals, newInterval(start, t))
+			}
+			start = -1
+		}
+	}
+
+	if start >= 0 && duration > start {
+		intervals = append(intervals, newInterval(start, duration))
+	}
+
+	return intervals
+}
+
+// parseBlackDetect extracts black intervals
+func parseBlackDetect(output string) []Interval {
+	var intervals []Interval
+	for _, matches := range blackRegex.FindAllStringSubmatch(output, -1) {
+		start, err1 := strconv.ParseFloat(matches[1], 64)
+		end, err2 := strconv.ParseFloat(matches[2], 64)
+		if err1 == nil && err2 == nil {
+			intervals = append(intervals, newInterval(start, end))
+		}
+	}
+	return intervals
+}
+
+// newInterval creates an interval and computes its duration
+func newInterval(start, end float64) Interval {
+	return Interval{Start: start, End: end, Duration: end - start}
+}
+
+// trimWindow returns the start time and duration that remove leading and
+// trailing intervals. A zero duration means "until the end of the file".
+func trimWindow(report DetectReport, trimSilence, trimBlack bool) (float64, float64) {
+	var intervals []Interval
+	if trimSilence {
+		intervals = append(intervals, report.Silences...)
+	}
+	if trimBlack {
+		intervals = append(intervals, report.BlackSegments...)
+	}
+
+	start, end := 0.0, report.Duration
+	for _, interval := range intervals {
+		if interval.Duration < DefaultMinTrimDuration {
+			continue
+		}
+		if interval.Start <= edgeTolerance {
+			start = math.Max(start, interval.End)
+		}
+		if report.Duration > 0 && interval.End >= report.Duration-edgeTolerance {
+			end = math.Min(end, interval.Start)
+		}
+	}
+
+	// Nothing would be left, so keep the file as is
+	if end <= start {
+		return 0, 0
+	}
+	if end >= report.Duration {
+		return start, 0
+	}
+	return start, end - start
+}
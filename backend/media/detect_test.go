@@ -0,0 +1,75 @@
+package media
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseSilenceDetect(t *testing.T) {
+	output := `[silencedetect @ 0x1] silence_start: -0.01
+[silencedetect @ 0x1] silence_end: 2.5 | silence_duration: 2.51
+[silencedetect @ 0x1] silence_end: 3 | silence_duration: 1
+[silencedetect @ 0x1] silence_start: 57.1
+`
+	want := []Interval{
+		{Start: 0, End: 2.5, Duration: 2.5},
+		newInterval(57.1, 60),
+	}
+	if got := parseSilenceDetect(output, 60); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSilenceDetect() = %v, want %v", got, want)
+	}
+}
+
+func TestParseBlackDetect(t *testing.T) {
+	output := `[blackdetect @ 0x1] black_start:0 black_end:1.96 black_duration:1.96
+[blackdetect @ 0x1] black_start:30.5 black_end:33 black_duration:2.5`
+	want := []Interval{{Start: 0, End: 1.96, Duration: 1.96}, {Start: 30.5, End: 33, Duration: 2.5}}
+	if got := parseBlackDetect(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseBlackDetect() = %v, want %v", got, want)
+	}
+}
+
+func TestTrimWindow(t *testing.T) {
+	report := DetectReport{
+		Duration: 60,
+		Silences: []Interval{
+			newInterval(0, 2.5),
+			newInterval(20, 25),
+			newInterval(57.1, 60),
+		},
+		BlackSegments: []Interval{
+			newInterval(0.05, 4),
+			newInterval(59.8, 60),
+		},
+	}
+
+	tests := []struct {
+		name         string
+		report       DetectReport
+		silence      bool
+		black        bool
+		wantStart    float64
+		wantDuration float64
+	}{
+		{"silence", report, true, false, 2.5, 54.6},
+		{"black ignores short trailing interval", report, false, true, 4, 0},
+		{"both use the widest cut", report, true, true, 4, 53.1},
+		{"nothing requested", report, false, false, 0, 0},
+		{
+			"interval covering the file keeps it",
+			DetectReport{Duration: 10, Silences: []Interval{newInterval(0, 10)}},
+			true, false, 0, 0,
+		},
+		{"no detections", DetectReport{Duration: 10}, true, true, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, duration := trimWindow(tt.report, tt.silence, tt.black)
+			if math.Abs(start-tt.wantStart) > 1e-9 || math.Abs(duration-tt.wantDuration) > 1e-9 {
+				t.Errorf("trimWindow() = %v, %v, want %v, %v", start, duration, tt.wantStart, tt.wantDuration)
+			}
+		})
+	}
+}
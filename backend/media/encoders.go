@@ -0,0 +1,34 @@
+package media
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ListEncoders returns the names of the encoders the installed ffmpeg provides
+func ListEncoders() ([]string, error) {
+	output, err := exec.Command("ffmpeg", "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list encoders: %w", err)
+	}
+	return parseEncoders(string(output)), nil
+}
+
+// parseEncoders reads encoder names from ffmpeg -encoders output. Entries
+// follow a " ------" separator as "<flags> <name> <description>".
+func parseEncoders(output string) []string {
+	var encoders []string
+	listed := false
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if !listed {
+			listed = len(fields) == 1 && strings.HasPrefix(fields[0], "---")
+			continue
+		}
+		if len(fields) >= 2 {
+			encoders = append(encoders, fields[1])
+		}
+	}
+	return encoders
+}
@@ -0,0 +1,186 @@
+package media
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FilterOption is a single option passed to a filter. Options with an empty
+// Key are positional and rendered before the named ones.
+type FilterOption struct {
+	Key   string
+	Value string
+}
+
+// Filter represents a single FFmpeg filter such as scale or fps
+type Filter struct {
+	Name    string
+	Options []FilterOption
+}
+
+// FilterChain is a linear sequence of filters with labelled input and output pads
+type FilterChain struct {
+	Inputs  []string
+	Filters []*Filter
+	Outputs []string
+}
+
+// FilterGraph is a set of filter chains rendered as a -filter_complex argument
+type FilterGraph struct {
+	Chains []*FilterChain
+
+	labels int
+}
+
+// padLabelRegex matches valid pad labels, including stream specifiers like 0:v:0
+var padLabelRegex = regexp.MustCompile(`^[A-Za-z0-9_:.\-]+$`)
+
+// NewFilter creates a filter with optional positional arguments
+func NewFilter(name string, positional ...string) *Filter {
+	f := &Filter{Name: name}
+	for _, value := range positional {
+		f.Options = append(f.Options, FilterOption{Value: value})
+	}
+	return f
+}
+
+// Set adds a named option to the filter and returns the filter for chaining
+func (f *Filter) Set(key, value string) *Filter {
+	f.Options = append(f.Options, FilterOption{Key: key, Value: value})
+	return f
+}
+
+// String renders the filter as name=opt1:key=value with values escaped
+func (f *Filter) String() string {
+	if len(f.Options) == 0 {
+		return f.Name
+	}
+
+	parts := make([]string, 0, len(f.Options))
+	for _, opt := range f.Options {
+		if opt.Key == "" {
+			parts = append(parts, EscapeFilterValue(opt.Value))
+		}
+	}
+	for _, opt := range f.Options {
+		if opt.Key != "" {
+			parts = append(parts, opt.Key+"="+EscapeFilterValue(opt.Value))
+		}
+	}
+
+	return f.Name + "=" + strings.Join(parts, ":")
+}
+
+// NewFilterGraph creates an empty filter graph
+func NewFilterGraph() *FilterGraph {
+	return &FilterGraph{}
+}
+
+// Chain appends a new chain reading from the given input pads
+func (g *FilterGraph) Chain(inputs ...string) *FilterChain {
+	chain := &FilterChain{Inputs: inputs}
+	g.Chains = append(g.Chains, chain)
+	return chain
+}
+
+// NewLabel returns a pad label that is unique within the graph
+func (g *FilterGraph) NewLabel(prefix string) string {
+	g.labels++
+	return fmt.Sprintf("%s%d", prefix, g.labels)
+}
+
+// Empty reports whether the graph contains no filters
+func (g *FilterGraph) Empty() bool {
+	for _, chain := range g.Chains {
+		if len(chain.Filters) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks that all pad labels are well formed and every chain has filters
+func (g *FilterGraph) Validate() error {
+	for i, chain := range g.Chains {
+		if len(chain.Filters) == 0 {
+			return fmt.Errorf("filter chain %d has no filters", i)
+		}
+		for _, label := range append(append([]string{}, chain.Inputs...), chain.Outputs...) {
+			if !padLabelRegex.MatchString(label) {
+				return fmt.Errorf("invalid pad label '%s' in filter chain %d", label, i)
+			}
+		}
+		for _, filter := range chain.Filters {
+			if filter.Name == "" {
+				return fmt.Errorf("filter chain %d contains a filter without a name", i)
+			}
+		}
+	}
+	return nil
+}
+
+// String renders the graph in -filter_complex syntax
+func (g *FilterGraph) String() string {
+	chains := make([]string, 0, len(g.Chains))
+	for _, chain := range g.Chains {
+		if len(chain.Filters) > 0 {
+			chains = append(chains, chain.String())
+		}
+	}
+	return strings.Join(chains, ";")
+}
+
+// Add appends filters to the chain and returns the chain for chaining
+func (c *FilterChain) Add(filters ...*Filter) *FilterChain {
+	c.Filters = append(c.Filters, filters...)
+	return c
+}
+
+// Output sets the output pad labels of the chain
+func (c *FilterChain) Output(labels ...string) *FilterChain {
+	c.Outputs = labels
+	return c
+}
+
+// String renders the chain as [in]filter1,filter2[out]
+func (c *FilterChain) String() string {
+	var sb strings.Builder
+	for _, label := range c.Inputs {
+		sb.WriteString("[" + label + "]")
+	}
+
+	filters := make([]string, 0, len(c.Filters))
+	for _, f := range c.Filters {
+		filters = append(filters, f.String())
+	}
+	sb.WriteString(strings.Join(filters, ","))
+
+	for _, label := range c.Outputs {
+		sb.WriteString("[" + label + "]")
+	}
+	return sb.String()
+}
+
+// EscapeFilterValue escapes a filter option value for use inside a filter graph.
+// FFmpeg parses graphs in two levels: option values first (where ' \ : are
+// special) and then the graph description (where ' \ [ ] , ; are special).
+func EscapeFilterValue(value string) string {
+	return escapeChars(escapeChars(value, `\':`), `\'[],;`)
+}
+
+// escapeChars prefixes each occurrence of the given characters with a backslash
+func escapeChars(value, special string) string {
+	if !strings.ContainsAny(value, special) {
+		return value
+	}
+
+	var sb strings.Builder
+	for _, r := range value {
+		if strings.ContainsRune(special, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
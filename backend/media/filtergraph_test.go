@@ -0,0 +1,176 @@
+package media
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEscapeFilterValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"1280", "1280"},
+		{"trunc(iw/2)*2", "trunc(iw/2)*2"},
+		{"a:b", `a\\:b`},
+		{"a,b", `a\,b`},
+		{"a;b", `a\;b`},
+		{"[x]", `\[x\]`},
+		{"it's", `it\\\'s`},
+		{`C:\fonts`, `C\\:\\\\fonts`},
+	}
+
+	for _, tt := range tests {
+		if got := EscapeFilterValue(tt.value); got != tt.want {
+			t.Errorf("EscapeFilterValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFilterString(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter *Filter
+		want   string
+	}{
+		{"no options", NewFilter("null"), "null"},
+		{"positional", NewFilter("setsar", "1"), "setsar=1"},
+		{"named", NewFilter("scale").Set("w", "1280").Set("h", "-2"), "scale=w=1280:h=-2"},
+		{"positional and named", NewFilter("crop", "100").Set("h", "50"), "crop=100:h=50"},
+		{
+			"positional rendered first",
+			&Filter{Name: "f", Options: []FilterOption{{Key: "k", Value: "v"}, {Value: "p"}}},
+			"f=p:k=v",
+		},
+		{"escaped value", NewFilter("drawtext").Set("text", "a:b"), `drawtext=text=a\\:b`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterGraphString(t *testing.T) {
+	graph := NewFilterGraph()
+	graph.Chain("0:v").
+		Add(NewFilter("scale").Set("w", "1280").Set("h", "720"), NewFilter("fps").Set("fps", "30")).
+		Output("v1")
+	graph.Chain("v1").Output("unused")
+	graph.Chain("v1").Add(NewFilter("split", "2")).Output("a", "b")
+
+	want := "[0:v]scale=w=1280:h=720,fps=fps=30[v1];[v1]split=2[a][b]"
+	if got := graph.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if graph.Empty() {
+		t.Error("Empty() = true for a graph with filters")
+	}
+}
+
+func TestFilterGraphNewLabel(t *testing.T) {
+	graph := NewFilterGraph()
+	if first, second := graph.NewLabel("v"), graph.NewLabel("v"); first != "v1" || second != "v2" {
+		t.Errorf("NewLabel() = %q, %q, want v1, v2", first, second)
+	}
+}
+
+func TestFilterGraphValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func(g *FilterGraph)
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			build: func(g *FilterGraph) { g.Chain("0:v:0").Add(NewFilter("null")).Output("v_out-1.a") },
+		},
+		{
+			name:    "chain without filters",
+			build:   func(g *FilterGraph) { g.Chain("0:v") },
+			wantErr: "has no filters",
+		},
+		{
+			name:    "label with space",
+			build:   func(g *FilterGraph) { g.Chain("0:v").Add(NewFilter("null")).Output("v out") },
+			wantErr: "invalid pad label 'v out'",
+		},
+		{
+			name:    "label with bracket",
+			build:   func(g *FilterGraph) { g.Chain("0:v]").Add(NewFilter("null")) },
+			wantErr: "invalid pad label",
+		},
+		{
+			name:    "empty label",
+			build:   func(g *FilterGraph) { g.Chain("").Add(NewFilter("null")) },
+			wantErr: "invalid pad label",
+		},
+		{
+			name:    "filter without name",
+			build:   func(g *FilterGraph) { g.Chain("0:v").Add(&Filter{}) },
+			wantErr: "without a name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph := NewFilterGraph()
+			tt.build(graph)
+			checkError(t, graph.Validate(), tt.wantErr)
+		})
+	}
+}
+
+func TestBuildVideoFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ProcessRequest
+		want    string
+		wantErr string
+	}{
+		{name: "no filters", req: ProcessRequest{}, want: ""},
+		{
+			name: "frame rate and pixel format",
+			req:  ProcessRequest{FrameRate: "30000/1001", PixelFormat: "yuv420p"},
+			want: "[0:v]fps=fps=30000/1001,format=pix_fmts=yuv420p[vout]",
+		},
+		{
+			name: "crop before scale",
+			req:  ProcessRequest{Crop: &CropRect{Width: 1920, Height: 800, X: 0, Y: 140}, Width: 1280, ResizeMode: ResizeStretch},
+			want: "[0:v]crop=w=1920:h=800:x=0:y=140," +
+				"scale=w=trunc(iw*sar/2)*2:h=ih,setsar=1,scale=w=1280:h=-2,setsar=1[vout]",
+		},
+		{name: "invalid frame rate", req: ProcessRequest{FrameRate: "fast"}, wantErr: "invalid frame rate"},
+		{name: "invalid crop", req: ProcessRequest{Crop: &CropRect{Width: 0, Height: 10}}, wantErr: "invalid crop rectangle"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph, err := buildVideoFilters(tt.req, "0:v")
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			if got := graph.String(); got != tt.want {
+				t.Errorf("graph = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// checkError fails the test unless err contains want, or is nil when want
+// is empty
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case want != "" && err == nil:
+		t.Fatalf("expected an error containing %q", want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Fatalf("error = %q, want it to contain %q", err, want)
+	}
+}
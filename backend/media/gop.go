@@ -0,0 +1,252 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GOPStats summarises the distance between keyframes
+type GOPStats struct {
+	Count      int     `json:"count"`
+	MinFrames  int     `json:"min_frames"`
+	MaxFrames  int     `json:"max_frames"`
+	AvgFrames  float64 `json:"avg_frames"`
+	MinSeconds float64 `json:"min_seconds"`
+	MaxSeconds float64 `json:"max_seconds"`
+	AvgSeconds float64 `json:"avg_seconds"`
+}
+
+// BitratePoint is the bitrate of one second of the stream
+type BitratePoint struct {
+	Second    int   `json:"second"`
+	Bitrate   int64 `json:"bitrate"` // Bits per second
+	Keyframes int   `json:"keyframes,omitempty"`
+}
+
+// GOPReport represents keyframe, GOP and bitrate analysis of a video stream
+type GOPReport struct {
+	Filename    string         `json:"filename"`
+	StreamIndex int            `json:"stream_index"`
+	Packets     int            `json:"packets"`
+	Duration    float64        `json:"duration"`
+	Keyframes   []float64      `json:"keyframes"`
+	GOP         GOPStats       `json:"gop"`
+	FrameTypes  map[string]int `json:"frame_types,omitempty"` // Counts of I, P and B frames
+	AvgBitrate  int64          `json:"avg_bitrate"`
+	PeakBitrate int64          `json:"peak_bitrate"`
+	Bitrate     []BitratePoint `json:"bitrate"`
+}
+
+// maxBitrateBuckets caps the per-second bitrate series, so a bogus timestamp
+// far in the future cannot make it allocate without bound
+const maxBitrateBuckets = 24 * 60 * 60
+
+// ffprobePacket is a raw packet entry printed by ffprobe -show_packets
+type ffprobePacket struct {
+	StreamIndex int    `json:"stream_index"`
+	PtsTime     string `json:"pts_time"`
+	DtsTime     string `json:"dts_time"`
+	Size        string `json:"size"`
+	Flags       string `json:"flags"`
+}
+
+// gopPacket is a packet reduced to the fields used by the analysis
+type gopPacket struct {
+	Time     float64
+	Size     int64
+	Keyframe bool
+}
+
+// AnalyzeGOP runs packet analysis on the first video stream and, if
+// frameTypes is set, decodes it to count I, P and B frames
+func AnalyzeGOP(path string, frameTypes bool) (GOPReport, error) {
+	report := GOPReport{Filename: path, StreamIndex: -1}
+
+	cmd := exec.Command("ffprobe",
+		"-v", "quiet",
+		"-print_format", "json",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=stream_index,pts_time,dts_time,size,flags",
+		path)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return report, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var probe struct {
+		Packets []ffprobePacket `json:"packets"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return report, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	if len(probe.Packets) == 0 {
+		return report, fmt.Errorf("no video packets found in %s", path)
+	}
+
+	packets := parsePackets(probe.Packets)
+	if len(packets) == 0 {
+		return report, fmt.Errorf("no video packets with timestamps found in %s", path)
+	}
+	report.StreamIndex = probe.Packets[0].StreamIndex
+	report.Packets = len(packets)
+
+	analyzePackets(&report, packets)
+
+	if frameTypes {
+		counts, err := countFrameTypes(path)
+		if err != nil {
+			return report, err
+		}
+		report.FrameTypes = counts
+	}
+
+	return report, nil
+}
+
+// parsePackets converts raw packets, using the decode time when there is no
+// presentation time. Packets with neither are skipped rather than counted at 0.
+func parsePackets(raw []ffprobePacket) []gopPacket {
+	packets := make([]gopPacket, 0, len(raw))
+	for _, p := range raw {
+		t, err := strconv.ParseFloat(p.PtsTime, 64)
+		if err != nil {
+			if t, err = strconv.ParseFloat(p.DtsTime, 64); err != nil {
+				continue
+			}
+		}
+		packets = append(packets, gopPacket{
+			Time:     t,
+			Size:     parseIntOrZero(p.Size),
+			Keyframe: strings.Contains(p.Flags, "K"),
+		})
+	}
+	return packets
+}
+
+// analyzePackets fills keyframes, GOP statistics and the bitrate series
+func analyzePackets(report *GOPReport, packets []gopPacket) {
+	start, end := math.Inf(1), math.Inf(-1)
+	for _, p := range packets {
+		start = math.Min(start, p.Time)
+		end = math.Max(end, p.Time)
+	}
+	report.Duration = end - start
+
+	// GOP lengths in frames follow decode order; keyframe times are sorted
+	var gopFrames []int
+	frames := 0
+	var totalBits int64
+	buckets := make([]BitratePoint, min(int(report.Duration)+1, maxBitrateBuckets))
+	for i := range buckets {
+		buckets[i].Second = i
+	}
+
+	for _, p := range packets {
+		if p.Keyframe {
+			if len(report.Keyframes) > 0 {
+				gopFrames = append(gopFrames, frames)
+			}
+			report.Keyframes = append(report.Keyframes, p.Time-start)
+			frames = 0
+		}
+		frames++
+
+		if second := int(p.Time - start); second < len(buckets) {
+			buckets[second].Bitrate += p.Size * 8
+			if p.Keyframe {
+				buckets[second].Keyframes++
+			}
+		}
+		totalBits += p.Size * 8
+	}
+	if len(report.Keyframes) > 0 {
+		gopFrames = append(gopFrames, frames)
+	}
+	sort.Float64s(report.Keyframes)
+
+	report.GOP = gopStats(gopFrames, report.Keyframes, report.Duration)
+
+	report.Bitrate = buckets
+	for _, b := range buckets {
+		report.PeakBitrate = max(report.PeakBitrate, b.Bitrate)
+	}
+	if report.Duration > 0 {
+		report.AvgBitrate = int64(float64(totalBits) / report.Duration)
+	}
+}
+
+// gopStats computes GOP length statistics in frames and seconds
+func gopStats(gopFrames []int, keyframes []float64, duration float64) GOPStats {
+	stats := GOPStats{Count: len(gopFrames)}
+	if len(gopFrames) == 0 {
+		return stats
+	}
+
+	total := 0
+	stats.MinFrames = gopFrames[0]
+	for _, n := range gopFrames {
+		stats.MinFrames = min(stats.MinFrames, n)
+		stats.MaxFrames = max(stats.MaxFrames, n)
+		total += n
+	}
+	stats.AvgFrames = float64(total) / float64(len(gopFrames))
+
+	// The last GOP runs from the last keyframe to the end of the stream
+	var spans []float64
+	for i, t := range keyframes {
+		next := duration
+		if i+1 < len(keyframes) {
+			next = keyframes[i+1]
+		}
+		spans = append(spans, next-t)
+	}
+
+	sum := 0.0
+	stats.MinSeconds = spans[0]
+	for _, s := range spans {
+		stats.MinSeconds = math.Min(stats.MinSeconds, s)
+		stats.MaxSeconds = math.Max(stats.MaxSeconds, s)
+		sum += s
+	}
+	stats.AvgSeconds = sum / float64(len(spans))
+
+	return stats
+}
+
+// countFrameTypes decodes the first video stream and counts picture types
+func countFrameTypes(path string) (map[string]int, error) {
+	cmd := exec.Command("ffprobe",
+		"-v", "quiet",
+		"-print_format", "json",
+		"-select_streams", "v:0",
+		"-show_entries", "frame=pict_type",
+		path)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe frame analysis failed: %w", err)
+	}
+
+	var probe struct {
+		Frames []struct {
+			PictType string `json:"pict_type"`
+		} `json:"frames"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	counts := make(map[string]int)
+	for _, frame := range probe.Frames {
+		if frame.PictType != "" {
+			counts[frame.PictType]++
+		}
+	}
+	return counts, nil
+}
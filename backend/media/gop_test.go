@@ -0,0 +1,71 @@
+package media
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePackets(t *testing.T) {
+	raw := []ffprobePacket{
+		{PtsTime: "0.000000", Size: "1000", Flags: "K__"},
+		{PtsTime: "N/A", DtsTime: "0.040000", Size: "200", Flags: "___"},
+		{PtsTime: "N/A", DtsTime: "N/A", Size: "300", Flags: "___"},
+		{Size: "400", Flags: "K__"},
+	}
+	want := []gopPacket{{Time: 0, Size: 1000, Keyframe: true}, {Time: 0.04, Size: 200}}
+	if got := parsePackets(raw); !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePackets() = %v, want %v", got, want)
+	}
+}
+
+func TestAnalyzePackets(t *testing.T) {
+	packets := []gopPacket{
+		{Time: 10, Size: 1000, Keyframe: true},
+		{Time: 10.5, Size: 500},
+		{Time: 11, Size: 250},
+		{Time: 11.5, Size: 1000, Keyframe: true},
+		{Time: 12, Size: 250},
+	}
+
+	var report GOPReport
+	analyzePackets(&report, packets)
+
+	if report.Duration != 2 {
+		t.Errorf("Duration = %v, want 2", report.Duration)
+	}
+	if want := []float64{0, 1.5}; !reflect.DeepEqual(report.Keyframes, want) {
+		t.Errorf("Keyframes = %v, want %v", report.Keyframes, want)
+	}
+	wantGOP := GOPStats{Count: 2, MinFrames: 2, MaxFrames: 3, AvgFrames: 2.5, MinSeconds: 0.5, MaxSeconds: 1.5, AvgSeconds: 1}
+	if report.GOP != wantGOP {
+		t.Errorf("GOP = %+v, want %+v", report.GOP, wantGOP)
+	}
+	wantBitrate := []BitratePoint{
+		{Second: 0, Bitrate: 12000, Keyframes: 1},
+		{Second: 1, Bitrate: 10000, Keyframes: 1},
+		{Second: 2, Bitrate: 2000},
+	}
+	if !reflect.DeepEqual(report.Bitrate, wantBitrate) {
+		t.Errorf("Bitrate = %v, want %v", report.Bitrate, wantBitrate)
+	}
+	if report.PeakBitrate != 12000 || report.AvgBitrate != 12000 {
+		t.Errorf("PeakBitrate, AvgBitrate = %d, %d, want 12000, 12000", report.PeakBitrate, report.AvgBitrate)
+	}
+}
+
+func TestAnalyzePacketsCapsBuckets(t *testing.T) {
+	packets := []gopPacket{
+		{Time: 0, Size: 100, Keyframe: true},
+		{Time: 1e12, Size: 100},
+	}
+
+	var report GOPReport
+	analyzePackets(&report, packets)
+
+	if len(report.Bitrate) != maxBitrateBuckets {
+		t.Errorf("got %d buckets, want %d", len(report.Bitrate), maxBitrateBuckets)
+	}
+	if report.Bitrate[0].Bitrate != 800 {
+		t.Errorf("first bucket = %d bits, want 800", report.Bitrate[0].Bitrate)
+	}
+}
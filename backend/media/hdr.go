@@ -0,0 +1,207 @@
+package media
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// HDR types reported in HDRInfo.Type
+const (
+	HDRTypeHDR10       = "HDR10"
+	HDRTypeHDR10Plus   = "HDR10+"
+	HDRTypeHLG         = "HLG"
+	HDRTypeDolbyVision = "Dolby Vision"
+)
+
+// HDR handling modes supported by ProcessRequest.HDR
+const (
+	HDRToneMap     = "tonemap"     // Convert to SDR BT.709
+	HDRPassthrough = "passthrough" // Keep HDR and its metadata (libx265 only)
+)
+
+// DefaultToneMap is the tone mapping curve used when none is given
+const DefaultToneMap = "hable"
+
+// toneMapAlgorithms lists the curves supported by the tonemap filter
+var toneMapAlgorithms = []string{"hable", "mobius", "reinhard", "clip", "linear", "gamma"}
+
+// Color transfer characteristics that indicate HDR content
+const (
+	transferPQ  = "smpte2084"
+	transferHLG = "arib-std-b67"
+)
+
+// HDRInfo describes the HDR format and static metadata of a video stream
+type HDRInfo struct {
+	Type              string             `json:"type"`
+	MasteringDisplay  *MasteringDisplay  `json:"mastering_display,omitempty"`
+	ContentLightLevel *ContentLightLevel `json:"content_light_level,omitempty"`
+}
+
+// MasteringDisplay holds SMPTE ST 2086 mastering display color volume.
+// Chromaticities are CIE 1931 xy coordinates, luminance is in cd/m².
+type MasteringDisplay struct {
+	RedX         float64 `json:"red_x"`
+	RedY         float64 `json:"red_y"`
+	GreenX       float64 `json:"green_x"`
+	GreenY       float64 `json:"green_y"`
+	BlueX        float64 `json:"blue_x"`
+	BlueY        float64 `json:"blue_y"`
+	WhitePointX  float64 `json:"white_point_x"`
+	WhitePointY  float64 `json:"white_point_y"`
+	MinLuminance float64 `json:"min_luminance"`
+	MaxLuminance float64 `json:"max_luminance"`
+}
+
+// ContentLightLevel holds the CTA-861.3 content light levels in cd/m²
+type ContentLightLevel struct {
+	MaxCLL  int `json:"max_cll"`
+	MaxFALL int `json:"max_fall"`
+}
+
+// isHDRTransfer reports whether a color transfer is PQ or HLG
+func isHDRTransfer(transfer string) bool {
+	return transfer == transferPQ || transfer == transferHLG
+}
+
+// detectHDR builds HDR information for a video stream. Static metadata is
+// read from the stream side data and, when missing there (e.g. HEVC with
+// in-band SEI), from the side data of its first decoded frames.
+func detectHDR(raw ffprobeStream, frameSideData []ffprobeSideData) *HDRInfo {
+	if !isHDRTransfer(raw.ColorTransfer) {
+		return nil
+	}
+
+	hdr := &HDRInfo{Type: HDRTypeHDR10}
+	if raw.ColorTransfer == transferHLG {
+		hdr.Type = HDRTypeHLG
+	}
+
+	applyHDRSideData(hdr, raw.SideDataList)
+	if hdr.MasteringDisplay == nil || hdr.ContentLightLevel == nil {
+		applyHDRSideData(hdr, frameSideData)
+	}
+
+	return hdr
+}
+
+// applyHDRSideData fills HDR information from ffprobe side data entries
+func applyHDRSideData(hdr *HDRInfo, sideData []ffprobeSideData) {
+	for _, sd := range sideData {
+		switch {
+		case sd.SideDataType == "Mastering display metadata" && hdr.MasteringDisplay == nil:
+			hdr.MasteringDisplay = &MasteringDisplay{
+				RedX:         rationalValue(sd.RedX),
+				RedY:         rationalValue(sd.RedY),
+				GreenX:       rationalValue(sd.GreenX),
+				GreenY:       rationalValue(sd.GreenY),
+				BlueX:        rationalValue(sd.BlueX),
+				BlueY:        rationalValue(sd.BlueY),
+				WhitePointX:  rationalValue(sd.WhitePointX),
+				WhitePointY:  rationalValue(sd.WhitePointY),
+				MinLuminance: rationalValue(sd.MinLuminance),
+				MaxLuminance: rationalValue(sd.MaxLuminance),
+			}
+		case sd.SideDataType == "Content light level metadata" && hdr.ContentLightLevel == nil:
+			hdr.ContentLightLevel = &ContentLightLevel{MaxCLL: sd.MaxContent, MaxFALL: sd.MaxAverage}
+		case sd.SideDataType == "DOVI configuration record":
+			hdr.Type = HDRTypeDolbyVision
+		case strings.Contains(sd.SideDataType, "HDR10+") && hdr.Type == HDRTypeHDR10:
+			hdr.Type = HDRTypeHDR10Plus
+		}
+	}
+}
+
+// toneMapFilters converts HDR (PQ or HLG) video to SDR BT.709 using zscale
+// for linearisation and primaries conversion and tonemap for the curve
+func toneMapFilters(algorithm string) ([]*Filter, error) {
+	if algorithm == "" {
+		algorithm = DefaultToneMap
+	}
+	if !slices.Contains(toneMapAlgorithms, algorithm) {
+		return nil, fmt.Errorf("invalid tone mapping '%s': must be one of %s", algorithm, strings.Join(toneMapAlgorithms, ", "))
+	}
+
+	return []*Filter{
+		NewFilter("zscale").Set("t", "linear").Set("npl", "100"),
+		NewFilter("format").Set("pix_fmts", "gbrpf32le"),
+		NewFilter("zscale").Set("p", "bt709"),
+		NewFilter("tonemap").Set("tonemap", algorithm).Set("desat", "0"),
+		NewFilter("zscale").Set("t", "bt709").Set("m", "bt709").Set("r", "tv"),
+		NewFilter("format").Set("pix_fmts", "yuv420p"),
+	}, nil
+}
+
+// checkPassthroughContainer rejects outputs whose container cannot hold the
+// HEVC stream that HDR passthrough encodes, such as WebM
+func checkPassthroughContainer(req ProcessRequest) error {
+	exts := []string{strings.ToLower(filepath.Ext(req.OutputPath()))}
+	if req.Format != "" {
+		exts = append(exts, "."+strings.ToLower(req.Format))
+	}
+	for _, ext := range exts {
+		if support, ok := containers[ext]; ok && !accepts(support.Video, "hevc") {
+			return fmt.Errorf("HDR passthrough encodes HEVC, which %s cannot hold: use mp4, mov, mkv or ts", strings.TrimPrefix(ext, "."))
+		}
+	}
+	return nil
+}
+
+// hdrPassthroughArgs returns libx265 output options that signal the HDR
+// format and carry its static metadata into the encoded stream. The caller
+// is responsible for choosing a 10-bit pixel format.
+func hdrPassthroughArgs(hdr *HDRInfo) []string {
+	transfer := transferPQ
+	if hdr.Type == HDRTypeHLG {
+		transfer = transferHLG
+	}
+
+	params := []string{
+		"repeat-headers=1",
+		"colorprim=bt2020",
+		"transfer=" + transfer,
+		"colormatrix=bt2020nc",
+	}
+	if transfer == transferPQ {
+		params = append(params, "hdr10=1", "hdr10-opt=1")
+	}
+	if md := hdr.MasteringDisplay; md != nil {
+		params = append(params, "master-display="+md.X265String())
+	}
+	if cll := hdr.ContentLightLevel; cll != nil {
+		params = append(params, fmt.Sprintf("max-cll=%d,%d", cll.MaxCLL, cll.MaxFALL))
+	}
+
+	return []string{
+		"-color_primaries", "bt2020",
+		"-color_trc", transfer,
+		"-colorspace", "bt2020nc",
+		"-x265-params", strings.Join(params, ":"),
+	}
+}
+
+// X265String renders the mastering display in x265's master-display syntax,
+// where chromaticities are in 0.00002 units and luminance in 0.0001 cd/m²
+func (md MasteringDisplay) X265String() string {
+	c := func(v float64) int64 { return int64(math.Round(v * 50000)) }
+	l := func(v float64) int64 { return int64(math.Round(v * 10000)) }
+
+	return fmt.Sprintf("G(%d,%d)B(%d,%d)R(%d,%d)WP(%d,%d)L(%d,%d)",
+		c(md.GreenX), c(md.GreenY),
+		c(md.BlueX), c(md.BlueY),
+		c(md.RedX), c(md.RedY),
+		c(md.WhitePointX), c(md.WhitePointY),
+		l(md.MaxLuminance), l(md.MinLuminance))
+}
+
+// rationalValue parses an ffprobe rational string and returns its value
+func rationalValue(value string) float64 {
+	r, err := ParseRational(value)
+	if err != nil {
+		return 0
+	}
+	return r.Float64()
+}
@@ -0,0 +1,127 @@
+package media
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectHDR(t *testing.T) {
+	mastering := ffprobeSideData{
+		SideDataType: "Mastering display metadata",
+		RedX:         "34000/50000", RedY: "16000/50000",
+		GreenX: "13250/50000", GreenY: "34500/50000",
+		BlueX: "7500/50000", BlueY: "3000/50000",
+		WhitePointX: "15635/50000", WhitePointY: "16450/50000",
+		MinLuminance: "1/10000", MaxLuminance: "10000000/10000",
+	}
+	lightLevel := ffprobeSideData{SideDataType: "Content light level metadata", MaxContent: 1000, MaxAverage: 400}
+	display := &MasteringDisplay{RedX: 0.68, RedY: 0.32, GreenX: 0.265, GreenY: 0.69, BlueX: 0.15, BlueY: 0.06, WhitePointX: 0.3127, WhitePointY: 0.329, MinLuminance: 0.0001, MaxLuminance: 1000}
+	level := &ContentLightLevel{MaxCLL: 1000, MaxFALL: 400}
+
+	tests := []struct {
+		name   string
+		stream ffprobeStream
+		frames []ffprobeSideData
+		want   *HDRInfo
+	}{
+		{name: "SDR", stream: ffprobeStream{ColorTransfer: "bt709"}, frames: []ffprobeSideData{lightLevel}},
+		{name: "HLG", stream: ffprobeStream{ColorTransfer: transferHLG}, want: &HDRInfo{Type: HDRTypeHLG}},
+		{
+			name:   "metadata in the container",
+			stream: ffprobeStream{ColorTransfer: transferPQ, SideDataList: []ffprobeSideData{mastering, lightLevel}},
+			frames: []ffprobeSideData{{SideDataType: "Content light level metadata", MaxContent: 1, MaxAverage: 1}},
+			want:   &HDRInfo{Type: HDRTypeHDR10, MasteringDisplay: display, ContentLightLevel: level},
+		},
+		{
+			name:   "metadata in the frames",
+			stream: ffprobeStream{ColorTransfer: transferPQ},
+			frames: []ffprobeSideData{mastering, lightLevel, {SideDataType: "HDR Dynamic Metadata SMPTE2094-40 (HDR10+)"}},
+			want:   &HDRInfo{Type: HDRTypeHDR10Plus, MasteringDisplay: display, ContentLightLevel: level},
+		},
+		{
+			name:   "Dolby Vision",
+			stream: ffprobeStream{ColorTransfer: transferPQ, SideDataList: []ffprobeSideData{{SideDataType: "DOVI configuration record"}}},
+			want:   &HDRInfo{Type: HDRTypeDolbyVision},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectHDR(tt.stream, tt.frames); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectHDR() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrameSideData(t *testing.T) {
+	probe := ffprobeOutput{Frames: []ffprobeFrame{
+		{StreamIndex: 1, SideDataList: []ffprobeSideData{{SideDataType: "audio"}}},
+		{StreamIndex: 0, SideDataList: []ffprobeSideData{{SideDataType: "first"}}},
+		{StreamIndex: 0, SideDataList: []ffprobeSideData{{SideDataType: "second"}}},
+	}}
+	want := []ffprobeSideData{{SideDataType: "first"}, {SideDataType: "second"}}
+	if got := probe.frameSideData(0); !reflect.DeepEqual(got, want) {
+		t.Errorf("frameSideData(0) = %+v, want %+v", got, want)
+	}
+}
+
+func TestCheckPassthroughContainer(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ProcessRequest
+		wantErr string
+	}{
+		{name: "mp4 output", req: ProcessRequest{Input: "in.mkv", Output: "out.mp4"}},
+		{name: "mkv output", req: ProcessRequest{Input: "in.mkv", Output: "out.mkv"}},
+		{name: "default output", req: ProcessRequest{Input: "in.mov"}},
+		{name: "webm output", req: ProcessRequest{Input: "in.mkv", Output: "out.WEBM"}, wantErr: "webm cannot hold"},
+		{name: "webm format", req: ProcessRequest{Input: "in.mkv", Format: "webm"}, wantErr: "webm cannot hold"},
+		{name: "webm format with mkv name", req: ProcessRequest{Input: "in.mkv", Output: "out.mkv", Format: "webm"}, wantErr: "webm cannot hold"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkError(t, checkPassthroughContainer(tt.req), tt.wantErr)
+		})
+	}
+}
+
+func TestVideoEncoderArgsPassthrough(t *testing.T) {
+	hdr := &HDRInfo{
+		Type:              HDRTypeHDR10,
+		MasteringDisplay:  &MasteringDisplay{RedX: 0.68, RedY: 0.32, GreenX: 0.265, GreenY: 0.69, BlueX: 0.15, BlueY: 0.06, WhitePointX: 0.3127, WhitePointY: 0.329, MaxLuminance: 1000, MinLuminance: 0.0001},
+		ContentLightLevel: &ContentLightLevel{MaxCLL: 1000, MaxFALL: 400},
+	}
+
+	args, err := videoEncoderArgs(ProcessRequest{Input: "in.mkv", Output: "out.mp4", HDR: HDRPassthrough, HDRMetadata: hdr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "-c:v libx265 -pix_fmt yuv420p10le -color_primaries bt2020 -color_trc smpte2084 -colorspace bt2020nc " +
+		"-x265-params repeat-headers=1:colorprim=bt2020:transfer=smpte2084:colormatrix=bt2020nc:hdr10=1:hdr10-opt=1:" +
+		"master-display=G(13250,34500)B(7500,3000)R(34000,16000)WP(15635,16450)L(10000000,1):max-cll=1000,400"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("args = %q\nwant   %q", got, want)
+	}
+
+	_, err = videoEncoderArgs(ProcessRequest{Input: "in.mkv", Output: "out.mp4", HDR: HDRPassthrough, HDRMetadata: hdr, Codec: "libx264"})
+	checkError(t, err, "requires libx265")
+
+	_, err = videoEncoderArgs(ProcessRequest{Input: "in.mkv", Format: "webm", HDR: HDRPassthrough, HDRMetadata: hdr})
+	checkError(t, err, "webm cannot hold")
+}
+
+func TestToneMapFilters(t *testing.T) {
+	filters, err := toneMapFilters("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filters[3].String(); got != "tonemap=tonemap="+DefaultToneMap+":desat=0" {
+		t.Errorf("tonemap filter = %q", got)
+	}
+
+	_, err = toneMapFilters("magic")
+	checkError(t, err, "invalid tone mapping 'magic'")
+}
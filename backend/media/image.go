@@ -0,0 +1,398 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Default image quality on the 1-100 scale used by ProcessRequest.Quality
+const (
+	DefaultJPEGQuality = 85
+	DefaultWebPQuality = 80
+	DefaultAVIFQuality = 60
+)
+
+// imageExtensions lists file extensions handled by the image pipeline
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".webp": true,
+	".avif": true,
+	".gif":  true,
+	".bmp":  true,
+	".tif":  true,
+	".tiff": true,
+}
+
+// imageOutputExtensions lists image formats the pipeline can write
+var imageOutputExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".webp": true,
+	".avif": true,
+	".gif":  true,
+}
+
+// ImageInfo holds image-specific information reported by GetMediaInfo
+type ImageInfo struct {
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ColorType   string `json:"color_type"` // gray, gray-alpha, palette, rgb, rgba, yuv, yuva
+	HasAlpha    bool   `json:"has_alpha"`
+	BitDepth    int    `json:"bit_depth"`
+	Orientation int    `json:"orientation,omitempty"` // EXIF orientation (1-8)
+}
+
+// IsImageFile reports whether a path has an image file extension
+func IsImageFile(path string) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// isImageOutput reports whether a path is an image format the pipeline writes
+func isImageOutput(path string) bool {
+	return imageOutputExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// newImageInfo builds image information from the first video stream
+func newImageInfo(path string, stream Stream) *ImageInfo {
+	colorType, hasAlpha := pixelFormatColorType(stream.PixelFormat)
+
+	image := &ImageInfo{
+		Width:     stream.Width,
+		Height:    stream.Height,
+		ColorType: colorType,
+		HasAlpha:  hasAlpha,
+		BitDepth:  stream.BitDepth,
+	}
+	if orientation, err := probeImageOrientation(path); err == nil && orientation > 1 {
+		image.Orientation = orientation
+	}
+	return image
+}
+
+// pixelFormatColorType classifies a pixel format by color model and alpha
+func pixelFormatColorType(pixFmt string) (string, bool) {
+	switch {
+	case strings.HasPrefix(pixFmt, "ya"):
+		return "gray-alpha", true
+	case strings.HasPrefix(pixFmt, "gray"):
+		return "gray", false
+	case pixFmt == "pal8":
+		return "palette", false
+	case strings.HasPrefix(pixFmt, "yuva"):
+		return "yuva", true
+	case strings.HasPrefix(pixFmt, "yuv"), strings.HasPrefix(pixFmt, "nv"):
+		return "yuv", false
+	case strings.HasPrefix(pixFmt, "rgba"), strings.HasPrefix(pixFmt, "bgra"),
+		strings.HasPrefix(pixFmt, "argb"), strings.HasPrefix(pixFmt, "abgr"),
+		strings.HasPrefix(pixFmt, "gbrap"):
+		return "rgba", true
+	default:
+		return "rgb", false
+	}
+}
+
+// probeImageOrientation reads the EXIF orientation exported by the decoder
+func probeImageOrientation(path string) (int, error) {
+	cmd := exec.Command("ffprobe",
+		"-v", "quiet",
+		"-print_format", "json",
+		"-select_streams", "v:0",
+		"-read_intervals", "%+#1",
+		"-show_entries", "frame_tags=Orientation",
+		path)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var frames struct {
+		Frames []struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"frames"`
+	}
+	if err := json.Unmarshal(output, &frames); err != nil {
+		return 0, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	for _, frame := range frames.Frames {
+		if orientation, err := strconv.Atoi(frame.Tags["Orientation"]); err == nil {
+			return orientation, nil
+		}
+	}
+	return 1, nil
+}
+
+// orientationFilters returns the filters that apply an EXIF orientation
+func orientationFilters(orientation int) []*Filter {
+	switch orientation {
+	case 2:
+		return []*Filter{NewFilter("hflip")}
+	case 3:
+		return []*Filter{NewFilter("hflip"), NewFilter("vflip")}
+	case 4:
+		return []*Filter{NewFilter("vflip")}
+	case 5:
+		return []*Filter{NewFilter("transpose").Set("dir", "cclock_flip")}
+	case 6:
+		return []*Filter{NewFilter("transpose").Set("dir", "clock")}
+	case 7:
+		return []*Filter{NewFilter("transpose").Set("dir", "clock_flip")}
+	case 8:
+		return []*Filter{NewFilter("transpose").Set("dir", "cclock")}
+	default:
+		return nil
+	}
+}
+
+// processImage converts a still image, applying orientation, crop, resize,
+// quality and metadata options. It is used by ProcessMedia for image inputs.
+func processImage(req ProcessRequest, output string) (string, error) {
+	// EXIF orientation is applied explicitly, so it also affects dry runs
+	orientation, err := probeImageOrientation(req.Input)
+	if err != nil && !req.DryRun {
+		return "", fmt.Errorf("failed to read image orientation: %w", err)
+	}
+
+	args, err := buildImageArgs(req, output, orientation)
+	if err != nil {
+		return "", err
+	}
+
+	cmdString := fmt.Sprintf("ffmpeg %s", strings.Join(args, " "))
+	fmt.Printf("Executing: %s\n", cmdString)
+
+	if req.DryRun {
+		fmt.Printf("[Dry Run] %s\n", cmdString)
+		return cmdString, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	if out, err := runFFmpeg(args); err != nil {
+		return "", fmt.Errorf("image processing failed: %w\nOutput: %s", err, string(out))
+	}
+
+	fmt.Printf("Processing complete: %s\n", output)
+	return output, nil
+}
+
+// buildImageArgs builds the ffmpeg argument list for an image conversion
+func buildImageArgs(req ProcessRequest, output string, orientation int) ([]string, error) {
+	if req.Quality < 0 || req.Quality > 100 {
+		return nil, fmt.Errorf("invalid quality %d: must be between 1 and 100, or 0 for the format default", req.Quality)
+	}
+
+	args := []string{
+		"-hide_banner",
+		"-y",
+		"-noautorotate", // Orientation is applied by the filter graph below
+		"-i", req.Input,
+	}
+
+	graph := NewFilterGraph()
+	chain := graph.Chain("0:v:0").Output("vout")
+	chain.Add(orientationFilters(orientation)...)
+
+	crop, err := cropFilters(req)
+	if err != nil {
+		return nil, err
+	}
+	chain.Add(crop...)
+
+	resize, err := imageResizeFilters(req)
+	if err != nil {
+		return nil, err
+	}
+	chain.Add(resize...)
+
+	if req.PixelFormat != "" {
+		chain.Add(NewFilter("format").Set("pix_fmts", req.PixelFormat))
+	}
+
+	if graph.Empty() {
+		args = append(args, "-map", "0:v:0")
+	} else {
+		if err := graph.Validate(); err != nil {
+			return nil, err
+		}
+		args = append(args, "-filter_complex", graph.String(), "-map", "[vout]")
+	}
+
+	ext := strings.ToLower(filepath.Ext(output))
+	if ext != ".gif" {
+		// Still formats hold a single picture
+		args = append(args, "-frames:v", "1")
+	}
+
+	encoderArgs, err := imageEncoderArgs(req, ext)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, encoderArgs...)
+
+	if req.StripMetadata {
+		args = append(args, "-map_metadata", "-1", "-fflags", "+bitexact", "-flags:v", "+bitexact")
+	}
+
+	if ext == ".jpg" || ext == ".jpeg" || ext == ".png" {
+		// Write a single file rather than an image sequence
+		args = append(args, "-update", "1")
+	}
+
+	return append(args, output), nil
+}
+
+// imageResizeFilters builds the filters that resize a still image. Unlike
+// video, images keep odd sizes and are assumed to have square pixels.
+func imageResizeFilters(req ProcessRequest) ([]*Filter, error) {
+	width, height, err := requestedSize(req)
+	if err != nil {
+		return nil, err
+	}
+	if width == 0 && height == 0 {
+		return nil, nil
+	}
+
+	mode, err := resizeMode(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only one dimension given: keep aspect ratio
+	if width == 0 || height == 0 {
+		w, h := "-1", "-1"
+		if width > 0 {
+			w = imageDimension(width, "iw", req.NoUpscale)
+		}
+		if height > 0 {
+			h = imageDimension(height, "ih", req.NoUpscale)
+		}
+		return []*Filter{NewFilter("scale").Set("w", w).Set("h", h)}, nil
+	}
+
+	boxW := imageDimension(width, "iw", req.NoUpscale)
+	boxH := imageDimension(height, "ih", req.NoUpscale)
+
+	switch mode {
+	case ResizeStretch:
+		return []*Filter{NewFilter("scale").Set("w", boxW).Set("h", boxH)}, nil
+
+	case ResizeFill:
+		crop := NewFilter("crop").
+			Set("w", imageDimension(width, "iw", true)).
+			Set("h", imageDimension(height, "ih", true))
+		if req.NoUpscale {
+			// Keep the box's shape when a smaller source is not enlarged
+			cropW, cropH := aspectCrop(width, height)
+			crop = NewFilter("crop").Set("w", cropW).Set("h", cropH)
+		}
+		return []*Filter{
+			NewFilter("scale").Set("w", boxW).Set("h", boxH).Set("force_original_aspect_ratio", "increase"),
+			crop,
+		}, nil
+	}
+
+	padColor := req.PadColor
+	if padColor == "" {
+		padColor = DefaultPadColor
+	}
+	return []*Filter{
+		NewFilter("scale").Set("w", boxW).Set("h", boxH).Set("force_original_aspect_ratio", "decrease"),
+		NewFilter("pad").
+			Set("w", strconv.Itoa(width)).
+			Set("h", strconv.Itoa(height)).
+			Set("x", "(ow-iw)/2").
+			Set("y", "(oh-ih)/2").
+			Set("color", padColor),
+	}, nil
+}
+
+// imageDimension returns a scale expression for size, optionally capped by
+// the input dimension
+func imageDimension(size int, input string, noUpscale bool) string {
+	if !noUpscale {
+		return strconv.Itoa(size)
+	}
+	return fmt.Sprintf("min(%d,%s)", size, input)
+}
+
+// imageEncoderArgs returns codec and quality options for an image format
+func imageEncoderArgs(req ProcessRequest, ext string) ([]string, error) {
+	quality := req.Quality
+
+	switch ext {
+	case ".jpg", ".jpeg":
+		if req.Lossless {
+			return nil, fmt.Errorf("lossless encoding is not supported for JPEG")
+		}
+		if quality == 0 {
+			quality = DefaultJPEGQuality
+		}
+		// mjpeg uses a 2 (best) to 31 (worst) quantizer scale. It always
+		// writes optimal Huffman tables, so optimize has nothing to add.
+		return []string{"-c:v", codecOrDefault(req.Codec, "mjpeg"), "-q:v", strconv.Itoa(scaleQuality(quality, 31, 2))}, nil
+
+	case ".png":
+		// PNG is always lossless; optimisation only spends more time compressing
+		args := []string{"-c:v", codecOrDefault(req.Codec, "png")}
+		if req.Optimize {
+			args = append(args, "-compression_level", "9", "-pred", "mixed")
+		}
+		return args, nil
+
+	case ".webp":
+		args := []string{"-c:v", codecOrDefault(req.Codec, "libwebp")}
+		if req.Lossless {
+			args = append(args, "-lossless", "1")
+		}
+		if quality == 0 {
+			quality = DefaultWebPQuality
+		}
+		args = append(args, "-quality", strconv.Itoa(quality))
+		if req.Optimize {
+			args = append(args, "-compression_level", "6")
+		}
+		return args, nil
+
+	case ".avif":
+		args := []string{"-c:v", codecOrDefault(req.Codec, "libaom-av1"), "-still-picture", "1", "-b:v", "0"}
+		if req.Lossless {
+			return append(args, "-crf", "0", "-aom-params", "lossless=1"), nil
+		}
+		if quality == 0 {
+			quality = DefaultAVIFQuality
+		}
+		return append(args, "-crf", strconv.Itoa(scaleQuality(quality, 63, 0))), nil
+
+	case ".gif":
+		return []string{"-c:v", codecOrDefault(req.Codec, "gif")}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported image format '%s'", ext)
+}
+
+// scaleQuality maps a 1-100 quality to an encoder scale where worst is the
+// value for quality 1 and best the value for quality 100
+func scaleQuality(quality, worst, best int) int {
+	return int(math.Round(float64(worst) + float64(best-worst)*float64(quality-1)/99))
+}
+
+// codecOrDefault returns the requested codec or the format default
+func codecOrDefault(codec, fallback string) string {
+	if codec != "" {
+		return codec
+	}
+	return fallback
+}
@@ -0,0 +1,104 @@
+package media
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildImageArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ProcessRequest
+		output  string
+		orient  int
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "odd size is kept",
+			req:    ProcessRequest{Input: "in.jpg", Resolution: "1001x667", ResizeMode: ResizeStretch},
+			output: "out.jpg",
+			want:   "-hide_banner -y -noautorotate -i in.jpg -filter_complex [0:v:0]scale=w=1001:h=667[vout] -map [vout] -frames:v 1 -c:v mjpeg -q:v 6 -update 1 out.jpg",
+		},
+		{
+			name:   "width only",
+			req:    ProcessRequest{Input: "in.png", Width: 333, NoUpscale: true},
+			output: "out.webp",
+			want:   "-hide_banner -y -noautorotate -i in.png -filter_complex [0:v:0]scale=w=min(333\\,iw):h=-1[vout] -map [vout] -frames:v 1 -c:v libwebp -quality 80 out.webp",
+		},
+		{
+			name:   "fit pads to the exact box",
+			req:    ProcessRequest{Input: "in.jpg", Width: 501, Height: 501},
+			output: "out.png",
+			want: "-hide_banner -y -noautorotate -i in.jpg -filter_complex [0:v:0]scale=w=501:h=501:force_original_aspect_ratio=decrease," +
+				"pad=w=501:h=501:x=(ow-iw)/2:y=(oh-ih)/2:color=black[vout] -map [vout] -frames:v 1 -c:v png -update 1 out.png",
+		},
+		{
+			name:   "orientation and fill",
+			req:    ProcessRequest{Input: "in.jpg", Width: 301, Height: 201, ResizeMode: ResizeFill, Quality: 100},
+			output: "out.jpg",
+			orient: 6,
+			want: "-hide_banner -y -noautorotate -i in.jpg -filter_complex [0:v:0]transpose=dir=clock," +
+				"scale=w=301:h=201:force_original_aspect_ratio=increase,crop=w=min(301\\,iw):h=min(201\\,ih)[vout] " +
+				"-map [vout] -frames:v 1 -c:v mjpeg -q:v 2 -update 1 out.jpg",
+		},
+		{
+			name:   "fill without upscaling keeps the box shape",
+			req:    ProcessRequest{Input: "in.png", Width: 400, Height: 300, ResizeMode: ResizeFill, NoUpscale: true},
+			output: "out.png",
+			want: "-hide_banner -y -noautorotate -i in.png -filter_complex [0:v:0]" +
+				"scale=w=min(400\\,iw):h=min(300\\,ih):force_original_aspect_ratio=increase,crop=w=min(iw\\,ih*400/300):h=min(ih\\,iw*300/400)[vout] " +
+				"-map [vout] -frames:v 1 -c:v png -update 1 out.png",
+		},
+		{
+			name:   "no filters",
+			req:    ProcessRequest{Input: "in.png", StripMetadata: true},
+			output: "out.avif",
+			want:   "-hide_banner -y -noautorotate -i in.png -map 0:v:0 -frames:v 1 -c:v libaom-av1 -still-picture 1 -b:v 0 -crf 25 -map_metadata -1 -fflags +bitexact -flags:v +bitexact out.avif",
+		},
+		{name: "quality too high", req: ProcessRequest{Input: "in.jpg", Quality: 101}, output: "out.jpg", wantErr: "between 1 and 100"},
+		{name: "negative quality", req: ProcessRequest{Input: "in.jpg", Quality: -1}, output: "out.jpg", wantErr: "between 1 and 100"},
+		{name: "lossless JPEG", req: ProcessRequest{Input: "in.png", Lossless: true}, output: "out.jpg", wantErr: "not supported for JPEG"},
+		{name: "unknown format", req: ProcessRequest{Input: "in.png"}, output: "out.bmp", wantErr: "unsupported image format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := buildImageArgs(tt.req, tt.output, tt.orient)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			if got := strings.Join(args, " "); got != tt.want {
+				t.Errorf("args = %q\nwant   %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageEncoderArgsOptimize(t *testing.T) {
+	jpeg, _ := imageEncoderArgs(ProcessRequest{Optimize: true}, ".jpg")
+	plain, _ := imageEncoderArgs(ProcessRequest{}, ".jpg")
+	if strings.Join(jpeg, " ") != strings.Join(plain, " ") {
+		t.Errorf("optimize changed JPEG args: %v", jpeg)
+	}
+
+	png, _ := imageEncoderArgs(ProcessRequest{Optimize: true}, ".png")
+	if got := strings.Join(png, " "); got != "-c:v png -compression_level 9 -pred mixed" {
+		t.Errorf("optimized PNG args = %q", got)
+	}
+}
+
+func TestScaleQuality(t *testing.T) {
+	tests := []struct{ quality, worst, best, want int }{
+		{1, 31, 2, 31},
+		{100, 31, 2, 2},
+		{85, 31, 2, 6},
+		{60, 63, 0, 25},
+	}
+	for _, tt := range tests {
+		if got := scaleQuality(tt.quality, tt.worst, tt.best); got != tt.want {
+			t.Errorf("scaleQuality(%d, %d, %d) = %d, want %d", tt.quality, tt.worst, tt.best, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package media
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EditRequest represents a request to edit metadata and chapters. Streams
+// are copied, so edits never re-encode.
+type EditRequest struct {
+	Input         string            `json:"input"`
+	Output        string            `json:"output,omitempty"`         // Defaults to edited_<name>; may equal input to edit in place
+	Metadata      map[string]string `json:"metadata,omitempty"`       // Tags to set, e.g. title, artist, comment, creation_time; an empty value removes the tag
+	ClearMetadata bool              `json:"clear_metadata,omitempty"` // Remove all container metadata before applying Metadata
+	CopyFrom      string            `json:"copy_from,omitempty"`      // File whose container metadata is copied before applying Metadata
+	Chapters      []Chapter         `json:"chapters,omitempty"`       // Replace chapters with this list
+	ChaptersFile  string            `json:"chapters_file,omitempty"`  // Replace chapters with those in an FFmetadata file
+	ClearChapters bool              `json:"clear_chapters,omitempty"` // Remove all chapters
+	DryRun        bool              `json:"dry_run,omitempty"`
+}
+
+// EditResult represents the result of a metadata edit
+type EditResult struct {
+	Filename string            `json:"filename"`
+	Output   string            `json:"output"`
+	Command  string            `json:"command"`
+	Tags     map[string]string `json:"tags,omitempty"`     // Container tags after the edit
+	Chapters []Chapter         `json:"chapters,omitempty"` // Chapters after the edit
+	DryRun   bool              `json:"dry_run,omitempty"`
+}
+
+// EditMetadata rewrites a file's container metadata and chapters with all
+// streams copied. Editing in place writes a temporary file that replaces the input.
+func EditMetadata(req EditRequest) (EditResult, error) {
+	result := EditResult{Filename: req.Input, DryRun: req.DryRun}
+
+	if err := validateEditRequest(req); err != nil {
+		return result, err
+	}
+
+	output := req.Output
+	if output == "" {
+		output = "edited_" + filepath.Base(req.Input)
+	}
+	result.Output = output
+
+	// ffmpeg cannot write the file it reads, so in-place edits use a temporary file
+	target := output
+	inPlace := filepath.Clean(output) == filepath.Clean(req.Input)
+	if inPlace {
+		ext := filepath.Ext(output)
+		target = strings.TrimSuffix(output, ext) + ".editing" + ext
+	}
+
+	// Chapters given as a list are written to a temporary FFmetadata file
+	chaptersFile := req.ChaptersFile
+	if len(req.Chapters) > 0 && !req.DryRun {
+		tmp, err := os.CreateTemp("", "chapters-*.txt")
+		if err != nil {
+			return result, fmt.Errorf("failed to create chapters file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+
+		_, err = tmp.WriteString(chaptersToFFMetadata(req.Chapters))
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to write chapters file: %w", err)
+		}
+		chaptersFile = tmp.Name()
+	} else if len(req.Chapters) > 0 {
+		// Dry runs do not write files; show where the chapter list would be read from
+		chaptersFile = "<chapters.txt>"
+	}
+
+	args := buildEditArgs(req, chaptersFile, target)
+	result.Command = fmt.Sprintf("ffmpeg %s", strings.Join(args, " "))
+	fmt.Printf("Executing: %s\n", result.Command)
+
+	if req.DryRun {
+		fmt.Printf("[Dry Run] %s\n", result.Command)
+		return result, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return result, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	cmd := exec.Command("ffmpeg", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(target)
+		return result, fmt.Errorf("metadata edit failed: %w\nOutput: %s", err, string(out))
+	}
+
+	if inPlace {
+		if err := os.Rename(target, output); err != nil {
+			os.Remove(target)
+			return result, fmt.Errorf("failed to replace input: %w", err)
+		}
+	}
+
+	// Report what was actually written
+	info, err := GetMediaInfo(output)
+	if err != nil {
+		return result, fmt.Errorf("failed to read edited file: %w", err)
+	}
+	result.Tags = info.Tags
+	result.Chapters = info.Chapters
+
+	fmt.Printf("Edit complete: %s\n", output)
+	return result, nil
+}
+
+// validateEditRequest checks an edit request for conflicting or invalid options
+func validateEditRequest(req EditRequest) error {
+	chapterSources := 0
+	for _, set := range []bool{len(req.Chapters) > 0, req.ChaptersFile != "", req.ClearChapters} {
+		if set {
+			chapterSources++
+		}
+	}
+	if chapterSources > 1 {
+		return fmt.Errorf("only one of chapters, chapters_file and clear_chapters can be set")
+	}
+	if req.ClearMetadata && req.CopyFrom != "" {
+		return fmt.Errorf("clear_metadata and copy_from cannot be combined")
+	}
+
+	for key := range req.Metadata {
+		if key == "" || strings.ContainsAny(key, "=\n") {
+			return fmt.Errorf("invalid metadata key '%s'", key)
+		}
+	}
+	if value := req.Metadata["creation_time"]; value != "" {
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return fmt.Errorf("invalid creation_time '%s': must be RFC 3339, e.g. 2024-05-01T12:00:00Z", value)
+		}
+	}
+
+	for i, chapter := range req.Chapters {
+		if chapter.Start < 0 || chapter.End <= chapter.Start {
+			return fmt.Errorf("invalid chapter %d: end must be after start", i+1)
+		}
+		if i > 0 && chapter.Start < req.Chapters[i-1].End {
+			return fmt.Errorf("invalid chapter %d: chapters must be in order and not overlap", i+1)
+		}
+	}
+
+	return nil
+}
+
+// buildEditArgs builds the ffmpeg argument list for a metadata edit. Inputs
+// are the media file, then the metadata source and chapters file if given.
+func buildEditArgs(req EditRequest, chaptersFile, output string) []string {
+	args := []string{"-hide_banner", "-y", "-i", req.Input}
+
+	metadataInput, chaptersInput := -1, -1
+	next := 1
+	if req.CopyFrom != "" {
+		args = append(args, "-i", req.CopyFrom)
+		metadataInput = next
+		next++
+	}
+	if chaptersFile != "" {
+		args = append(args, "-i", chaptersFile)
+		chaptersInput = next
+	}
+
+	args = append(args, "-map", "0", "-c", "copy")
+
+	switch {
+	case req.ClearMetadata:
+		args = append(args, "-map_metadata", "-1")
+	case metadataInput >= 0:
+		args = append(args, "-map_metadata", fmt.Sprint(metadataInput))
+	}
+
+	switch {
+	case req.ClearChapters:
+		args = append(args, "-map_chapters", "-1")
+	case chaptersInput >= 0:
+		args = append(args, "-map_chapters", fmt.Sprint(chaptersInput))
+	}
+
+	// Apply tags in a stable order so commands are reproducible
+	keys := make([]string, 0, len(req.Metadata))
+	for key := range req.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "-metadata", key+"="+req.Metadata[key])
+	}
+
+	return append(args, output)
+}
+
+// chaptersToFFMetadata renders chapters as an FFmetadata file
+func chaptersToFFMetadata(chapters []Chapter) string {
+	var sb strings.Builder
+	sb.WriteString(";FFMETADATA1\n")
+	for _, chapter := range chapters {
+		sb.WriteString("\n[CHAPTER]\nTIMEBASE=1/1000\n")
+		fmt.Fprintf(&sb, "START=%d\n", int64(math.Round(chapter.Start*1000)))
+		fmt.Fprintf(&sb, "END=%d\n", int64(math.Round(chapter.End*1000)))
+		if chapter.Title != "" {
+			fmt.Fprintf(&sb, "title=%s\n", escapeFFMetadata(chapter.Title))
+		}
+	}
+	return sb.String()
+}
+
+// escapeFFMetadata escapes the characters with special meaning in FFmetadata files
+func escapeFFMetadata(value string) string {
+	return escapeChars(value, "=;#\\\n")
+}
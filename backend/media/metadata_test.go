@@ -0,0 +1,113 @@
+package media
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChaptersToFFMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		chapters []Chapter
+		want     string
+	}{
+		{
+			name:     "no chapters",
+			chapters: nil,
+			want:     ";FFMETADATA1\n",
+		},
+		{
+			name:     "plain titles",
+			chapters: []Chapter{{Start: 0, End: 61.5, Title: "Intro"}, {Start: 61.5, End: 120.0004}},
+			want: ";FFMETADATA1\n" +
+				"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=61500\ntitle=Intro\n" +
+				"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=61500\nEND=120000\n",
+		},
+		{
+			name:     "special characters are escaped",
+			chapters: []Chapter{{Start: 1, End: 2, Title: "a=b; #1 C:\\clips\nnext line"}},
+			want: ";FFMETADATA1\n" +
+				"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=1000\nEND=2000\ntitle=a\\=b\\; \\#1 C:\\\\clips\\\nnext line\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chaptersToFFMetadata(tt.chapters); got != tt.want {
+				t.Errorf("chaptersToFFMetadata() = %q\nwant                     %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildEditArgs(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          EditRequest
+		chaptersFile string
+		want         string
+	}{
+		{
+			name: "tags only",
+			req:  EditRequest{Input: "in.mp4", Metadata: map[string]string{"title": "Talk", "artist": "A = B", "comment": ""}},
+			want: "-hide_banner -y -i in.mp4 -map 0 -c copy -metadata artist=A = B -metadata comment= -metadata title=Talk out.mp4",
+		},
+		{
+			name: "clear metadata",
+			req:  EditRequest{Input: "in.mp4", ClearMetadata: true, Metadata: map[string]string{"title": "New"}},
+			want: "-hide_banner -y -i in.mp4 -map 0 -c copy -map_metadata -1 -metadata title=New out.mp4",
+		},
+		{
+			name: "copy metadata from another file",
+			req:  EditRequest{Input: "in.mp4", CopyFrom: "source.mov"},
+			want: "-hide_banner -y -i in.mp4 -i source.mov -map 0 -c copy -map_metadata 1 out.mp4",
+		},
+		{
+			name:         "chapters file",
+			req:          EditRequest{Input: "in.mp4"},
+			chaptersFile: "chapters.txt",
+			want:         "-hide_banner -y -i in.mp4 -i chapters.txt -map 0 -c copy -map_chapters 1 out.mp4",
+		},
+		{
+			name:         "copied metadata and chapters",
+			req:          EditRequest{Input: "in.mp4", CopyFrom: "source.mov", Metadata: map[string]string{"title": "Override"}},
+			chaptersFile: "chapters.txt",
+			want:         "-hide_banner -y -i in.mp4 -i source.mov -i chapters.txt -map 0 -c copy -map_metadata 1 -map_chapters 2 -metadata title=Override out.mp4",
+		},
+		{
+			name: "clear chapters",
+			req:  EditRequest{Input: "in.mp4", ClearChapters: true},
+			want: "-hide_banner -y -i in.mp4 -map 0 -c copy -map_chapters -1 out.mp4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(buildEditArgs(tt.req, tt.chaptersFile, "out.mp4"), " "); got != tt.want {
+				t.Errorf("args = %q\nwant   %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateEditRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     EditRequest
+		wantErr string
+	}{
+		{name: "valid", req: EditRequest{Metadata: map[string]string{"creation_time": "2024-05-01T12:00:00Z"}, Chapters: []Chapter{{Start: 0, End: 5}, {Start: 5, End: 9}}}},
+		{name: "two chapter sources", req: EditRequest{ChaptersFile: "c.txt", ClearChapters: true}, wantErr: "only one of chapters"},
+		{name: "clear and copy", req: EditRequest{ClearMetadata: true, CopyFrom: "a.mp4"}, wantErr: "cannot be combined"},
+		{name: "key with equals sign", req: EditRequest{Metadata: map[string]string{"a=b": "c"}}, wantErr: "invalid metadata key 'a=b'"},
+		{name: "bad creation time", req: EditRequest{Metadata: map[string]string{"creation_time": "yesterday"}}, wantErr: "invalid creation_time"},
+		{name: "empty chapter", req: EditRequest{Chapters: []Chapter{{Start: 5, End: 5}}}, wantErr: "invalid chapter 1: end must be after start"},
+		{name: "overlapping chapters", req: EditRequest{Chapters: []Chapter{{Start: 0, End: 5}, {Start: 4, End: 9}}}, wantErr: "invalid chapter 2: chapters must be in order"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkError(t, validateEditRequest(tt.req), tt.wantErr)
+		})
+	}
+}
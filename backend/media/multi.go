@@ -0,0 +1,343 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress stages reported by multi-output encodes
+const (
+	StageEncoding = "encoding"
+	StageComplete = "complete"
+)
+
+// OutputSpec describes one rendition of a multi-output process request.
+// Unset fields fall back to the values of the request itself.
+type OutputSpec struct {
+	Output      string `json:"output,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Resolution  string `json:"resolution,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	ResizeMode  string `json:"resize_mode,omitempty"`
+	Bitrate     string `json:"bitrate,omitempty"`
+	Codec       string `json:"codec,omitempty"`
+	CRF         string `json:"crf,omitempty"`
+	Preset      string `json:"preset,omitempty"`
+	FrameRate   string `json:"frame_rate,omitempty"`
+	PixelFormat string `json:"pixel_format,omitempty"`
+}
+
+// OutputResult describes a rendition written by a multi-output encode
+type OutputResult struct {
+	Output     string `json:"output"`
+	Size       int64  `json:"size,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+	BitrateBps int64  `json:"bitrate_bps,omitempty"`
+	Codec      string `json:"codec,omitempty"`
+}
+
+// MultiResult represents the result of a multi-output encode
+type MultiResult struct {
+	Filename string         `json:"filename"`
+	Command  string         `json:"command"`
+	Outputs  []OutputResult `json:"outputs"`
+	DryRun   bool           `json:"dry_run,omitempty"`
+}
+
+// ProcessMulti encodes every rendition in req.Outputs from a single decode of
+// the input. Crop, tone mapping and trimming are shared; the decoded picture
+// is split once per rendition and scaled and encoded separately. onProgress,
+// if set, receives the progress of the whole encode.
+func ProcessMulti(req ProcessRequest, onProgress func(ProcessProgress)) (MultiResult, error) {
+	result := MultiResult{Filename: req.Input, DryRun: req.DryRun}
+
+	if len(req.Outputs) == 0 {
+		return result, fmt.Errorf("no outputs given")
+	}
+	if req.Codec == CodecCopy || req.StreamSelection.Active() {
+		return result, fmt.Errorf("codec copy and stream selection are not supported with multiple outputs")
+	}
+
+	// Validate the outputs before reading the input
+	_, outputs, err := resolveRenditions(req)
+	if err != nil {
+		return result, err
+	}
+
+	// Crop, trim and HDR are resolved once against the first output and then
+	// shared by every rendition; the others are checked when their encoder
+	// arguments are built
+	prepared := req
+	prepared.Output, prepared.Format = outputs[0], ""
+	input, err := prepareProcess(&prepared, outputs[0])
+	if err != nil {
+		return result, err
+	}
+	prepared.Output, prepared.Format = req.Output, req.Format
+	req = prepared
+
+	renditions, outputs, err := resolveRenditions(req)
+	if err != nil {
+		return result, err
+	}
+
+	args, err := buildMultiArgs(req, renditions, outputs)
+	if err != nil {
+		return result, err
+	}
+
+	result.Command = fmt.Sprintf("ffmpeg %s", strings.Join(args, " "))
+	fmt.Printf("Executing: %s\n", result.Command)
+
+	if req.DryRun {
+		fmt.Printf("[Dry Run] %s\n", result.Command)
+		for _, output := range outputs {
+			result.Outputs = append(result.Outputs, OutputResult{Output: output})
+		}
+		return result, nil
+	}
+
+	for _, output := range outputs {
+		if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+			return result, fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	if err := EncodePool.Run(func() error { return runWithProgress(args, input.Duration, onProgress) }); err != nil {
+		return result, err
+	}
+
+	for _, output := range outputs {
+		outputResult := OutputResult{Output: output}
+		if info, err := GetMediaInfo(output); err == nil {
+			outputResult.Size = info.Size
+			outputResult.Resolution = info.Resolution
+			outputResult.BitrateBps = info.BitrateBps
+			outputResult.Codec = info.Codec
+		}
+		result.Outputs = append(result.Outputs, outputResult)
+	}
+
+	fmt.Printf("Processing complete: %d outputs\n", len(outputs))
+	return result, nil
+}
+
+// resolveRenditions applies each output spec over the request and returns
+// the per-rendition requests with their output paths
+func resolveRenditions(req ProcessRequest) ([]ProcessRequest, []string, error) {
+	var renditions []ProcessRequest
+	var outputs []string
+	seen := make(map[string]bool)
+
+	base := strings.TrimSuffix(filepath.Base(req.Input), filepath.Ext(req.Input))
+	for i, spec := range req.Outputs {
+		r := req
+		r.Outputs = nil
+		if spec.Resolution != "" || spec.Width > 0 || spec.Height > 0 {
+			r.Resolution, r.Width, r.Height = spec.Resolution, spec.Width, spec.Height
+		}
+		r.Format = firstNonEmpty(spec.Format, r.Format)
+		r.ResizeMode = firstNonEmpty(spec.ResizeMode, r.ResizeMode)
+		r.Bitrate = firstNonEmpty(spec.Bitrate, r.Bitrate)
+		r.Codec = firstNonEmpty(spec.Codec, r.Codec)
+		r.CRF = firstNonEmpty(spec.CRF, r.CRF)
+		r.Preset = firstNonEmpty(spec.Preset, r.Preset)
+		r.FrameRate = firstNonEmpty(spec.FrameRate, r.FrameRate)
+		r.PixelFormat = firstNonEmpty(spec.PixelFormat, r.PixelFormat)
+
+		output := spec.Output
+		if output == "" {
+			output = fmt.Sprintf("processed_%s_%d.%s", base, i+1, firstNonEmpty(r.Format, "mp4"))
+			if req.Output != "" {
+				// Number renditions after the request's output name
+				ext := filepath.Ext(req.Output)
+				output = fmt.Sprintf("%s_%d.%s", strings.TrimSuffix(req.Output, ext), i+1, firstNonEmpty(r.Format, strings.TrimPrefix(ext, "."), "mp4"))
+			}
+		} else if filepath.Ext(output) == "" {
+			output = output + "." + firstNonEmpty(r.Format, "mp4")
+		}
+		if r.Format == "" {
+			r.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(output)), ".")
+		}
+
+		if isAnimationOutput(output) || isImageOutput(output) {
+			return nil, nil, fmt.Errorf("output %d: image and animation outputs are not supported with multiple outputs", i+1)
+		}
+		if r.Codec == CodecCopy {
+			return nil, nil, fmt.Errorf("output %d: codec copy is not supported with multiple outputs", i+1)
+		}
+		if seen[output] {
+			return nil, nil, fmt.Errorf("output %d: %s is written twice", i+1, output)
+		}
+		seen[output] = true
+
+		renditions = append(renditions, r)
+		outputs = append(outputs, output)
+	}
+
+	return renditions, outputs, nil
+}
+
+// buildMultiArgs builds one ffmpeg invocation that decodes and corrects the
+// source once, splits it, and encodes each rendition to its own output
+func buildMultiArgs(req ProcessRequest, renditions []ProcessRequest, outputs []string) ([]string, error) {
+	args := []string{"-hide_banner", "-y", "-nostats"}
+
+	if req.Start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(req.Start, 'f', 3, 64))
+	}
+	args = append(args, "-i", req.Input, "-progress", "pipe:1")
+	if req.Duration > 0 {
+		args = append(args, "-t", strconv.FormatFloat(req.Duration, 'f', 3, 64))
+	}
+
+	graph := NewFilterGraph()
+	source := graph.Chain("0:v:0")
+	sourceFilters, err := sourceFilters(req)
+	if err != nil {
+		return nil, err
+	}
+	source.Add(sourceFilters...)
+
+	// Split the corrected picture once per rendition
+	splitLabels := make([]string, len(renditions))
+	for i := range renditions {
+		splitLabels[i] = graph.NewLabel("split")
+	}
+	if len(renditions) > 1 {
+		source.Add(NewFilter("split", strconv.Itoa(len(renditions))))
+	} else if len(sourceFilters) == 0 {
+		source.Add(NewFilter("null"))
+	}
+	source.Output(splitLabels...)
+
+	var outputArgs []string
+	for i, r := range renditions {
+		chain := graph.Chain(splitLabels[i])
+		filters, err := renditionFilters(r)
+		if err != nil {
+			return nil, fmt.Errorf("output %d: %w", i+1, err)
+		}
+		if len(filters) == 0 {
+			filters = []*Filter{NewFilter("null")}
+		}
+		label := graph.NewLabel("vout")
+		chain.Add(filters...).Output(label)
+
+		encoder, err := encoderArgs(r)
+		if err != nil {
+			return nil, fmt.Errorf("output %d: %w", i+1, err)
+		}
+		outputArgs = append(outputArgs, "-map", "["+label+"]", "-map", "0:a:0?")
+		outputArgs = append(outputArgs, encoder...)
+		outputArgs = append(outputArgs, outputs[i])
+	}
+
+	if err := graph.Validate(); err != nil {
+		return nil, err
+	}
+
+	args = append(args, "-filter_complex", graph.String())
+	return append(args, outputArgs...), nil
+}
+
+// runWithProgress runs ffmpeg with -progress pipe:1 and reports the parsed
+// progress blocks. The last lines of stderr are included in errors.
+func runWithProgress(args []string, duration time.Duration, onProgress func(ProcessProgress)) error {
+	cmd := exec.Command("ffmpeg", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	var elapsed time.Duration
+	var speed string
+	lastReported := -1.0
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "out_time_us":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+				elapsed = time.Duration(us) * time.Microsecond
+			}
+		case "speed":
+			speed = strings.TrimSpace(value)
+		case "progress":
+			// A progress key ends each block
+			progress := ProcessProgress{Stage: StageEncoding, Speed: speed}
+			if duration > 0 {
+				progress.Progress = min(float64(elapsed)/float64(duration)*100, 100)
+				progress.ETA = progressETA(duration-elapsed, speed)
+			}
+			if value == "end" {
+				progress.Stage = StageComplete
+				progress.Progress = 100
+				progress.ETA = ""
+			}
+
+			// Report every 1% change like single-output encodes
+			if progress.Progress >= lastReported+1 || progress.Stage == StageComplete {
+				fmt.Printf("Progress: %.1f%% %s\n", progress.Progress, speed)
+				lastReported = progress.Progress
+				if onProgress != nil {
+					onProgress(progress)
+				}
+			}
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpeg processing failed: %w\nOutput: %s", err, tailLines(stderr.String(), 20))
+	}
+	return nil
+}
+
+// progressETA estimates the remaining wall time from the remaining media
+// time and ffmpeg's speed factor (e.g. "2.5x")
+func progressETA(remaining time.Duration, speed string) string {
+	factor, err := strconv.ParseFloat(strings.TrimSuffix(speed, "x"), 64)
+	if err != nil || factor <= 0 || remaining <= 0 {
+		return ""
+	}
+	return formatDuration(time.Duration(float64(remaining) / factor))
+}
+
+// tailLines returns the last n lines of a string
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,79 @@
+package media
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeProbe puts an ffprobe on PATH that reports a single HEVC video stream
+// with the given transfer characteristics, and returns an input file for it
+func fakeProbe(t *testing.T, transfer string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffprobe is a shell script")
+	}
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho '" +
+		`{"streams":[{"index":0,"codec_type":"video","codec_name":"hevc","width":3840,"height":2160,"color_transfer":"` + transfer + `"}],` +
+		`"format":{"duration":"10.0"},"frames":[]}` + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffprobe"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	input := filepath.Join(dir, "input.mkv")
+	if err := os.WriteFile(input, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return input
+}
+
+func TestProcessMultiDryRunHDR(t *testing.T) {
+	outputs := []OutputSpec{{Output: "a.mkv", Height: 2160}, {Output: "b.mkv", Height: 1080}}
+
+	tests := []struct {
+		name     string
+		transfer string
+		hdr      string
+		want     []string
+		exclude  []string
+	}{
+		{
+			name:     "passthrough reaches every rendition",
+			transfer: "smpte2084",
+			hdr:      HDRPassthrough,
+			want:     []string{"-c:v libx265", "-color_trc smpte2084"},
+		},
+		{
+			name:     "tonemap on SDR input is dropped",
+			transfer: "bt709",
+			hdr:      HDRToneMap,
+			exclude:  []string{"zscale=", "tonemap="},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := fakeProbe(t, tt.transfer)
+			result, err := ProcessMulti(ProcessRequest{Input: input, HDR: tt.hdr, Outputs: outputs, DryRun: true}, nil)
+			if err != nil {
+				t.Fatalf("ProcessMulti() error = %v", err)
+			}
+
+			for _, want := range tt.want {
+				if n := strings.Count(result.Command, want); n != len(outputs) {
+					t.Errorf("command has %q %d times, want %d: %s", want, n, len(outputs), result.Command)
+				}
+			}
+			for _, exclude := range tt.exclude {
+				if strings.Contains(result.Command, exclude) {
+					t.Errorf("command contains %q: %s", exclude, result.Command)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package media
+
+import (
+	"os/exec"
+	"runtime"
+	"sync"
+)
+
+// EncodePool limits how many ffmpeg encodes run at once across requests.
+// Replace it at startup to change the limit.
+var EncodePool = NewPool(runtime.NumCPU())
+
+// Pool runs tasks on a bounded number of goroutines
+type Pool struct {
+	slots chan struct{}
+}
+
+// NewPool creates a pool that runs at most workers tasks at a time
+func NewPool(workers int) *Pool {
+	return &Pool{slots: make(chan struct{}, max(workers, 1))}
+}
+
+// Size returns the number of tasks the pool runs at a time
+func (p *Pool) Size() int {
+	return cap(p.slots)
+}
+
+// Run runs the tasks and waits for them to finish. Tasks from all callers
+// share the pool's slots. It returns the first error; tasks that have not
+// started when a task fails are skipped.
+func (p *Pool) Run(tasks ...func() error) error {
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	failed := make(chan struct{})
+
+	for _, task := range tasks {
+		// Wait for a free slot, or stop starting tasks after a failure
+		select {
+		case p.slots <- struct{}{}:
+		case <-failed:
+			wg.Wait()
+			return firstErr
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-p.slots }()
+
+			if err := task(); err != nil {
+				once.Do(func() {
+					firstErr = err
+					close(failed)
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// runFFmpeg runs ffmpeg in a slot of EncodePool and returns its combined
+// stdout and stderr
+func runFFmpeg(args []string) ([]byte, error) {
+	var out []byte
+	err := EncodePool.Run(func() error {
+		var err error
+		out, err = exec.Command("ffmpeg", args...).CombinedOutput()
+		return err
+	})
+	return out, err
+}
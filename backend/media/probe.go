@@ -0,0 +1,316 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Stream types reported in Stream.Type
+const (
+	StreamVideo      = "video"
+	StreamAudio      = "audio"
+	StreamSubtitle   = "subtitle"
+	StreamData       = "data"
+	StreamAttachment = "attachment"
+)
+
+// pixFmtDepthRegex matches the bit depth suffix of pixel formats like yuv420p10le
+var pixFmtDepthRegex = regexp.MustCompile(`p(\d{2})(le|be)?$`)
+
+// Stream represents a single stream of a media file
+type Stream struct {
+	Index          int               `json:"index"`
+	Type           string            `json:"type"`
+	Codec          string            `json:"codec"`
+	CodecLongName  string            `json:"codec_long_name,omitempty"`
+	CodecTag       string            `json:"codec_tag,omitempty"`
+	Profile        string            `json:"profile,omitempty"`
+	Level          int               `json:"level,omitempty"`
+	Width          int               `json:"width,omitempty"`
+	Height         int               `json:"height,omitempty"`
+	PixelFormat    string            `json:"pixel_format,omitempty"`
+	ColorRange     string            `json:"color_range,omitempty"`
+	ColorSpace     string            `json:"color_space,omitempty"`
+	ColorPrimaries string            `json:"color_primaries,omitempty"`
+	ColorTransfer  string            `json:"color_transfer,omitempty"`
+	BitDepth       int               `json:"bit_depth,omitempty"`
+	FrameRate      *Rational         `json:"frame_rate,omitempty"` // Exact frame rate such as 30000/1001
+	SampleAspect   string            `json:"sample_aspect_ratio,omitempty"`
+	DisplayAspect  string            `json:"display_aspect_ratio,omitempty"`
+	Rotation       int               `json:"rotation,omitempty"`
+	SampleRate     int               `json:"sample_rate,omitempty"`
+	Channels       int               `json:"channels,omitempty"`
+	ChannelLayout  string            `json:"channel_layout,omitempty"`
+	Language       string            `json:"language,omitempty"`
+	Title          string            `json:"title,omitempty"`
+	Disposition    []string          `json:"disposition,omitempty"` // Active flags such as default, forced, attached_pic
+	Duration       float64           `json:"duration,omitempty"`    // Seconds
+	Bitrate        int64             `json:"bitrate,omitempty"`     // Bits per second
+	Frames         int64             `json:"frames,omitempty"`
+	HDR            *HDRInfo          `json:"hdr,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+// Chapter represents a chapter marker in a media file
+type Chapter struct {
+	ID    int64             `json:"id"`
+	Start float64           `json:"start"` // Seconds
+	End   float64           `json:"end"`   // Seconds
+	Title string            `json:"title,omitempty"`
+	Tags  map[string]string `json:"tags,omitempty"`
+}
+
+// ffprobeStream is the raw stream entry printed by ffprobe -show_streams
+type ffprobeStream struct {
+	Index            int               `json:"index"`
+	CodecName        string            `json:"codec_name"`
+	CodecLongName    string            `json:"codec_long_name"`
+	CodecType        string            `json:"codec_type"`
+	CodecTagString   string            `json:"codec_tag_string"`
+	Profile          string            `json:"profile"`
+	Level            int               `json:"level"`
+	Width            int               `json:"width"`
+	Height           int               `json:"height"`
+	PixFmt           string            `json:"pix_fmt"`
+	ColorRange       string            `json:"color_range"`
+	ColorSpace       string            `json:"color_space"`
+	ColorPrimaries   string            `json:"color_primaries"`
+	ColorTransfer    string            `json:"color_transfer"`
+	BitsPerRawSample string            `json:"bits_per_raw_sample"`
+	BitsPerSample    int               `json:"bits_per_sample"`
+	RFrameRate       string            `json:"r_frame_rate"`
+	AvgFrameRate     string            `json:"avg_frame_rate"`
+	SampleAspect     string            `json:"sample_aspect_ratio"`
+	DisplayAspect    string            `json:"display_aspect_ratio"`
+	SampleRate       string            `json:"sample_rate"`
+	Channels         int               `json:"channels"`
+	ChannelLayout    string            `json:"channel_layout"`
+	Duration         string            `json:"duration"`
+	BitRate          string            `json:"bit_rate"`
+	NbFrames         string            `json:"nb_frames"`
+	Disposition      map[string]int    `json:"disposition"`
+	Tags             map[string]string `json:"tags"`
+	SideDataList     []ffprobeSideData `json:"side_data_list"`
+}
+
+// ffprobeSideData is a raw side data entry of a stream
+type ffprobeSideData struct {
+	SideDataType string  `json:"side_data_type"`
+	Rotation     float64 `json:"rotation"`
+
+	// Mastering display metadata (rationals such as "34000/50000")
+	RedX         string `json:"red_x"`
+	RedY         string `json:"red_y"`
+	GreenX       string `json:"green_x"`
+	GreenY       string `json:"green_y"`
+	BlueX        string `json:"blue_x"`
+	BlueY        string `json:"blue_y"`
+	WhitePointX  string `json:"white_point_x"`
+	WhitePointY  string `json:"white_point_y"`
+	MinLuminance string `json:"min_luminance"`
+	MaxLuminance string `json:"max_luminance"`
+
+	// Content light level metadata
+	MaxContent int `json:"max_content"`
+	MaxAverage int `json:"max_average"`
+}
+
+// ffprobeChapter is the raw chapter entry printed by ffprobe -show_chapters
+type ffprobeChapter struct {
+	ID        int64             `json:"id"`
+	StartTime string            `json:"start_time"`
+	EndTime   string            `json:"end_time"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// ffprobeFormat is the raw container entry printed by ffprobe -show_format
+type ffprobeFormat struct {
+	Filename       string            `json:"filename"`
+	FormatName     string            `json:"format_name"`
+	FormatLongName string            `json:"format_long_name"`
+	StartTime      string            `json:"start_time"`
+	Duration       string            `json:"duration"`
+	Size           string            `json:"size"`
+	BitRate        string            `json:"bit_rate"`
+	Tags           map[string]string `json:"tags"`
+}
+
+// ffprobeFrame is the raw frame entry printed by ffprobe -show_entries frame=...
+type ffprobeFrame struct {
+	StreamIndex  int               `json:"stream_index"`
+	SideDataList []ffprobeSideData `json:"side_data_list"`
+}
+
+// ffprobeOutput is the complete JSON document printed by ffprobe
+type ffprobeOutput struct {
+	Streams  []ffprobeStream  `json:"streams"`
+	Chapters []ffprobeChapter `json:"chapters"`
+	Format   ffprobeFormat    `json:"format"`
+	Frames   []ffprobeFrame   `json:"frames"`
+}
+
+// frameSideData returns the side data of the probed frames of a stream
+func (p ffprobeOutput) frameSideData(streamIndex int) []ffprobeSideData {
+	var sideData []ffprobeSideData
+	for _, frame := range p.Frames {
+		if frame.StreamIndex == streamIndex {
+			sideData = append(sideData, frame.SideDataList...)
+		}
+	}
+	return sideData
+}
+
+// probeFile runs ffprobe and decodes its streams, chapters and format. The
+// frame side data of the first packets is read too, since HEVC streams may
+// carry HDR metadata in-band rather than in the container; 64 packets reach
+// past the leading audio of interleaved files.
+func probeFile(path string) (ffprobeOutput, error) {
+	var probe ffprobeOutput
+
+	cmd := exec.Command("ffprobe",
+		"-v", "quiet",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		"-show_chapters",
+		"-show_entries", "frame=stream_index,side_data_list",
+		"-read_intervals", "%+#64",
+		path)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return probe, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return probe, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	return probe, nil
+}
+
+// newStream converts a raw ffprobe stream into the typed Stream model
+func newStream(raw ffprobeStream) Stream {
+	stream := Stream{
+		Index:          raw.Index,
+		Type:           raw.CodecType,
+		Codec:          raw.CodecName,
+		CodecLongName:  raw.CodecLongName,
+		Profile:        raw.Profile,
+		Width:          raw.Width,
+		Height:         raw.Height,
+		PixelFormat:    raw.PixFmt,
+		ColorRange:     raw.ColorRange,
+		ColorSpace:     raw.ColorSpace,
+		ColorPrimaries: raw.ColorPrimaries,
+		ColorTransfer:  raw.ColorTransfer,
+		SampleAspect:   raw.SampleAspect,
+		DisplayAspect:  raw.DisplayAspect,
+		Channels:       raw.Channels,
+		ChannelLayout:  raw.ChannelLayout,
+		Duration:       parseFloatOrZero(raw.Duration),
+		Bitrate:        parseIntOrZero(raw.BitRate),
+		Frames:         parseIntOrZero(raw.NbFrames),
+		SampleRate:     int(parseIntOrZero(raw.SampleRate)),
+		Tags:           raw.Tags,
+	}
+
+	// ffprobe reports unknown levels as -99 and tags like [0][0][0][0]
+	if raw.Level > 0 {
+		stream.Level = raw.Level
+	}
+	if raw.CodecTagString != "" && raw.CodecTagString[0] != '[' {
+		stream.CodecTag = raw.CodecTagString
+	}
+
+	if raw.CodecType == StreamVideo {
+		if rate, err := ParseRational(raw.RFrameRate); err == nil && rate.Valid() {
+			stream.FrameRate = &rate
+		}
+	}
+
+	stream.BitDepth = int(parseIntOrZero(raw.BitsPerRawSample))
+	if stream.BitDepth == 0 {
+		stream.BitDepth = raw.BitsPerSample
+	}
+	if stream.BitDepth == 0 && raw.PixFmt != "" {
+		stream.BitDepth = pixelFormatDepth(raw.PixFmt)
+	}
+
+	if raw.Tags != nil {
+		stream.Language = raw.Tags["language"]
+		stream.Title = raw.Tags["title"]
+		if rotate, err := strconv.Atoi(raw.Tags["rotate"]); err == nil {
+			stream.Rotation = rotate
+		}
+	}
+	for _, sideData := range raw.SideDataList {
+		if sideData.SideDataType == "Display Matrix" && sideData.Rotation != 0 {
+			stream.Rotation = int(sideData.Rotation)
+		}
+	}
+
+	for flag, value := range raw.Disposition {
+		if value != 0 {
+			stream.Disposition = append(stream.Disposition, flag)
+		}
+	}
+	sort.Strings(stream.Disposition)
+
+	return stream
+}
+
+// newChapter converts a raw ffprobe chapter into the typed Chapter model
+func newChapter(raw ffprobeChapter) Chapter {
+	chapter := Chapter{
+		ID:    raw.ID,
+		Start: parseFloatOrZero(raw.StartTime),
+		End:   parseFloatOrZero(raw.EndTime),
+		Tags:  raw.Tags,
+	}
+	if raw.Tags != nil {
+		chapter.Title = raw.Tags["title"]
+	}
+	return chapter
+}
+
+// HasDisposition reports whether the stream has the given disposition flag
+func (s Stream) HasDisposition(flag string) bool {
+	for _, d := range s.Disposition {
+		if d == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// pixelFormatDepth derives the bit depth from a pixel format name
+func pixelFormatDepth(pixFmt string) int {
+	if matches := pixFmtDepthRegex.FindStringSubmatch(pixFmt); len(matches) > 1 {
+		depth, _ := strconv.Atoi(matches[1])
+		return depth
+	}
+	return 8
+}
+
+// parseFloatOrZero parses a float and returns 0 for empty or invalid values
+func parseFloatOrZero(value string) float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// parseIntOrZero parses an integer and returns 0 for empty or invalid values
+func parseIntOrZero(value string) int64 {
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return i
+}
@@ -0,0 +1,169 @@
+package media
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// fakeFFprobe puts an ffprobe on PATH that prints output, and returns an
+// input file for it
+func fakeFFprobe(t *testing.T, output string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffprobe is a shell script")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "probe.json"), []byte(output), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\ncat '" + filepath.Join(dir, "probe.json") + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffprobe"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	input := filepath.Join(dir, "input.mkv")
+	if err := os.WriteFile(input, []byte("media"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return input
+}
+
+func TestNewStream(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want Stream
+	}{
+		{
+			name: "video",
+			raw: `{"index": 0, "codec_name": "h264", "codec_long_name": "H.264 / AVC", "codec_type": "video",
+				"codec_tag_string": "avc1", "profile": "High", "level": 40, "width": 1920, "height": 1080,
+				"pix_fmt": "yuv420p", "color_range": "tv", "bits_per_raw_sample": "8", "r_frame_rate": "30000/1001",
+				"sample_aspect_ratio": "1:1", "display_aspect_ratio": "16:9", "duration": "10.010000",
+				"bit_rate": "4500000", "nb_frames": "300",
+				"disposition": {"default": 1, "forced": 0, "attached_pic": 0},
+				"tags": {"language": "eng", "title": "Main", "handler_name": "VideoHandler"},
+				"side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]}`,
+			want: Stream{
+				Index: 0, Type: StreamVideo, Codec: "h264", CodecLongName: "H.264 / AVC", CodecTag: "avc1",
+				Profile: "High", Level: 40, Width: 1920, Height: 1080, PixelFormat: "yuv420p", ColorRange: "tv",
+				BitDepth: 8, FrameRate: &Rational{Num: 30000, Den: 1001}, SampleAspect: "1:1", DisplayAspect: "16:9",
+				Rotation: -90, Language: "eng", Title: "Main", Disposition: []string{"default"},
+				Duration: 10.01, Bitrate: 4500000, Frames: 300,
+				Tags: map[string]string{"language": "eng", "title": "Main", "handler_name": "VideoHandler"},
+			},
+		},
+		{
+			name: "audio",
+			raw: `{"index": 1, "codec_name": "aac", "codec_type": "audio", "profile": "LC", "sample_rate": "48000",
+				"channels": 2, "channel_layout": "stereo", "duration": "10.5", "bit_rate": "128000",
+				"disposition": {"default": 0, "dub": 1, "comment": 1}}`,
+			want: Stream{
+				Index: 1, Type: StreamAudio, Codec: "aac", Profile: "LC", SampleRate: 48000, Channels: 2,
+				ChannelLayout: "stereo", Duration: 10.5, Bitrate: 128000, Disposition: []string{"comment", "dub"},
+			},
+		},
+		{
+			name: "bit depth from the pixel format",
+			raw:  `{"index": 0, "codec_name": "hevc", "codec_type": "video", "pix_fmt": "yuv420p10le", "color_transfer": "smpte2084", "tags": {"rotate": "180"}}`,
+			want: Stream{Index: 0, Type: StreamVideo, Codec: "hevc", PixelFormat: "yuv420p10le", ColorTransfer: "smpte2084", BitDepth: 10, Rotation: 180, Tags: map[string]string{"rotate": "180"}},
+		},
+		{
+			name: "unknown values are left out",
+			raw: `{"index": 2, "codec_name": "mpeg4", "codec_type": "video", "codec_tag_string": "[0][0][0][0]", "level": -99,
+				"r_frame_rate": "0/0", "bit_rate": "N/A", "duration": "N/A", "nb_frames": "", "sample_rate": "x"}`,
+			want: Stream{Index: 2, Type: StreamVideo, Codec: "mpeg4"},
+		},
+		{
+			name: "bits per sample of PCM audio",
+			raw:  `{"index": 0, "codec_name": "pcm_s24le", "codec_type": "audio", "bits_per_sample": 24, "sample_rate": "96000"}`,
+			want: Stream{Index: 0, Type: StreamAudio, Codec: "pcm_s24le", BitDepth: 24, SampleRate: 96000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw ffprobeStream
+			if err := json.Unmarshal([]byte(tt.raw), &raw); err != nil {
+				t.Fatal(err)
+			}
+			if got := newStream(raw); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newStream() = %+v\nwant          %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPixelFormatDepth(t *testing.T) {
+	for pixFmt, want := range map[string]int{"yuv420p": 8, "nv12": 8, "yuv420p10le": 10, "yuv422p10": 10, "yuv444p12be": 12, "rgb24": 8} {
+		if got := pixelFormatDepth(pixFmt); got != want {
+			t.Errorf("pixelFormatDepth(%q) = %d, want %d", pixFmt, got, want)
+		}
+	}
+}
+
+func TestNewChapter(t *testing.T) {
+	var raw ffprobeChapter
+	if err := json.Unmarshal([]byte(`{"id": 3, "start_time": "60.500000", "end_time": "120.000000", "tags": {"title": "Intro"}}`), &raw); err != nil {
+		t.Fatal(err)
+	}
+	want := Chapter{ID: 3, Start: 60.5, End: 120, Title: "Intro", Tags: map[string]string{"title": "Intro"}}
+	if got := newChapter(raw); !reflect.DeepEqual(got, want) {
+		t.Errorf("newChapter() = %+v, want %+v", got, want)
+	}
+
+	if got := newChapter(ffprobeChapter{ID: 1, StartTime: "0", EndTime: "N/A"}); got.Title != "" || got.End != 0 {
+		t.Errorf("newChapter() without tags = %+v", got)
+	}
+}
+
+func TestGetMediaInfoLegacyFields(t *testing.T) {
+	input := fakeFFprobe(t, `{
+		"streams": [
+			{"index": 0, "codec_name": "mjpeg", "codec_type": "video", "width": 600, "height": 600, "disposition": {"attached_pic": 1}},
+			{"index": 1, "codec_name": "h264", "codec_type": "video", "width": 1280, "height": 720, "r_frame_rate": "30000/1001", "bit_rate": "2500000"},
+			{"index": 2, "codec_name": "aac", "codec_type": "audio", "sample_rate": "44100", "channels": 2}
+		],
+		"chapters": [{"id": 0, "start_time": "0.000000", "end_time": "5.000000", "tags": {"title": "Start"}}],
+		"format": {"format_name": "matroska,webm", "format_long_name": "Matroska / WebM", "duration": "65.250000", "bit_rate": "2700000", "tags": {"title": "Talk"}}
+	}`)
+
+	info, err := GetMediaInfo(input)
+	if err != nil {
+		t.Fatalf("GetMediaInfo() error = %v", err)
+	}
+
+	legacy := MediaInfo{
+		Filename:   input,
+		Format:     "matroska,webm",
+		Duration:   "65.250000s",
+		Resolution: "1280x720",
+		Bitrate:    "2500000",
+		Size:       5,
+		Codec:      "h264",
+		FrameRate:  "29.97 fps",
+	}
+	got := MediaInfo{
+		Filename: info.Filename, Format: info.Format, Duration: info.Duration, Resolution: info.Resolution,
+		Bitrate: info.Bitrate, Size: info.Size, Codec: info.Codec, FrameRate: info.FrameRate,
+	}
+	if !reflect.DeepEqual(got, legacy) {
+		t.Errorf("flat fields = %+v\nwant          %+v", got, legacy)
+	}
+
+	if info.DurationSeconds != 65.25 || info.BitrateBps != 2500000 || info.FPS < 29.97 || info.FPS > 29.98 || info.Width != 1280 {
+		t.Errorf("numeric fields = %v s, %d b/s, %v fps, width %d", info.DurationSeconds, info.BitrateBps, info.FPS, info.Width)
+	}
+	if len(info.Streams) != 3 || len(info.Chapters) != 1 || info.Chapters[0].Title != "Start" {
+		t.Errorf("streams = %d, chapters = %+v", len(info.Streams), info.Chapters)
+	}
+	if info.FormatLongName != "Matroska / WebM" || info.Tags["title"] != "Talk" {
+		t.Errorf("format = %q, tags = %v", info.FormatLongName, info.Tags)
+	}
+}
@@ -2,7 +2,6 @@ package media
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -22,20 +21,67 @@ type MediaInfo struct {
 	Size       int64  `json:"size"`
 	Codec      string `json:"codec"`
 	FrameRate  string `json:"frame_rate"`
+
+	DurationSeconds float64    `json:"duration_seconds"`              // Container duration in seconds
+	DurationText    string     `json:"duration_text,omitempty"`       // Duration as HH:MM:SS.xx
+	BitrateBps      int64      `json:"bitrate_bps"`                   // Video (or overall) bitrate in bits per second
+	BitrateText     string     `json:"bitrate_text,omitempty"`        // Bitrate with unit, e.g. "5.00 Mb/s"
+	FrameRateExact  *Rational  `json:"frame_rate_rational,omitempty"` // Exact frame rate, e.g. 30000/1001
+	FPS             float64    `json:"fps,omitempty"`                 // Frame rate as a number
+	Width           int        `json:"width,omitempty"`
+	Height          int        `json:"height,omitempty"`
+	HDRType         string     `json:"hdr_type,omitempty"` // HDR10, HDR10+, HLG or Dolby Vision
+	Image           *ImageInfo `json:"image,omitempty"`    // Present for still image files
+
+	FormatLongName string            `json:"format_long_name,omitempty"`
+	Streams        []Stream          `json:"streams,omitempty"`
+	Chapters       []Chapter         `json:"chapters,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
 }
 
 // ProcessRequest represents a request to process media
 type ProcessRequest struct {
-	Input      string `json:"input"`
-	Output     string `json:"output,omitempty"`
-	Resolution string `json:"resolution,omitempty"`
-	Bitrate    string `json:"bitrate,omitempty"`
-	Format     string `json:"format,omitempty"`
-	Codec      string `json:"codec,omitempty"`
-	FrameRate  string `json:"frame_rate,omitempty"`
-	CRF        string `json:"crf,omitempty"`    // Constant Rate Factor for quality-based compression
-	Preset     string `json:"preset,omitempty"` // Encoding preset (ultrafast, fast, medium, slow, etc.)
-	DryRun     bool   `json:"dry_run,omitempty"` // If true, return command string without executing
+	Input       string    `json:"input"`
+	Output      string    `json:"output,omitempty"`
+	Resolution  string    `json:"resolution,omitempty"`
+	Bitrate     string    `json:"bitrate,omitempty"`
+	Format      string    `json:"format,omitempty"`
+	Codec       string    `json:"codec,omitempty"` // Video encoder, or "copy" to remux without re-encoding
+	FrameRate   string    `json:"frame_rate,omitempty"`
+	CRF         string    `json:"crf,omitempty"`          // Constant Rate Factor for quality-based compression
+	Preset      string    `json:"preset,omitempty"`       // Encoding preset (ultrafast, fast, medium, slow, etc.)
+	PixelFormat string    `json:"pixel_format,omitempty"` // Output pixel format (yuv420p, yuv444p, rgb24, etc.)
+	Width       int       `json:"width,omitempty"`        // Target width; height follows aspect ratio if omitted
+	Height      int       `json:"height,omitempty"`       // Target height; width follows aspect ratio if omitted
+	ResizeMode  string    `json:"resize_mode,omitempty"`  // How to fit the target box: fit (default), fill or stretch
+	PadColor    string    `json:"pad_color,omitempty"`    // Letterbox color for fit mode (default black)
+	NoUpscale   bool      `json:"no_upscale,omitempty"`   // Never enlarge the picture beyond its source size
+	Crop        *CropRect `json:"crop,omitempty"`         // Crop rectangle applied before scaling
+	AutoCrop    bool      `json:"auto_crop,omitempty"`    // Detect and remove black bars before scaling
+	Start       float64   `json:"start,omitempty"`        // Seconds to skip at the start of the input
+	Duration    float64   `json:"duration,omitempty"`     // Seconds of input to process (0 = until the end)
+	TrimSilence bool      `json:"trim_silence,omitempty"` // Remove leading and trailing silence
+	TrimBlack   bool      `json:"trim_black,omitempty"`   // Remove leading and trailing black frames
+	HDR         string    `json:"hdr,omitempty"`          // HDR handling: tonemap (to SDR BT.709) or passthrough (libx265)
+	ToneMap     string    `json:"tonemap,omitempty"`      // Tone mapping curve: hable (default), mobius, reinhard, clip, linear, gamma
+	HDRMetadata *HDRInfo  `json:"hdr_metadata,omitempty"` // HDR metadata for passthrough; read from the input if omitted
+	Chunks      int       `json:"chunks,omitempty"`       // Encode in this many segments in parallel; falls back to a single pass when unsafe
+
+	// Image options (used when both input and output are images)
+	Quality       int  `json:"quality,omitempty"`        // 1-100, mapped to the encoder's quality scale
+	Lossless      bool `json:"lossless,omitempty"`       // Lossless WebP/AVIF encoding
+	Optimize      bool `json:"optimize,omitempty"`       // Spend more CPU on smaller files without further quality loss
+	StripMetadata bool `json:"strip_metadata,omitempty"` // Remove EXIF, XMP and other metadata from the output
+
+	// Animation options (used for GIF and animated WebP outputs)
+	Dither      string `json:"dither,omitempty"`        // GIF palette dithering (default sierra2_4a)
+	Loop        int    `json:"loop,omitempty"`          // Number of plays; 0 loops forever
+	MaxFileSize int64  `json:"max_file_size,omitempty"` // Target size in bytes; fps and size are lowered until met
+	DryRun      bool   `json:"dry_run,omitempty"`       // If true, return command string without executing
+
+	StreamSelection // Without selectors the first video and audio streams are kept
+
+	Outputs []OutputSpec `json:"outputs,omitempty"` // Renditions encoded from one decode; see ProcessMulti
 }
 
 // ProcessProgress represents the progress of a media processing operation
@@ -46,15 +92,31 @@ type ProcessProgress struct {
 	Speed    string  `json:"speed"`
 }
 
+// CompareRequest represents a request to compare an original and a processed file
+type CompareRequest struct {
+	Original  string `json:"original"`
+	Processed string `json:"processed"`
+}
+
 // CompareResult represents the result of a media comparison
 type CompareResult struct {
-	Original          MediaInfo `json:"original"`
-	Processed         MediaInfo `json:"processed"`
-	SizeDiff          float64   `json:"size_diff_percent"`
-	ResolutionChanged bool      `json:"resolution_changed"`
-	BitrateReduction  float64   `json:"bitrate_reduction_percent"`
-	FormatChanged     bool      `json:"format_changed"`
-	CodecChanged      bool      `json:"codec_changed"`
+	Original          MediaInfo  `json:"original"`
+	Processed         MediaInfo  `json:"processed"`
+	SizeDiff          float64    `json:"size_diff_percent"`
+	ResolutionChanged bool       `json:"resolution_changed"`
+	BitrateReduction  float64    `json:"bitrate_reduction_percent"`
+	FormatChanged     bool       `json:"format_changed"`
+	CodecChanged      bool       `json:"codec_changed"`
+	Delta             MediaDelta `json:"delta"`
+}
+
+// MediaDelta holds numeric differences between two files (processed minus original)
+type MediaDelta struct {
+	DurationSeconds float64 `json:"duration_seconds"`
+	FPS             float64 `json:"fps"`
+	BitrateBps      int64   `json:"bitrate_bps"`
+	PixelCount      int64   `json:"pixel_count"`
+	SizeBytes       int64   `json:"size_bytes"`
 }
 
 // GetMediaInfo retrieves information about a media file using ffprobe
@@ -70,188 +132,185 @@ func GetMediaInfo(filepath string) (MediaInfo, error) {
 	}
 	info.Size = fileInfo.Size()
 
-	// Run ffprobe to get detailed media information in JSON format
-	cmd := exec.Command("ffprobe",
-		"-v", "quiet",
-		"-print_format", "json",
-		"-show_format",
-		"-show_streams",
-		filepath)
-
-	output, err := cmd.Output()
+	// Run ffprobe to get detailed media information
+	probe, err := probeFile(filepath)
 	if err != nil {
-		return info, fmt.Errorf("ffprobe failed: %w", err)
-	}
-
-	// Parse JSON output
-	var ffprobeOutput struct {
-		Streams []struct {
-			CodecName  string `json:"codec_name"`
-			Width      int    `json:"width"`
-			Height     int    `json:"height"`
-			BitRate    string `json:"bit_rate"`
-			RFrameRate string `json:"r_frame_rate"`
-		} `json:"streams"`
-		Format struct {
-			Filename   string `json:"filename"`
-			FormatName string `json:"format_name"`
-			Duration   string `json:"duration"`
-			BitRate    string `json:"bit_rate"`
-		} `json:"format"`
-	}
-
-	if err := json.Unmarshal(output, &ffprobeOutput); err != nil {
-		return info, fmt.Errorf("failed to parse ffprobe output: %w", err)
-	}
-
-	// Extract video stream information
-	for _, stream := range ffprobeOutput.Streams {
-		// Only look at video streams (skip audio)
-		if stream.Width > 0 && stream.Height > 0 {
+		return info, err
+	}
+
+	for _, raw := range probe.Streams {
+		stream := newStream(raw)
+		if raw.CodecType == StreamVideo {
+			stream.HDR = detectHDR(raw, probe.frameSideData(raw.Index))
+		}
+		info.Streams = append(info.Streams, stream)
+	}
+	for _, raw := range probe.Chapters {
+		info.Chapters = append(info.Chapters, newChapter(raw))
+	}
+	info.FormatLongName = probe.Format.FormatLongName
+
+	// Report image-specific details for still image files
+	if IsImageFile(filepath) {
+		if videos := info.StreamsOfType(StreamVideo); len(videos) > 0 {
+			info.Image = newImageInfo(filepath, videos[0])
+		}
+	}
+	info.Tags = probe.Format.Tags
+
+	// Extract video stream information, skipping cover art
+	for _, stream := range info.Streams {
+		if stream.Width > 0 && stream.Height > 0 && !stream.HasDisposition("attached_pic") {
+			info.Width, info.Height = stream.Width, stream.Height
 			info.Resolution = fmt.Sprintf("%dx%d", stream.Width, stream.Height)
-			if stream.BitRate != "" {
-				info.Bitrate = stream.BitRate
+			info.BitrateBps = stream.Bitrate
+			info.Codec = stream.Codec
+			if stream.HDR != nil {
+				info.HDRType = stream.HDR.Type
 			}
-			info.Codec = stream.CodecName
-
-			// Parse framerate (often in the format "24/1")
-			if stream.RFrameRate != "" {
-				parts := strings.Split(stream.RFrameRate, "/")
-				if len(parts) == 2 {
-					numerator, denominator := parts[0], parts[1]
-					if denominator == "1" {
-						info.FrameRate = numerator + " fps"
-					} else {
-						// Calculate the framerate if denominator is not 1
-						num, err1 := strconv.ParseFloat(numerator, 64)
-						den, err2 := strconv.ParseFloat(denominator, 64)
-						if err1 == nil && err2 == nil && den > 0 {
-							fps := num / den
-							info.FrameRate = fmt.Sprintf("%.2f fps", fps)
-						} else {
-							info.FrameRate = stream.RFrameRate
-						}
-					}
-				} else {
-					info.FrameRate = stream.RFrameRate
-				}
+
+			if stream.FrameRate != nil && stream.FrameRate.Valid() {
+				info.FrameRateExact = stream.FrameRate
+				info.FPS = stream.FrameRate.Float64()
+				info.FrameRate = formatFrameRate(*stream.FrameRate)
 			}
 			break
 		}
 	}
 
 	// Extract format information
-	if ffprobeOutput.Format.FormatName != "" {
-		info.Format = ffprobeOutput.Format.FormatName
+	if probe.Format.FormatName != "" {
+		info.Format = probe.Format.FormatName
 	}
 
-	if ffprobeOutput.Format.Duration != "" {
-		info.Duration = ffprobeOutput.Format.Duration + "s"
+	if probe.Format.Duration != "" {
+		info.Duration = probe.Format.Duration + "s"
+		info.DurationSeconds = parseFloatOrZero(probe.Format.Duration)
+		info.DurationText = formatDuration(time.Duration(info.DurationSeconds * float64(time.Second)))
 	}
 
 	// Use format bitrate as fallback if stream bitrate is not available
-	if info.Bitrate == "" && ffprobeOutput.Format.BitRate != "" {
-		info.Bitrate = ffprobeOutput.Format.BitRate
+	if info.BitrateBps == 0 {
+		info.BitrateBps = parseIntOrZero(probe.Format.BitRate)
+	}
+	if info.BitrateBps > 0 {
+		info.Bitrate = strconv.FormatInt(info.BitrateBps, 10)
+		info.BitrateText = formatBitrate(info.BitrateBps)
 	}
 
 	return info, nil
 }
 
-// ProcessMedia processes a media file based on the request parameters
-func ProcessMedia(req ProcessRequest) (string, error) {
+// StreamsOfType returns the streams of the given type in file order
+func (info MediaInfo) StreamsOfType(streamType string) []Stream {
+	var streams []Stream
+	for _, stream := range info.Streams {
+		if stream.Type == streamType {
+			streams = append(streams, stream)
+		}
+	}
+	return streams
+}
+
+// DefaultOutputPrefix starts the name of process outputs written without an
+// output path
+const DefaultOutputPrefix = "processed_"
+
+// OutputPath returns the file a process request writes: the requested output,
+// or processed_<name> with the requested format's extension
+func (req ProcessRequest) OutputPath() string {
 	// Set default output if not provided
 	output := req.Output
 	if output == "" {
 		ext := ".mp4"
 		if req.Format != "" {
 			ext = "." + req.Format
+		} else if IsImageFile(req.Input) {
+			// Keep the image format unless another one is requested
+			ext = filepath.Ext(req.Input)
 		}
-		output = "processed_" + filepath.Base(req.Input)
+		output = DefaultOutputPrefix + filepath.Base(req.Input)
 		output = strings.TrimSuffix(output, filepath.Ext(output)) + ext
 	}
 
-	// Skip getting media info if it's a dry run
-	var duration time.Duration
-	if !req.DryRun {
-		// First, get the input file duration
-		inputInfo, err := GetMediaInfo(req.Input)
-		if err != nil {
-			return "", fmt.Errorf("failed to get input file info: %w", err)
-		}
-
-		// Parse duration string to time.Duration
-		if inputInfo.Duration != "" {
-			durationStr := strings.TrimSuffix(inputInfo.Duration, "s")
-			if durationFloat, err := strconv.ParseFloat(durationStr, 64); err == nil {
-				duration = time.Duration(durationFloat * float64(time.Second))
-			}
-		}
+	// Add output format if specified and not in filename
+	if req.Format != "" && filepath.Ext(output) == "" {
+		output = output + "." + req.Format
 	}
+	return output
+}
 
-	// Build ffmpeg command with global options
-	args := []string{
-		"-hide_banner",  // Hide FFmpeg banner info
-		"-y",            // Overwrite output files without asking
-		"-i", req.Input, // Input file
-		"-progress", "pipe:1", // Output progress to stdout
+// Encoders returns the ffmpeg encoders a process request needs. Image and
+// animation outputs and stream copy use no optional encoders.
+func (req ProcessRequest) Encoders() []string {
+	output := req.OutputPath()
+	if req.Codec == CodecCopy || isAnimationOutput(output) || isImageOutput(output) {
+		return nil
 	}
 
-	// Add video-specific options
-	if req.Resolution != "" {
-		args = append(args, "-s", req.Resolution)
+	var encoders []string
+	if video := videoEncoder(req); video != "" {
+		encoders = append(encoders, video)
 	}
+	return append(encoders, audioEncoder(req))
+}
 
-	if req.Bitrate != "" {
-		args = append(args, "-b:v", req.Bitrate)
-	}
+// ProcessMedia processes a media file based on the request parameters
+func ProcessMedia(req ProcessRequest) (string, error) {
+	return ProcessMediaWithProgress(req, nil)
+}
 
-	// Add codec if specified
-	if req.Codec != "" {
-		args = append(args, "-c:v", req.Codec)
-	} else if req.Format == "webm" {
-		// Use VP9 for WebM if codec not specified
-		args = append(args, "-c:v", "libvpx-vp9")
-	} else if req.Format == "mp4" {
-		// Use H.264 for MP4 if codec not specified
-		args = append(args, "-c:v", "libx264")
-	}
+// ProcessMediaWithProgress processes a media file like ProcessMedia and, if
+// onProgress is set, reports the progress of single-pass and chunked encodes to it
+func ProcessMediaWithProgress(req ProcessRequest, onProgress func(ProcessProgress)) (string, error) {
+	output := req.OutputPath()
 
-	// Add framerate if specified
-	if req.FrameRate != "" {
-		args = append(args, "-r", req.FrameRate)
+	// Stream copy only changes the container, so it bypasses the encoding pipeline
+	if req.Codec == CodecCopy {
+		return processCopy(req, output)
 	}
 
-	// Add constant rate factor (quality) if specified
-	if req.CRF != "" {
-		args = append(args, "-crf", req.CRF)
+	// Animated GIF/WebP from video (or animated GIF) input uses palette-based encoding
+	if isAnimationOutput(output) && (!IsImageFile(req.Input) || strings.EqualFold(filepath.Ext(req.Input), ".gif")) {
+		// Passthrough keeps an HDR encode, which GIF and WebP cannot hold
+		if req.HDR == HDRPassthrough {
+			return "", fmt.Errorf("HDR passthrough is not supported for animations: use %s", HDRToneMap)
+		}
+		// Crop, trim and tone mapping are resolved like for video outputs
+		if _, err := prepareProcess(&req, output); err != nil {
+			return "", err
+		}
+		return processAnimation(req, output)
 	}
 
-	// Add encoding preset if specified
-	if req.Preset != "" {
-		args = append(args, "-preset", req.Preset)
+	// Still images have their own pipeline without audio or video codec defaults
+	if IsImageFile(req.Input) && isImageOutput(output) {
+		return processImage(req, output)
 	}
 
-	// Handle audio based on format
-	if req.Format == "gif" {
-		// Remove audio for GIF
-		args = append(args, "-an")
-	} else {
-		// Maintain audio quality or use AAC for most formats
-		if req.Format == "webm" {
-			args = append(args, "-c:a", "libopus")
-		} else {
-			args = append(args, "-c:a", "aac")
+	// Analyse the input and resolve input-dependent options
+	input, err := prepareProcess(&req, output)
+	if err != nil {
+		return "", err
+	}
+	duration := input.Duration
+
+	// Split long inputs into segments encoded in parallel when that is safe;
+	// prepareProcess always reads the input when chunks are requested
+	if req.Chunks > 1 {
+		bounds, reason := planChunks(req, output, input.Info, duration)
+		if reason == "" {
+			return processChunked(req, output, input.Info, bounds, onProgress)
 		}
+		fmt.Printf("Chunked encoding not used: %s; encoding in a single pass\n", reason)
 	}
 
-	// Add output format if specified and not in filename
-	if req.Format != "" && filepath.Ext(output) == "" {
-		output = output + "." + req.Format
+	// Build ffmpeg arguments from the request
+	args, err := buildProcessArgs(req, output, input.Selected)
+	if err != nil {
+		return "", err
 	}
 
-	// Add output filename as the last argument
-	args = append(args, output)
-
 	// Build the command string
 	cmdString := fmt.Sprintf("ffmpeg %s", strings.Join(args, " "))
 
@@ -270,27 +329,45 @@ func ProcessMedia(req ProcessRequest) (string, error) {
 		return "", fmt.Errorf("failed to create output directory: %w", err)
 	}
 
+	// Run in a slot of EncodePool, shared with every other encode
+	if err := EncodePool.Run(func() error { return runEncode(args, duration, onProgress) }); err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Processing complete: %s\n", output)
+	return output, nil
+}
+
+// runEncode runs a single-pass ffmpeg encode, parsing progress from stderr
+// and including its last lines in errors
+func runEncode(args []string, duration time.Duration, onProgress func(ProcessProgress)) error {
 	// Execute ffmpeg with more detailed error and progress handling
 	cmd := exec.Command("ffmpeg", args...)
 
 	// Capture stderr to parse progress
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return "", fmt.Errorf("failed to create stderr pipe: %w", err)
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 
 	// Start the command
 	if err := cmd.Start(); err != nil {
-		return "", fmt.Errorf("failed to start ffmpeg: %w", err)
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
 	}
 
-	// Process output to get progress
+	// Process output to get progress, keeping the last lines for errors
+	var tail []string
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		scanner := bufio.NewScanner(stderr)
 		var lastProgress *FFmpegProgress
 
 		for scanner.Scan() {
 			line := scanner.Text()
+			if tail = append(tail, line); len(tail) > 20 {
+				tail = tail[1:]
+			}
 
 			// Parse progress information
 			progress := ParseProgress(line, duration)
@@ -303,17 +380,381 @@ func ProcessMedia(req ProcessRequest) (string, error) {
 				formattedProgress := FormatProgress(progress)
 				fmt.Printf("Progress: %s\n", formattedProgress)
 				lastProgress = progress
+
+				if onProgress != nil {
+					onProgress(ProcessProgress{Stage: StageEncoding, Progress: progress.Percentage, Speed: progress.Speed})
+				}
 			}
 		}
 	}()
 
-	// Wait for the command to complete
+	// Wait for the output to be read, then for the command to complete
+	<-done
 	if err := cmd.Wait(); err != nil {
-		return "", fmt.Errorf("ffmpeg processing failed: %w", err)
+		return fmt.Errorf("ffmpeg processing failed: %w\nOutput: %s", err, strings.Join(tail, "\n"))
 	}
+	return nil
+}
 
-	fmt.Printf("Processing complete: %s\n", output)
-	return output, nil
+// preparedInput is what prepareProcess read from the input
+type preparedInput struct {
+	Info     MediaInfo     // Probe of the input; empty for dry runs that do not need it
+	Duration time.Duration // Duration of the part being processed
+	Selected []Stream      // Streams chosen by the stream selection, if any
+}
+
+// prepareProcess reads what a process request needs from the input: the
+// duration for progress reporting, selected streams, and the auto crop,
+// auto trim and HDR settings. Analyses that only read the input also run
+// for dry runs.
+func prepareProcess(req *ProcessRequest, output string) (preparedInput, error) {
+	var input preparedInput
+
+	// Skip getting media info if it's a dry run, unless streams have to be selected,
+	// the input is split into chunks or HDR handling needs the input's HDR format
+	var duration time.Duration
+	if !req.DryRun || req.StreamSelection.Active() || req.Chunks > 1 || needsHDRProbe(*req) {
+		// First, get the input file duration
+		inputInfo, err := GetMediaInfo(req.Input)
+		if err != nil {
+			return input, fmt.Errorf("failed to get input file info: %w", err)
+		}
+		input.Info = inputInfo
+
+		duration = time.Duration(inputInfo.DurationSeconds * float64(time.Second))
+
+		if req.StreamSelection.Active() {
+			base := defaultProcessStreams(inputInfo.Streams, output)
+			input.Selected, err = selectStreams(req.StreamSelection, inputInfo.Streams, base)
+			if err != nil {
+				return input, err
+			}
+		}
+	}
+
+	// Detect black bars; this only reads the input so it also runs for dry runs
+	if req.AutoCrop && req.Crop == nil {
+		detected, err := DetectCrop(req.Input, DefaultCropSamples)
+		if err != nil {
+			return input, fmt.Errorf("auto crop failed: %w", err)
+		}
+		if detected.NeedsCrop && detected.Confidence >= MinCropConfidence {
+			fmt.Printf("Auto crop: %s (confidence %.0f%%)\n", detected.Crop, detected.Confidence*100)
+			req.Crop = &detected.Crop
+		}
+	}
+
+	// Detect leading and trailing silence/black; like auto crop this also runs for dry runs
+	if (req.TrimSilence || req.TrimBlack) && req.Start == 0 && req.Duration == 0 {
+		report, err := DetectSegments(DetectRequest{
+			Input:      req.Input,
+			Silence:    req.TrimSilence,
+			Black:      req.TrimBlack,
+			MinSilence: DefaultMinTrimDuration,
+			MinBlack:   DefaultMinTrimDuration,
+		})
+		if err != nil {
+			return input, fmt.Errorf("trim detection failed: %w", err)
+		}
+		req.Start, req.Duration = trimWindow(report, req.TrimSilence, req.TrimBlack)
+		if req.Start > 0 || req.Duration > 0 {
+			fmt.Printf("Auto trim: start %.3fs, duration %.3fs\n", req.Start, req.Duration)
+		}
+	}
+
+	// Resolve HDR handling against the input; this also runs for dry runs
+	if req.HDR != "" {
+		if err := resolveHDR(req, input.Info); err != nil {
+			return input, err
+		}
+	}
+
+	if req.Start < 0 || req.Duration < 0 {
+		return input, fmt.Errorf("start and duration must not be negative")
+	}
+
+	// Progress is measured against the part of the input being processed
+	if req.Duration > 0 {
+		duration = time.Duration(req.Duration * float64(time.Second))
+	} else if req.Start > 0 && duration > 0 {
+		duration -= time.Duration(req.Start * float64(time.Second))
+	}
+
+	input.Duration = duration
+	return input, nil
+}
+
+// buildProcessArgs builds the ffmpeg argument list for a process request.
+// Selected streams are mapped explicitly; without them ffmpeg's default
+// stream selection is used.
+func buildProcessArgs(req ProcessRequest, output string, selected []Stream) ([]string, error) {
+	// Build ffmpeg command with global options
+	args := []string{
+		"-hide_banner", // Hide FFmpeg banner info
+		"-y",           // Overwrite output files without asking
+	}
+
+	// Seek on the input so trimming does not decode the skipped part
+	if req.Start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(req.Start, 'f', 3, 64))
+	}
+
+	args = append(args,
+		"-i", req.Input, // Input file
+		"-progress", "pipe:1", // Output progress to stdout
+	)
+
+	if req.Duration > 0 {
+		args = append(args, "-t", strconv.FormatFloat(req.Duration, 'f', 3, 64))
+	}
+
+	// Add video filters (crop, tone mapping, resize, frame rate, pixel format)
+	videoInput := "0:v:0"
+	for _, stream := range selected {
+		if stream.Type == StreamVideo && !stream.HasDisposition("attached_pic") {
+			videoInput = fmt.Sprintf("0:%d", stream.Index)
+			break
+		}
+	}
+	graph, err := buildVideoFilters(req, videoInput)
+	if err != nil {
+		return nil, err
+	}
+	var mapArgs []string
+	if len(selected) > 0 {
+		if !graph.Empty() {
+			args = append(args, "-filter_complex", graph.String())
+		}
+		mapArgs, err = streamMapArgs(req.StreamSelection, selected, !graph.Empty(), output)
+		if err != nil {
+			return nil, err
+		}
+	} else if !graph.Empty() {
+		// Keep the first audio track when present, like ffmpeg's default selection
+		args = append(args, "-filter_complex", graph.String(), "-map", "[vout]", "-map", "0:a:0?")
+	}
+
+	encoder, err := encoderArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	// Per-stream codecs from the stream map follow the encoder so they override it
+	args = append(args, encoder...)
+	args = append(args, mapArgs...)
+
+	// Add output filename as the last argument
+	args = append(args, output)
+
+	return args, nil
+}
+
+// encoderArgs returns the video and audio encoder options for a process request
+func encoderArgs(req ProcessRequest) ([]string, error) {
+	args, err := videoEncoderArgs(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Maintain audio quality or use AAC for most formats
+	return append(args, "-c:a", audioEncoder(req)), nil
+}
+
+// videoEncoderArgs returns the video encoder options for a process request
+func videoEncoderArgs(req ProcessRequest) ([]string, error) {
+	var args []string
+
+	if req.Bitrate != "" {
+		args = append(args, "-b:v", req.Bitrate)
+	}
+
+	// Add codec if specified
+	if req.HDR == HDRPassthrough {
+		// Only libx265 can carry HDR10 metadata through the x265-params interface
+		if req.Codec != "" && req.Codec != "libx265" {
+			return nil, fmt.Errorf("HDR passthrough requires libx265, got '%s'", req.Codec)
+		}
+		if err := checkPassthroughContainer(req); err != nil {
+			return nil, err
+		}
+		args = append(args, "-c:v", "libx265")
+		if req.PixelFormat == "" {
+			args = append(args, "-pix_fmt", "yuv420p10le")
+		}
+		args = append(args, hdrPassthroughArgs(req.HDRMetadata)...)
+	} else if req.Codec != "" {
+		args = append(args, "-c:v", req.Codec)
+	} else if req.Format == "webm" {
+		// Use VP9 for WebM if codec not specified
+		args = append(args, "-c:v", "libvpx-vp9")
+	} else if req.Format == "mp4" {
+		// Use H.264 for MP4 if codec not specified
+		args = append(args, "-c:v", "libx264")
+	}
+
+	// Add constant rate factor (quality) if specified
+	if req.CRF != "" {
+		args = append(args, "-crf", req.CRF)
+	}
+
+	// Add encoding preset if specified
+	if req.Preset != "" {
+		args = append(args, "-preset", req.Preset)
+	}
+
+	return args, nil
+}
+
+// audioEncoder returns the audio encoder for a process request's format
+func audioEncoder(req ProcessRequest) string {
+	if req.Format == "webm" {
+		return "libopus"
+	}
+	return "aac"
+}
+
+// buildVideoFilters builds the video filter graph for a process request.
+// The graph reads the given input stream and writes to the [vout] pad.
+func buildVideoFilters(req ProcessRequest, input string) (*FilterGraph, error) {
+	graph := NewFilterGraph()
+	chain := graph.Chain(input).Output("vout")
+
+	source, err := sourceFilters(req)
+	if err != nil {
+		return nil, err
+	}
+	chain.Add(source...)
+
+	rendition, err := renditionFilters(req)
+	if err != nil {
+		return nil, err
+	}
+	chain.Add(rendition...)
+
+	if graph.Empty() {
+		return graph, nil
+	}
+	if err := graph.Validate(); err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+// sourceFilters returns the filters that correct the source picture: crop
+// and tone mapping
+func sourceFilters(req ProcessRequest) ([]*Filter, error) {
+	filters, err := cropFilters(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.HDR == HDRToneMap {
+		toneMap, err := toneMapFilters(req.ToneMap)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, toneMap...)
+	}
+
+	return filters, nil
+}
+
+// renditionFilters returns the filters that shape an output rendition:
+// resize, frame rate and pixel format
+func renditionFilters(req ProcessRequest) ([]*Filter, error) {
+	filters, err := resizeFilters(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.FrameRate != "" {
+		if _, err := parseFrameRate(req.FrameRate); err != nil {
+			return nil, err
+		}
+		filters = append(filters, NewFilter("fps").Set("fps", req.FrameRate))
+	}
+
+	if req.PixelFormat != "" {
+		filters = append(filters, NewFilter("format").Set("pix_fmts", req.PixelFormat))
+	}
+
+	return filters, nil
+}
+
+// cropFilters returns the crop filter for the request's crop rectangle, if any
+func cropFilters(req ProcessRequest) ([]*Filter, error) {
+	if req.Crop == nil {
+		return nil, nil
+	}
+	if req.Crop.Width <= 0 || req.Crop.Height <= 0 || req.Crop.X < 0 || req.Crop.Y < 0 {
+		return nil, fmt.Errorf("invalid crop rectangle %s", req.Crop)
+	}
+
+	return []*Filter{NewFilter("crop").
+		Set("w", strconv.Itoa(req.Crop.Width)).
+		Set("h", strconv.Itoa(req.Crop.Height)).
+		Set("x", strconv.Itoa(req.Crop.X)).
+		Set("y", strconv.Itoa(req.Crop.Y)),
+	}, nil
+}
+
+// needsHDRProbe reports whether resolveHDR needs the input's media info,
+// which is the case unless passthrough metadata was given
+func needsHDRProbe(req ProcessRequest) bool {
+	return req.HDR != "" && !(req.HDR == HDRPassthrough && req.HDRMetadata != nil)
+}
+
+// resolveHDR validates the HDR mode and takes HDR metadata from the probed
+// input. Tone mapping is skipped for SDR inputs since there is nothing to map.
+func resolveHDR(req *ProcessRequest, info MediaInfo) error {
+	if req.HDR != HDRToneMap && req.HDR != HDRPassthrough {
+		return fmt.Errorf("invalid hdr mode '%s': must be %s or %s", req.HDR, HDRToneMap, HDRPassthrough)
+	}
+	if req.HDR == HDRPassthrough {
+		if err := checkPassthroughContainer(*req); err != nil {
+			return err
+		}
+		if req.HDRMetadata != nil {
+			return nil
+		}
+	}
+
+	var hdr *HDRInfo
+	for _, stream := range info.StreamsOfType(StreamVideo) {
+		if !stream.HasDisposition("attached_pic") {
+			hdr = stream.HDR
+			break
+		}
+	}
+
+	if hdr == nil {
+		if req.HDR == HDRPassthrough {
+			return fmt.Errorf("HDR passthrough requested but %s is not HDR", req.Input)
+		}
+		fmt.Printf("Input is not HDR, skipping tone mapping\n")
+		req.HDR = ""
+		return nil
+	}
+
+	if req.HDR == HDRPassthrough {
+		req.HDRMetadata = hdr
+	}
+	return nil
+}
+
+// parseResolution parses a WIDTHxHEIGHT string such as 1280x720
+func parseResolution(resolution string) (int, int, error) {
+	parts := strings.Split(strings.ToLower(resolution), "x")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid resolution '%s': expected WIDTHxHEIGHT", resolution)
+	}
+
+	width, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	height, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid resolution '%s': expected WIDTHxHEIGHT", resolution)
+	}
+
+	return width, height, nil
 }
 
 // CompareMedia compares original and processed media files
@@ -332,10 +773,7 @@ func CompareMedia(original, processed string) (CompareResult, error) {
 	}
 
 	// Calculate size difference percentage
-	originalSize := float64(originalInfo.Size)
-	processedSize := float64(processedInfo.Size)
-
-	sizeDiff := ((originalSize - processedSize) / originalSize) * 100
+	result.SizeDiff = percentReduction(float64(originalInfo.Size), float64(processedInfo.Size))
 
 	// Determine if resolution changed
 	result.ResolutionChanged = originalInfo.Resolution != processedInfo.Resolution
@@ -347,22 +785,21 @@ func CompareMedia(original, processed string) (CompareResult, error) {
 	result.CodecChanged = originalInfo.Codec != processedInfo.Codec
 
 	// Calculate bitrate reduction if available
-	if originalInfo.Bitrate != "" && processedInfo.Bitrate != "" {
-		// Parse bitrate values (removing units like 'kb/s')
-		originalBitrateStr := strings.TrimRight(originalInfo.Bitrate, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ /")
-		processedBitrateStr := strings.TrimRight(processedInfo.Bitrate, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ /")
-
-		originalBitrateVal, err1 := strconv.ParseFloat(originalBitrateStr, 64)
-		processedBitrateVal, err2 := strconv.ParseFloat(processedBitrateStr, 64)
+	if originalInfo.BitrateBps > 0 && processedInfo.BitrateBps > 0 {
+		result.BitrateReduction = percentReduction(float64(originalInfo.BitrateBps), float64(processedInfo.BitrateBps))
+	}
 
-		if err1 == nil && err2 == nil && originalBitrateVal > 0 {
-			result.BitrateReduction = ((originalBitrateVal - processedBitrateVal) / originalBitrateVal) * 100
-		}
+	// Numeric deltas (processed minus original)
+	result.Delta = MediaDelta{
+		DurationSeconds: processedInfo.DurationSeconds - originalInfo.DurationSeconds,
+		FPS:             processedInfo.FPS - originalInfo.FPS,
+		BitrateBps:      processedInfo.BitrateBps - originalInfo.BitrateBps,
+		PixelCount:      int64(processedInfo.Width*processedInfo.Height) - int64(originalInfo.Width*originalInfo.Height),
+		SizeBytes:       processedInfo.Size - originalInfo.Size,
 	}
 
 	result.Original = originalInfo
 	result.Processed = processedInfo
-	result.SizeDiff = sizeDiff
 
 	return result, nil
 }
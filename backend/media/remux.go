@@ -0,0 +1,358 @@
+package media
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Stream actions reported by a remux
+const (
+	RemuxCopy      = "copy"
+	RemuxTranscode = "transcode"
+	RemuxDrop      = "drop"
+)
+
+// CodecCopy is the ProcessRequest codec that copies streams without re-encoding
+const CodecCopy = "copy"
+
+// containerSupport describes which codecs a container can hold and which
+// encoders are used for streams it cannot. A nil codec list accepts any codec;
+// an empty encoder means incompatible streams of that type are dropped.
+type containerSupport struct {
+	Video, Audio, Subtitle                      []string
+	VideoEncoder, AudioEncoder, SubtitleEncoder string
+	CoverArt                                    bool // Attached pictures can be kept
+	Attachments                                 bool // Font and other attachments can be kept
+	Data                                        bool // Data streams such as timecode can be kept
+	Faststart                                   bool // Move the index to the front for streaming
+}
+
+// mp4Support is shared by the MP4 family of containers
+var mp4Support = containerSupport{
+	Video:           []string{"h264", "hevc", "av1", "vp9", "mpeg4", "mpeg2video"},
+	Audio:           []string{"aac", "mp3", "ac3", "eac3", "alac", "opus", "flac"},
+	Subtitle:        []string{"mov_text"},
+	VideoEncoder:    "libx264",
+	AudioEncoder:    "aac",
+	SubtitleEncoder: "mov_text",
+	CoverArt:        true,
+	Data:            true,
+	Faststart:       true,
+}
+
+// containers maps output extensions to their codec support
+var containers = map[string]containerSupport{
+	".mp4": mp4Support,
+	".m4v": mp4Support,
+	".mov": {
+		Video:           []string{"h264", "hevc", "mpeg4", "mpeg2video", "prores", "mjpeg", "dnxhd"},
+		Audio:           []string{"aac", "mp3", "ac3", "eac3", "alac", "pcm_s16le", "pcm_s24le"},
+		Subtitle:        []string{"mov_text"},
+		VideoEncoder:    "libx264",
+		AudioEncoder:    "aac",
+		SubtitleEncoder: "mov_text",
+		CoverArt:        true,
+		Data:            true,
+		Faststart:       true,
+	},
+	".mkv": {
+		CoverArt:    true,
+		Attachments: true,
+	},
+	".webm": {
+		Video:           []string{"vp8", "vp9", "av1"},
+		Audio:           []string{"opus", "vorbis"},
+		Subtitle:        []string{"webvtt"},
+		VideoEncoder:    "libvpx-vp9",
+		AudioEncoder:    "libopus",
+		SubtitleEncoder: "webvtt",
+	},
+	".ts": {
+		Video:        []string{"h264", "hevc", "mpeg2video"},
+		Audio:        []string{"aac", "mp3", "mp2", "ac3", "eac3"},
+		Subtitle:     []string{"dvb_subtitle"},
+		VideoEncoder: "libx264",
+		AudioEncoder: "aac",
+		Data:         true,
+	},
+}
+
+// textSubtitleCodecs lists subtitle codecs that can be converted between formats
+var textSubtitleCodecs = []string{"subrip", "srt", "ass", "ssa", "webvtt", "mov_text", "text"}
+
+// RemuxRequest represents a request to change container without re-encoding
+type RemuxRequest struct {
+	Input    string  `json:"input"`
+	Output   string  `json:"output,omitempty"`
+	Format   string  `json:"format,omitempty"`   // Target container when output has no extension (default mp4)
+	Start    float64 `json:"start,omitempty"`    // Seconds; snaps to the previous keyframe when copying
+	Duration float64 `json:"duration,omitempty"` // Seconds
+	DryRun   bool    `json:"dry_run,omitempty"`
+
+	StreamSelection // Without selectors every stream the container can hold is kept
+}
+
+// RemuxStream describes what a remux does with one input stream
+type RemuxStream struct {
+	Index   int    `json:"index"`
+	Type    string `json:"type"`
+	Codec   string `json:"codec"`
+	Action  string `json:"action"` // copy, transcode or drop
+	Encoder string `json:"encoder,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// RemuxResult represents the result of a remux
+type RemuxResult struct {
+	Filename   string        `json:"filename"`
+	Output     string        `json:"output"`
+	Command    string        `json:"command"`
+	Streams    []RemuxStream `json:"streams"`
+	Transcoded bool          `json:"transcoded"` // At least one stream was re-encoded
+	DryRun     bool          `json:"dry_run,omitempty"`
+}
+
+// Remux copies streams into a new container. Streams the container cannot
+// hold are transcoded to its default codec, or dropped when no conversion
+// exists. Probing runs for dry runs as well so the plan can be inspected.
+func Remux(req RemuxRequest) (RemuxResult, error) {
+	result := RemuxResult{Filename: req.Input, DryRun: req.DryRun}
+
+	if req.Start < 0 || req.Duration < 0 {
+		return result, fmt.Errorf("start and duration must not be negative")
+	}
+
+	format := req.Format
+	if format == "" {
+		format = "mp4"
+	}
+	output := req.Output
+	if output == "" {
+		output = "remuxed_" + filepath.Base(req.Input)
+		output = strings.TrimSuffix(output, filepath.Ext(output)) + "." + format
+	} else if filepath.Ext(output) == "" {
+		output = output + "." + format
+	}
+	result.Output = output
+
+	ext := strings.ToLower(filepath.Ext(output))
+	support, ok := containers[ext]
+	if !ok {
+		return result, fmt.Errorf("unsupported container '%s' for remux", ext)
+	}
+
+	probe, err := probeFile(req.Input)
+	if err != nil {
+		return result, fmt.Errorf("failed to probe input: %w", err)
+	}
+
+	args := []string{"-hide_banner", "-y"}
+	if req.Start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(req.Start, 'f', 3, 64))
+	}
+	args = append(args, "-i", req.Input)
+	if req.Duration > 0 {
+		args = append(args, "-t", strconv.FormatFloat(req.Duration, 'f', 3, 64))
+	}
+
+	streams := make([]Stream, 0, len(probe.Streams))
+	for _, raw := range probe.Streams {
+		streams = append(streams, newStream(raw))
+	}
+	selected := streams
+	if req.StreamSelection.Active() {
+		if selected, err = selectStreams(req.StreamSelection, streams, streams); err != nil {
+			return result, err
+		}
+	}
+	kept := make(map[int]bool)
+	for _, stream := range selected {
+		kept[stream.Index] = true
+	}
+
+	out := 0
+	outputIndex := make(map[int]int)
+	for _, input := range streams {
+		if !kept[input.Index] {
+			result.Streams = append(result.Streams, RemuxStream{
+				Index:  input.Index,
+				Type:   input.Type,
+				Codec:  input.Codec,
+				Action: RemuxDrop,
+				Reason: "not selected",
+			})
+			continue
+		}
+
+		stream := planRemuxStream(input, support, ext)
+		result.Streams = append(result.Streams, stream)
+		if stream.Action == RemuxDrop {
+			continue
+		}
+		outputIndex[stream.Index] = out
+
+		spec := strconv.Itoa(out)
+		args = append(args, "-map", fmt.Sprintf("0:%d", stream.Index))
+		if stream.Action == RemuxCopy {
+			args = append(args, "-c:"+spec, "copy")
+			// Apple players only accept HEVC in MP4/MOV with the hvc1 tag
+			if stream.Codec == "hevc" && support.Faststart {
+				args = append(args, "-tag:"+spec, "hvc1")
+			}
+		} else {
+			args = append(args, "-c:"+spec, stream.Encoder)
+			result.Transcoded = true
+		}
+		out++
+	}
+	if out == 0 {
+		return result, fmt.Errorf("no streams of %s can be stored in %s", req.Input, ext)
+	}
+	for _, opts := range req.StreamOptions {
+		if _, ok := outputIndex[opts.Index]; !ok {
+			return result, fmt.Errorf("stream options for stream %d, which cannot be stored in %s", opts.Index, ext)
+		}
+	}
+	args = append(args, streamOptionArgs(req.StreamOptions, outputIndex)...)
+
+	if support.Faststart {
+		args = append(args, "-movflags", "+faststart")
+	}
+	args = append(args, output)
+
+	result.Command = fmt.Sprintf("ffmpeg %s", strings.Join(args, " "))
+	fmt.Printf("Executing: %s\n", result.Command)
+
+	if req.DryRun {
+		fmt.Printf("[Dry Run] %s\n", result.Command)
+		return result, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return result, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	cmd := exec.Command("ffmpeg", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return result, fmt.Errorf("remux failed: %w\nOutput: %s", err, string(out))
+	}
+
+	fmt.Printf("Remux complete: %s\n", output)
+	return result, nil
+}
+
+// processCopy handles a process request with codec "copy" by remuxing. Options
+// that need decoded frames cannot be combined with stream copy.
+func processCopy(req ProcessRequest, output string) (string, error) {
+	if err := checkCopyOptions(req); err != nil {
+		return "", err
+	}
+
+	result, err := Remux(RemuxRequest{
+		Input:           req.Input,
+		Output:          output,
+		Start:           req.Start,
+		Duration:        req.Duration,
+		DryRun:          req.DryRun,
+		StreamSelection: req.StreamSelection,
+	})
+	if err != nil {
+		return "", err
+	}
+	if req.DryRun {
+		return result.Command, nil
+	}
+	return result.Output, nil
+}
+
+// checkCopyOptions rejects process options that cannot be combined with
+// stream copy
+func checkCopyOptions(req ProcessRequest) error {
+	var conflicts []string
+	check := func(set bool, name string) {
+		if set {
+			conflicts = append(conflicts, name)
+		}
+	}
+	check(req.Resolution != "" || req.Width > 0 || req.Height > 0, "resize")
+	check(req.Crop != nil || req.AutoCrop, "crop")
+	check(req.FrameRate != "", "frame_rate")
+	check(req.PixelFormat != "", "pixel_format")
+	check(req.Bitrate != "" || req.CRF != "" || req.Preset != "", "bitrate/crf/preset")
+	check(req.HDR != "", "hdr")
+	check(req.TrimSilence || req.TrimBlack, "trim_silence/trim_black")
+	if len(conflicts) > 0 {
+		return fmt.Errorf("codec copy cannot be combined with %s", strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// planRemuxStream decides whether a stream is copied, transcoded or dropped
+func planRemuxStream(stream Stream, support containerSupport, ext string) RemuxStream {
+	plan := RemuxStream{Index: stream.Index, Type: stream.Type, Codec: stream.Codec, Action: RemuxCopy}
+
+	drop := func(reason string) RemuxStream {
+		plan.Action = RemuxDrop
+		plan.Reason = reason
+		return plan
+	}
+	transcode := func(encoder string) RemuxStream {
+		plan.Action = RemuxTranscode
+		plan.Encoder = encoder
+		plan.Reason = fmt.Sprintf("%s is not supported in %s", stream.Codec, ext)
+		return plan
+	}
+
+	switch stream.Type {
+	case StreamVideo:
+		if stream.HasDisposition("attached_pic") {
+			if !support.CoverArt {
+				return drop("cover art is not supported in " + ext)
+			}
+			return plan
+		}
+		if accepts(support.Video, stream.Codec) {
+			return plan
+		}
+		return transcode(support.VideoEncoder)
+
+	case StreamAudio:
+		if accepts(support.Audio, stream.Codec) {
+			return plan
+		}
+		return transcode(support.AudioEncoder)
+
+	case StreamSubtitle:
+		if accepts(support.Subtitle, stream.Codec) {
+			return plan
+		}
+		if support.SubtitleEncoder == "" || !slices.Contains(textSubtitleCodecs, stream.Codec) {
+			return drop(fmt.Sprintf("%s subtitles cannot be stored in %s", stream.Codec, ext))
+		}
+		return transcode(support.SubtitleEncoder)
+
+	case StreamData:
+		if !support.Data {
+			return drop("data streams are not supported in " + ext)
+		}
+		return plan
+
+	case StreamAttachment:
+		if !support.Attachments {
+			return drop("attachments are not supported in " + ext)
+		}
+		return plan
+	}
+
+	return drop(fmt.Sprintf("%s streams are not remuxed", stream.Type))
+}
+
+// accepts reports whether a codec list (nil meaning any codec) contains a codec
+func accepts(codecs []string, codec string) bool {
+	return codecs == nil || slices.Contains(codecs, codec)
+}
@@ -0,0 +1,94 @@
+package media
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanRemuxStream(t *testing.T) {
+	video := Stream{Index: 0, Type: StreamVideo, Codec: "h264"}
+	cover := Stream{Index: 3, Type: StreamVideo, Codec: "mjpeg", Disposition: []string{"attached_pic"}}
+
+	tests := []struct {
+		name   string
+		stream Stream
+		ext    string
+		want   RemuxStream
+	}{
+		{
+			name:   "h264 into mp4 is copied",
+			stream: video,
+			ext:    ".mp4",
+			want:   RemuxStream{Index: 0, Type: StreamVideo, Codec: "h264", Action: RemuxCopy},
+		},
+		{
+			name:   "h264 into webm is transcoded",
+			stream: video,
+			ext:    ".webm",
+			want:   RemuxStream{Index: 0, Type: StreamVideo, Codec: "h264", Action: RemuxTranscode, Encoder: "libvpx-vp9", Reason: "h264 is not supported in .webm"},
+		},
+		{
+			name:   "anything into mkv is copied",
+			stream: Stream{Index: 1, Type: StreamAudio, Codec: "truehd"},
+			ext:    ".mkv",
+			want:   RemuxStream{Index: 1, Type: StreamAudio, Codec: "truehd", Action: RemuxCopy},
+		},
+		{
+			name:   "pcm into mp4 is transcoded to aac",
+			stream: Stream{Index: 1, Type: StreamAudio, Codec: "pcm_s16le"},
+			ext:    ".mp4",
+			want:   RemuxStream{Index: 1, Type: StreamAudio, Codec: "pcm_s16le", Action: RemuxTranscode, Encoder: "aac", Reason: "pcm_s16le is not supported in .mp4"},
+		},
+		{
+			name:   "subrip into mp4 becomes mov_text",
+			stream: Stream{Index: 2, Type: StreamSubtitle, Codec: "subrip"},
+			ext:    ".mp4",
+			want:   RemuxStream{Index: 2, Type: StreamSubtitle, Codec: "subrip", Action: RemuxTranscode, Encoder: "mov_text", Reason: "subrip is not supported in .mp4"},
+		},
+		{
+			name:   "bitmap subtitles into mp4 are dropped",
+			stream: Stream{Index: 2, Type: StreamSubtitle, Codec: "hdmv_pgs_subtitle"},
+			ext:    ".mp4",
+			want:   RemuxStream{Index: 2, Type: StreamSubtitle, Codec: "hdmv_pgs_subtitle", Action: RemuxDrop, Reason: "hdmv_pgs_subtitle subtitles cannot be stored in .mp4"},
+		},
+		{
+			name:   "cover art into mp4 is copied",
+			stream: cover,
+			ext:    ".mp4",
+			want:   RemuxStream{Index: 3, Type: StreamVideo, Codec: "mjpeg", Action: RemuxCopy},
+		},
+		{
+			name:   "cover art into webm is dropped",
+			stream: cover,
+			ext:    ".webm",
+			want:   RemuxStream{Index: 3, Type: StreamVideo, Codec: "mjpeg", Action: RemuxDrop, Reason: "cover art is not supported in .webm"},
+		},
+		{
+			name:   "attachments into mp4 are dropped",
+			stream: Stream{Index: 4, Type: StreamAttachment, Codec: "ttf"},
+			ext:    ".mp4",
+			want:   RemuxStream{Index: 4, Type: StreamAttachment, Codec: "ttf", Action: RemuxDrop, Reason: "attachments are not supported in .mp4"},
+		},
+		{
+			name:   "data into mov is copied",
+			stream: Stream{Index: 5, Type: StreamData, Codec: "tmcd"},
+			ext:    ".mov",
+			want:   RemuxStream{Index: 5, Type: StreamData, Codec: "tmcd", Action: RemuxCopy},
+		},
+		{
+			name:   "data into webm is dropped",
+			stream: Stream{Index: 5, Type: StreamData, Codec: "tmcd"},
+			ext:    ".webm",
+			want:   RemuxStream{Index: 5, Type: StreamData, Codec: "tmcd", Action: RemuxDrop, Reason: "data streams are not supported in .webm"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := planRemuxStream(tt.stream, containers[tt.ext], tt.ext)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planRemuxStream() = %+v\nwant                %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package media
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Resize modes supported by ProcessRequest.ResizeMode
+const (
+	ResizeFit     = "fit"     // Scale inside the box and pad the remainder
+	ResizeFill    = "fill"    // Scale to cover the box and center crop the overflow
+	ResizeStretch = "stretch" // Scale to the exact box ignoring aspect ratio
+)
+
+// DefaultPadColor is used for letterboxing when no pad color is given
+const DefaultPadColor = "black"
+
+// resizeTarget resolves the requested output dimensions from the request,
+// rounded to even sizes for video encoders. A zero dimension means "derive
+// from the aspect ratio".
+func resizeTarget(req ProcessRequest) (int, int, error) {
+	width, height, err := requestedSize(req)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Encoders like libx264 reject odd dimensions with 4:2:0 chroma subsampling
+	return evenDimension(width), evenDimension(height), nil
+}
+
+// requestedSize returns the width and height or resolution of the request
+func requestedSize(req ProcessRequest) (int, int, error) {
+	width, height := req.Width, req.Height
+	if req.Resolution != "" {
+		if width != 0 || height != 0 {
+			return 0, 0, fmt.Errorf("resolution cannot be combined with width or height")
+		}
+		w, h, err := parseResolution(req.Resolution)
+		if err != nil {
+			return 0, 0, err
+		}
+		width, height = w, h
+	}
+
+	if width < 0 || height < 0 {
+		return 0, 0, fmt.Errorf("invalid dimensions %dx%d: must not be negative", width, height)
+	}
+	return width, height, nil
+}
+
+// resizeMode returns the request's resize mode, fit by default
+func resizeMode(req ProcessRequest) (string, error) {
+	mode := req.ResizeMode
+	if mode == "" {
+		mode = ResizeFit
+	}
+	if mode != ResizeFit && mode != ResizeFill && mode != ResizeStretch {
+		return "", fmt.Errorf("invalid resize mode '%s': must be %s, %s or %s", mode, ResizeFit, ResizeFill, ResizeStretch)
+	}
+	return mode, nil
+}
+
+// resizeFilters builds the filters that resize the first video stream.
+// Rotation metadata is applied by ffmpeg's autorotate before the graph,
+// so the filters below always see the display orientation.
+func resizeFilters(req ProcessRequest) ([]*Filter, error) {
+	width, height, err := resizeTarget(req)
+	if err != nil {
+		return nil, err
+	}
+	if width == 0 && height == 0 {
+		return nil, nil
+	}
+
+	mode, err := resizeMode(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var filters []*Filter
+
+	// Bring non-square pixels to square so aspect ratio math uses display size
+	if mode != ResizeStretch || width == 0 || height == 0 {
+		filters = append(filters,
+			NewFilter("scale").Set("w", "trunc(iw*sar/2)*2").Set("h", "ih"),
+			NewFilter("setsar", "1"),
+		)
+	}
+
+	// Only one dimension given: keep aspect ratio and round the other to even
+	if width == 0 || height == 0 {
+		w, h := "-2", "-2"
+		if width > 0 {
+			w = boundedDimension(width, "iw", req.NoUpscale)
+		}
+		if height > 0 {
+			h = boundedDimension(height, "ih", req.NoUpscale)
+		}
+		filters = append(filters, NewFilter("scale").Set("w", w).Set("h", h))
+		return append(filters, NewFilter("setsar", "1")), nil
+	}
+
+	boxW := boundedDimension(width, "iw", req.NoUpscale)
+	boxH := boundedDimension(height, "ih", req.NoUpscale)
+
+	switch mode {
+	case ResizeStretch:
+		filters = append(filters, NewFilter("scale").Set("w", boxW).Set("h", boxH))
+
+	case ResizeFit:
+		padColor := req.PadColor
+		if padColor == "" {
+			padColor = DefaultPadColor
+		}
+		filters = append(filters,
+			NewFilter("scale").
+				Set("w", boxW).
+				Set("h", boxH).
+				Set("force_original_aspect_ratio", "decrease").
+				Set("force_divisible_by", "2"),
+			NewFilter("pad").
+				Set("w", strconv.Itoa(width)).
+				Set("h", strconv.Itoa(height)).
+				Set("x", "(ow-iw)/2").
+				Set("y", "(oh-ih)/2").
+				Set("color", padColor),
+		)
+
+	case ResizeFill:
+		// Crop is centered by default
+		crop := NewFilter("crop").
+			Set("w", boundedDimension(width, "iw", true)).
+			Set("h", boundedDimension(height, "ih", true))
+		if req.NoUpscale {
+			// A source smaller than the box is not enlarged to cover it, so
+			// crop the largest area of the box's shape instead
+			cropW, cropH := aspectCrop(width, height)
+			crop = NewFilter("crop").
+				Set("w", fmt.Sprintf("trunc(%s/2)*2", cropW)).
+				Set("h", fmt.Sprintf("trunc(%s/2)*2", cropH))
+		}
+		filters = append(filters,
+			NewFilter("scale").
+				Set("w", boxW).
+				Set("h", boxH).
+				Set("force_original_aspect_ratio", "increase").
+				Set("force_divisible_by", "2"),
+			crop,
+		)
+	}
+
+	return append(filters, NewFilter("setsar", "1")), nil
+}
+
+// boundedDimension returns a scale expression for size, optionally capped by
+// the input dimension so the picture is never enlarged
+func boundedDimension(size int, input string, noUpscale bool) string {
+	if !noUpscale {
+		return strconv.Itoa(size)
+	}
+	return fmt.Sprintf("trunc(min(%d,%s)/2)*2", size, input)
+}
+
+// aspectCrop returns crop size expressions for the largest area with the
+// aspect ratio of width:height that fits in the input
+func aspectCrop(width, height int) (string, string) {
+	return fmt.Sprintf("min(iw,ih*%d/%d)", width, height), fmt.Sprintf("min(ih,iw*%d/%d)", height, width)
+}
+
+// evenDimension rounds a dimension down to the nearest even number (minimum 2)
+func evenDimension(size int) int {
+	if size == 1 {
+		return 2
+	}
+	return size &^ 1
+}
@@ -0,0 +1,96 @@
+package media
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResizeFilters(t *testing.T) {
+	const square = "scale=w=trunc(iw*sar/2)*2:h=ih,setsar=1"
+
+	tests := []struct {
+		name    string
+		req     ProcessRequest
+		want    string
+		wantErr string
+	}{
+		{name: "no resize", req: ProcessRequest{}, want: ""},
+		{
+			name: "width only",
+			req:  ProcessRequest{Width: 1280},
+			want: square + ",scale=w=1280:h=-2,setsar=1",
+		},
+		{
+			name: "odd height rounded to even",
+			req:  ProcessRequest{Height: 721},
+			want: square + ",scale=w=-2:h=720,setsar=1",
+		},
+		{
+			name: "width only without upscaling",
+			req:  ProcessRequest{Width: 1280, NoUpscale: true},
+			want: square + ",scale=w=trunc(min(1280\\,iw)/2)*2:h=-2,setsar=1",
+		},
+		{
+			name: "fit by default",
+			req:  ProcessRequest{Resolution: "1280x720"},
+			want: square + ",scale=w=1280:h=720:force_original_aspect_ratio=decrease:force_divisible_by=2," +
+				"pad=w=1280:h=720:x=(ow-iw)/2:y=(oh-ih)/2:color=black,setsar=1",
+		},
+		{
+			name: "fit with pad color",
+			req:  ProcessRequest{Width: 640, Height: 640, PadColor: "white"},
+			want: square + ",scale=w=640:h=640:force_original_aspect_ratio=decrease:force_divisible_by=2," +
+				"pad=w=640:h=640:x=(ow-iw)/2:y=(oh-ih)/2:color=white,setsar=1",
+		},
+		{
+			name: "fill",
+			req:  ProcessRequest{Width: 1080, Height: 1920, ResizeMode: ResizeFill},
+			want: square + ",scale=w=1080:h=1920:force_original_aspect_ratio=increase:force_divisible_by=2," +
+				"crop=w=trunc(min(1080\\,iw)/2)*2:h=trunc(min(1920\\,ih)/2)*2,setsar=1",
+		},
+		{
+			name: "fill without upscaling keeps the target shape",
+			req:  ProcessRequest{Width: 1080, Height: 1920, ResizeMode: ResizeFill, NoUpscale: true},
+			want: square + ",scale=w=trunc(min(1080\\,iw)/2)*2:h=trunc(min(1920\\,ih)/2)*2:force_original_aspect_ratio=increase:force_divisible_by=2," +
+				"crop=w=trunc(min(iw\\,ih*1080/1920)/2)*2:h=trunc(min(ih\\,iw*1920/1080)/2)*2,setsar=1",
+		},
+		{
+			name: "stretch keeps the pixel shape",
+			req:  ProcessRequest{Width: 640, Height: 480, ResizeMode: ResizeStretch},
+			want: "scale=w=640:h=480,setsar=1",
+		},
+		{
+			name:    "resolution with width",
+			req:     ProcessRequest{Resolution: "1280x720", Width: 640},
+			wantErr: "cannot be combined",
+		},
+		{name: "negative width", req: ProcessRequest{Width: -2}, wantErr: "must not be negative"},
+		{name: "unknown mode", req: ProcessRequest{Width: 640, Height: 480, ResizeMode: "zoom"}, wantErr: "invalid resize mode 'zoom'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := resizeFilters(tt.req)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			rendered := make([]string, 0, len(filters))
+			for _, filter := range filters {
+				rendered = append(rendered, filter.String())
+			}
+			if got := strings.Join(rendered, ","); got != tt.want {
+				t.Errorf("filters = %q\nwant      %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvenDimension(t *testing.T) {
+	for size, want := range map[int]int{0: 0, 1: 2, 2: 2, 3: 2, 719: 718, 720: 720} {
+		if got := evenDimension(size); got != want {
+			t.Errorf("evenDimension(%d) = %d, want %d", size, got, want)
+		}
+	}
+}
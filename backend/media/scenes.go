@@ -0,0 +1,305 @@
+package media
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Scene detection defaults and export formats
+const (
+	DefaultSceneThreshold = 0.4
+
+	SceneExportChapters = "chapters" // FFmetadata chapters, usable with -map_metadata
+	SceneExportEDL      = "edl"      // CMX3600 edit decision list
+	SceneExportCSV      = "csv"      // Comma separated values
+)
+
+// Regular expressions for parsing metadata=print output
+var (
+	scenePtsRegex   = regexp.MustCompile(`pts_time:\s*(-?\d+\.?\d*)`)
+	sceneScoreRegex = regexp.MustCompile(`lavfi\.scene_score=(\d+\.?\d*)`)
+)
+
+// SceneRequest represents a request to detect scene changes
+type SceneRequest struct {
+	Input            string  `json:"input"`
+	Threshold        float64 `json:"threshold,omitempty"`         // Scene score (0-1) above which a cut is reported
+	Export           string  `json:"export,omitempty"`            // Optional export format: chapters, edl or csv
+	ExportPath       string  `json:"export_path,omitempty"`       // Where to write the export (default next to input)
+	ExtractKeyframes bool    `json:"extract_keyframes,omitempty"` // Extract one JPEG per scene
+	KeyframeDir      string  `json:"keyframe_dir,omitempty"`      // Directory for keyframes (default next to input)
+}
+
+// Scene represents a single shot between two scene changes
+type Scene struct {
+	Index    int     `json:"index"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Duration float64 `json:"duration"`
+	Score    float64 `json:"score"` // Scene score of the cut that starts this shot (0 for the first)
+	Keyframe string  `json:"keyframe,omitempty"`
+}
+
+// SceneResult represents the result of scene detection
+type SceneResult struct {
+	Filename   string  `json:"filename"`
+	Threshold  float64 `json:"threshold"`
+	Duration   float64 `json:"duration"`
+	Scenes     []Scene `json:"scenes"`
+	ExportPath string  `json:"export_path,omitempty"`
+}
+
+// sceneCut is a detected scene change
+type sceneCut struct {
+	Time  float64
+	Score float64
+}
+
+// DetectScenes detects shot boundaries and optionally exports them
+func DetectScenes(req SceneRequest) (SceneResult, error) {
+	result := SceneResult{Filename: req.Input, Threshold: req.Threshold}
+	if result.Threshold == 0 {
+		result.Threshold = DefaultSceneThreshold
+	}
+	if result.Threshold < 0 || result.Threshold >= 1 {
+		return result, fmt.Errorf("invalid threshold %g: must be between 0 and 1", result.Threshold)
+	}
+
+	switch req.Export {
+	case "", SceneExportChapters, SceneExportEDL, SceneExportCSV:
+	default:
+		return result, fmt.Errorf("invalid export format '%s': must be %s, %s or %s", req.Export, SceneExportChapters, SceneExportEDL, SceneExportCSV)
+	}
+
+	info, err := GetMediaInfo(req.Input)
+	if err != nil {
+		return result, fmt.Errorf("failed to get media info: %w", err)
+	}
+	if info.Resolution == "" {
+		return result, fmt.Errorf("no video stream found in %s", req.Input)
+	}
+	result.Duration = info.DurationSeconds
+
+	// Run scene detection and print the score of every selected frame
+	graph := NewFilterGraph()
+	graph.Chain("0:v:0").Add(
+		NewFilter("select", fmt.Sprintf("gt(scene,%g)", result.Threshold)),
+		NewFilter("metadata").Set("mode", "print"),
+	)
+
+	cmd := exec.Command("ffmpeg",
+		"-hide_banner",
+		"-i", req.Input,
+		"-filter_complex", graph.String(),
+		"-an",
+		"-f", "null",
+		"-")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return result, fmt.Errorf("scene detection failed: %w\nOutput: %s", err, string(output))
+	}
+
+	result.Scenes = buildScenes(parseSceneCuts(string(output)), result.Duration)
+
+	base := strings.TrimSuffix(req.Input, filepath.Ext(req.Input))
+
+	if req.ExtractKeyframes {
+		dir := req.KeyframeDir
+		if dir == "" {
+			dir = base + "_scenes"
+		}
+		if err := extractSceneKeyframes(req.Input, dir, result.Scenes); err != nil {
+			return result, err
+		}
+	}
+
+	if req.Export != "" {
+		exportPath := req.ExportPath
+		if exportPath == "" {
+			exportPath = base + "_scenes" + sceneExportExt(req.Export)
+		}
+
+		var content string
+		switch req.Export {
+		case SceneExportChapters:
+			content = scenesToChapters(result.Scenes)
+		case SceneExportEDL:
+			content = scenesToEDL(result.Scenes, filepath.Base(req.Input), info.FPS)
+		case SceneExportCSV:
+			content, err = scenesToCSV(result.Scenes)
+			if err != nil {
+				return result, err
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(exportPath), 0755); err != nil {
+			return result, fmt.Errorf("failed to create export directory: %w", err)
+		}
+		if err := os.WriteFile(exportPath, []byte(content), 0644); err != nil {
+			return result, fmt.Errorf("failed to write scene export: %w", err)
+		}
+		result.ExportPath = exportPath
+	}
+
+	return result, nil
+}
+
+// parseSceneCuts extracts the time and score of each selected frame
+func parseSceneCuts(output string) []sceneCut {
+	var cuts []sceneCut
+	var current *sceneCut
+
+	for _, line := range strings.Split(output, "\n") {
+		if matches := scenePtsRegex.FindStringSubmatch(line); len(matches) > 1 {
+			t, err := strconv.ParseFloat(matches[1], 64)
+			if err != nil {
+				current = nil
+				continue
+			}
+			cuts = append(cuts, sceneCut{Time: t})
+			current = &cuts[len(cuts)-1]
+			continue
+		}
+		if matches := sceneScoreRegex.FindStringSubmatch(line); len(matches) > 1 && current != nil {
+			current.Score, _ = strconv.ParseFloat(matches[1], 64)
+		}
+	}
+
+	return cuts
+}
+
+// buildScenes turns scene cuts into consecutive scenes covering the whole file
+func buildScenes(cuts []sceneCut, duration float64) []Scene {
+	scenes := []Scene{{Index: 1, Start: 0}}
+	for _, cut := range cuts {
+		if cut.Time <= scenes[len(scenes)-1].Start {
+			continue
+		}
+		scenes = append(scenes, Scene{Index: len(scenes) + 1, Start: cut.Time, Score: cut.Score})
+	}
+
+	for i := range scenes {
+		if i+1 < len(scenes) {
+			scenes[i].End = scenes[i+1].Start
+		} else {
+			scenes[i].End = math.Max(duration, scenes[i].Start)
+		}
+		scenes[i].Duration = scenes[i].End - scenes[i].Start
+	}
+
+	return scenes
+}
+
+// extractSceneKeyframes writes a JPEG from the middle of each scene
+func extractSceneKeyframes(input, dir string, scenes []Scene) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create keyframe directory: %w", err)
+	}
+
+	for i := range scenes {
+		path := filepath.Join(dir, fmt.Sprintf("scene_%03d.jpg", scenes[i].Index))
+		midpoint := scenes[i].Start + scenes[i].Duration/2
+
+		cmd := exec.Command("ffmpeg",
+			"-hide_banner",
+			"-y",
+			"-ss", strconv.FormatFloat(midpoint, 'f', 3, 64),
+			"-i", input,
+			"-frames:v", "1",
+			"-q:v", "2",
+			path)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("keyframe extraction failed for scene %d: %w\nOutput: %s", scenes[i].Index, err, string(output))
+		}
+		scenes[i].Keyframe = path
+	}
+
+	return nil
+}
+
+// sceneExportExt returns the default file extension for an export format
+func sceneExportExt(format string) string {
+	switch format {
+	case SceneExportChapters:
+		return ".ffmetadata"
+	case SceneExportEDL:
+		return ".edl"
+	default:
+		return ".csv"
+	}
+}
+
+// scenesToChapters renders scenes as an FFmetadata chapter list
+func scenesToChapters(scenes []Scene) string {
+	chapters := make([]Chapter, 0, len(scenes))
+	for _, scene := range scenes {
+		chapters = append(chapters, Chapter{
+			ID:    int64(scene.Index),
+			Start: scene.Start,
+			End:   scene.End,
+			Title: fmt.Sprintf("Scene %d", scene.Index),
+		})
+	}
+	return chaptersToFFMetadata(chapters)
+}
+
+// scenesToEDL renders scenes as a CMX3600 edit decision list
+func scenesToEDL(scenes []Scene, clipName string, fps float64) string {
+	var sb strings.Builder
+	sb.WriteString("TITLE: " + clipName + "\n")
+	sb.WriteString("FCM: NON-DROP FRAME\n")
+
+	for i, scene := range scenes {
+		start := edlTimecode(scene.Start, fps)
+		end := edlTimecode(scene.End, fps)
+		fmt.Fprintf(&sb, "\n%03d  AX       V     C        %s %s %s %s\n", i+1, start, end, start, end)
+		sb.WriteString("* FROM CLIP NAME: " + clipName + "\n")
+	}
+	return sb.String()
+}
+
+// scenesToCSV renders scenes as CSV with a header row
+func scenesToCSV(scenes []Scene) (string, error) {
+	var sb strings.Builder
+	writer := csv.NewWriter(&sb)
+
+	records := [][]string{{"scene", "start", "end", "duration", "score", "keyframe"}}
+	for _, scene := range scenes {
+		records = append(records, []string{
+			strconv.Itoa(scene.Index),
+			strconv.FormatFloat(scene.Start, 'f', 3, 64),
+			strconv.FormatFloat(scene.End, 'f', 3, 64),
+			strconv.FormatFloat(scene.Duration, 'f', 3, 64),
+			strconv.FormatFloat(scene.Score, 'f', 4, 64),
+			scene.Keyframe,
+		})
+	}
+
+	if err := writer.WriteAll(records); err != nil {
+		return "", fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// edlTimecode formats seconds as a non-drop-frame HH:MM:SS:FF timecode
+func edlTimecode(seconds, fps float64) string {
+	rate := int64(math.Round(fps))
+	if rate <= 0 {
+		rate = 25
+	}
+
+	frames := int64(math.Round(seconds * float64(rate)))
+	h := frames / (3600 * rate)
+	m := frames / (60 * rate) % 60
+	s := frames / rate % 60
+	f := frames % rate
+
+	return fmt.Sprintf("%02d:%02d:%02d:%02d", h, m, s, f)
+}
@@ -0,0 +1,78 @@
+package media
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSceneCuts(t *testing.T) {
+	output := `frame:0    pts:48048   pts_time:2.002
+lavfi.scene_score=0.512300
+frame:1    pts:120120  pts_time:5.005
+lavfi.scene_score=0.873000
+[out#0/null @ 0x1] video:1kB audio:0kB
+frame:2    pts:240240  pts_time:10.01
+`
+
+	want := []sceneCut{
+		{Time: 2.002, Score: 0.5123},
+		{Time: 5.005, Score: 0.873},
+		{Time: 10.01},
+	}
+	if got := parseSceneCuts(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSceneCuts() = %v, want %v", got, want)
+	}
+
+	if got := parseSceneCuts("lavfi.scene_score=0.9\n"); len(got) != 0 {
+		t.Errorf("score without a frame gave cuts %v", got)
+	}
+}
+
+func TestBuildScenes(t *testing.T) {
+	cuts := []sceneCut{{Time: 0, Score: 0.9}, {Time: 4, Score: 0.5}, {Time: 4, Score: 0.6}, {Time: 9.5, Score: 0.7}}
+	want := []Scene{
+		{Index: 1, Start: 0, End: 4, Duration: 4},
+		{Index: 2, Start: 4, End: 9.5, Duration: 5.5, Score: 0.5},
+		{Index: 3, Start: 9.5, End: 12, Duration: 2.5, Score: 0.7},
+	}
+	if got := buildScenes(cuts, 12); !reflect.DeepEqual(got, want) {
+		t.Errorf("buildScenes() = %v, want %v", got, want)
+	}
+
+	if got := buildScenes(nil, 0); len(got) != 1 || got[0].End != 0 {
+		t.Errorf("buildScenes(nil, 0) = %v, want one empty scene", got)
+	}
+}
+
+func TestEDLTimecode(t *testing.T) {
+	tests := []struct {
+		seconds float64
+		fps     float64
+		want    string
+	}{
+		{0, 25, "00:00:00:00"},
+		{1.5, 24, "00:00:01:12"},
+		{3661.04, 25, "01:01:01:01"},
+		{2, 29.97, "00:00:02:00"},
+		{1, 0, "00:00:01:00"},
+	}
+
+	for _, tt := range tests {
+		if got := edlTimecode(tt.seconds, tt.fps); got != tt.want {
+			t.Errorf("edlTimecode(%v, %v) = %s, want %s", tt.seconds, tt.fps, got, tt.want)
+		}
+	}
+}
+
+func TestScenesToCSV(t *testing.T) {
+	got, err := scenesToCSV([]Scene{{Index: 1, End: 2.5, Duration: 2.5}, {Index: 2, Start: 2.5, End: 4, Duration: 1.5, Score: 0.61234, Keyframe: "a,b.jpg"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "scene,start,end,duration,score,keyframe\n" +
+		"1,0.000,2.500,2.500,0.0000,\n" +
+		"2,2.500,4.000,1.500,0.6123,\"a,b.jpg\"\n"
+	if got != want {
+		t.Errorf("scenesToCSV() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,263 @@
+package media
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// streamTypes lists the stream types accepted by StreamSelector.Type
+var streamTypes = []string{StreamVideo, StreamAudio, StreamSubtitle, StreamData, StreamAttachment}
+
+// StreamSelector matches input streams by index, type and language. Every
+// field that is set must match; stream indexes are those reported by GetMediaInfo.
+type StreamSelector struct {
+	Index    *int   `json:"index,omitempty"`    // Input stream index
+	Type     string `json:"type,omitempty"`     // video, audio, subtitle, data or attachment
+	Language string `json:"language,omitempty"` // Language tag, e.g. eng
+}
+
+// StreamOptions sets properties of the output stream made from an input stream
+type StreamOptions struct {
+	Index       int    `json:"index"`                 // Input stream index
+	Language    string `json:"language,omitempty"`    // Language tag to write, e.g. fra
+	Title       string `json:"title,omitempty"`       // Stream title, e.g. "Director's commentary"
+	Disposition string `json:"disposition,omitempty"` // e.g. default, forced, default+forced or 0 to clear
+}
+
+// StreamSelection chooses which input streams are written and how they are tagged
+type StreamSelection struct {
+	Streams       []StreamSelector `json:"streams,omitempty"`        // Streams to keep; defaults depend on the operation
+	AllAudio      bool             `json:"all_audio,omitempty"`      // Keep every audio track
+	DropSubtitles bool             `json:"drop_subtitles,omitempty"` // Remove all subtitle streams
+	DropData      bool             `json:"drop_data,omitempty"`      // Remove data streams such as timecode tracks
+	StreamOptions []StreamOptions  `json:"stream_options,omitempty"` // Per-stream language, title and disposition
+}
+
+// Active reports whether any stream selection option is set
+func (s StreamSelection) Active() bool {
+	return len(s.Streams) > 0 || s.AllAudio || s.DropSubtitles || s.DropData || len(s.StreamOptions) > 0
+}
+
+// matches reports whether a stream satisfies the selector
+func (s StreamSelector) matches(stream Stream) bool {
+	if s.Index != nil && *s.Index != stream.Index {
+		return false
+	}
+	if s.Type != "" && s.Type != stream.Type {
+		return false
+	}
+	if s.Language != "" && !strings.EqualFold(s.Language, stream.Language) {
+		return false
+	}
+	return true
+}
+
+// String describes the selector for error messages
+func (s StreamSelector) String() string {
+	var parts []string
+	if s.Index != nil {
+		parts = append(parts, "index "+strconv.Itoa(*s.Index))
+	}
+	if s.Type != "" {
+		parts = append(parts, "type "+s.Type)
+	}
+	if s.Language != "" {
+		parts = append(parts, "language "+s.Language)
+	}
+	if len(parts) == 0 {
+		return "all streams"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// selectStreams applies a selection to the input streams. Without selectors
+// the base streams are kept. The result is in input order.
+func selectStreams(sel StreamSelection, streams, base []Stream) ([]Stream, error) {
+	chosen := make(map[int]bool)
+
+	if len(sel.Streams) == 0 {
+		for _, stream := range base {
+			chosen[stream.Index] = true
+		}
+	}
+	for _, selector := range sel.Streams {
+		if selector.Type != "" && !slices.Contains(streamTypes, selector.Type) {
+			return nil, fmt.Errorf("invalid stream type '%s': must be one of %s", selector.Type, strings.Join(streamTypes, ", "))
+		}
+		matched := false
+		for _, stream := range streams {
+			if selector.matches(stream) {
+				chosen[stream.Index] = true
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no stream matches %s", selector)
+		}
+	}
+
+	var selected []Stream
+	for _, stream := range streams {
+		if sel.AllAudio && stream.Type == StreamAudio {
+			chosen[stream.Index] = true
+		}
+		if sel.DropSubtitles && stream.Type == StreamSubtitle {
+			continue
+		}
+		if sel.DropData && stream.Type == StreamData {
+			continue
+		}
+		if chosen[stream.Index] {
+			selected = append(selected, stream)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("stream selection does not keep any stream")
+	}
+
+	for _, opts := range sel.StreamOptions {
+		found := false
+		for _, stream := range selected {
+			found = found || stream.Index == opts.Index
+		}
+		if !found {
+			return nil, fmt.Errorf("stream options for stream %d, which is not selected", opts.Index)
+		}
+	}
+
+	return selected, nil
+}
+
+// defaultProcessStreams returns the streams an encode keeps without selectors:
+// the first video and audio streams plus subtitles and data the output
+// container can hold
+func defaultProcessStreams(streams []Stream, output string) []Stream {
+	ext := strings.ToLower(filepath.Ext(output))
+	support, known := containers[ext]
+
+	var base []Stream
+	video, audio := false, false
+	for _, stream := range streams {
+		switch stream.Type {
+		case StreamVideo:
+			if !video && !stream.HasDisposition("attached_pic") {
+				base = append(base, stream)
+				video = true
+			}
+		case StreamAudio:
+			if !audio {
+				base = append(base, stream)
+				audio = true
+			}
+		case StreamSubtitle, StreamData:
+			if known && planRemuxStream(stream, support, ext).Action != RemuxDrop {
+				base = append(base, stream)
+			}
+		}
+	}
+	return base
+}
+
+// streamMapArgs maps selected streams to the output of an encode. When the
+// video is filtered, the first selected video stream is taken from [vout].
+// Cover art and attachments are copied rather than encoded.
+func streamMapArgs(sel StreamSelection, selected []Stream, filtered bool, output string) ([]string, error) {
+	ext := strings.ToLower(filepath.Ext(output))
+	support, known := containers[ext]
+
+	var maps, args []string
+	outputIndex := make(map[int]int)
+	videoMapped, dataMapped, attachmentMapped := false, false, false
+	videos, subtitles := 0, 0
+
+	for i, stream := range selected {
+		outputIndex[stream.Index] = i
+		input := fmt.Sprintf("0:%d", stream.Index)
+
+		switch stream.Type {
+		case StreamVideo:
+			videos++
+			if stream.HasDisposition("attached_pic") {
+				if known {
+					if plan := planRemuxStream(stream, support, ext); plan.Action == RemuxDrop {
+						return nil, fmt.Errorf("stream %d: %s", stream.Index, plan.Reason)
+					}
+				}
+				// Re-encoding cover art with the video encoder would turn it into a video track
+				args = append(args, fmt.Sprintf("-c:v:%d", videos-1), "copy")
+				break
+			}
+			if filtered && videoMapped {
+				return nil, fmt.Errorf("only one video stream can be selected when filters are applied")
+			}
+			if filtered {
+				input = "[vout]"
+			}
+			videoMapped = true
+
+		case StreamSubtitle:
+			if known {
+				plan := planRemuxStream(stream, support, ext)
+				if plan.Action == RemuxDrop {
+					return nil, fmt.Errorf("stream %d: %s", stream.Index, plan.Reason)
+				}
+				codec := RemuxCopy
+				if plan.Action == RemuxTranscode {
+					codec = plan.Encoder
+				}
+				args = append(args, fmt.Sprintf("-c:s:%d", subtitles), codec)
+			}
+			subtitles++
+
+		case StreamData, StreamAttachment:
+			if known {
+				if plan := planRemuxStream(stream, support, ext); plan.Action == RemuxDrop {
+					return nil, fmt.Errorf("stream %d: %s", stream.Index, plan.Reason)
+				}
+			}
+			dataMapped = dataMapped || stream.Type == StreamData
+			attachmentMapped = attachmentMapped || stream.Type == StreamAttachment
+		}
+
+		maps = append(maps, "-map", input)
+	}
+	if filtered && !videoMapped {
+		return nil, fmt.Errorf("video filters require a selected video stream")
+	}
+
+	if dataMapped {
+		// Data streams cannot be encoded, only copied
+		args = append(args, "-c:d", "copy")
+	}
+	if attachmentMapped {
+		args = append(args, "-c:t", "copy")
+	}
+
+	args = append(maps, args...)
+	return append(args, streamOptionArgs(sel.StreamOptions, outputIndex)...), nil
+}
+
+// streamOptionArgs returns metadata and disposition options for output
+// streams, given the output index of each input stream
+func streamOptionArgs(options []StreamOptions, outputIndex map[int]int) []string {
+	var args []string
+	for _, opts := range options {
+		out, ok := outputIndex[opts.Index]
+		if !ok {
+			continue
+		}
+		if opts.Language != "" {
+			args = append(args, fmt.Sprintf("-metadata:s:%d", out), "language="+opts.Language)
+		}
+		if opts.Title != "" {
+			args = append(args, fmt.Sprintf("-metadata:s:%d", out), "title="+opts.Title)
+		}
+		if opts.Disposition != "" {
+			args = append(args, fmt.Sprintf("-disposition:%d", out), opts.Disposition)
+		}
+	}
+	return args
+}
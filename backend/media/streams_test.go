@@ -0,0 +1,186 @@
+package media
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectStreams(t *testing.T) {
+	streams := []Stream{
+		{Index: 0, Type: StreamVideo, Codec: "h264"},
+		{Index: 1, Type: StreamAudio, Codec: "aac", Language: "eng"},
+		{Index: 2, Type: StreamAudio, Codec: "aac", Language: "fra"},
+		{Index: 3, Type: StreamSubtitle, Codec: "subrip", Language: "eng"},
+		{Index: 4, Type: StreamData, Codec: "tmcd"},
+	}
+	base := streams[:2]
+	two := 2
+
+	tests := []struct {
+		name    string
+		sel     StreamSelection
+		want    []int
+		wantErr string
+	}{
+		{name: "base streams by default", sel: StreamSelection{}, want: []int{0, 1}},
+		{name: "all audio", sel: StreamSelection{AllAudio: true}, want: []int{0, 1, 2}},
+		{
+			name: "by language",
+			sel:  StreamSelection{Streams: []StreamSelector{{Type: StreamVideo}, {Type: StreamAudio, Language: "FRA"}}},
+			want: []int{0, 2},
+		},
+		{
+			name: "drop subtitles and data",
+			sel:  StreamSelection{Streams: []StreamSelector{{}}, DropSubtitles: true, DropData: true},
+			want: []int{0, 1, 2},
+		},
+		{
+			name:    "unknown type",
+			sel:     StreamSelection{Streams: []StreamSelector{{Type: "chapters"}}},
+			wantErr: "invalid stream type 'chapters'",
+		},
+		{
+			name:    "no match",
+			sel:     StreamSelection{Streams: []StreamSelector{{Type: StreamAudio, Language: "deu"}}},
+			wantErr: "no stream matches type audio, language deu",
+		},
+		{
+			name:    "options for unselected stream",
+			sel:     StreamSelection{StreamOptions: []StreamOptions{{Index: two, Language: "fra"}}},
+			wantErr: "stream options for stream 2",
+		},
+		{name: "by index", sel: StreamSelection{Streams: []StreamSelector{{Index: &two}}}, want: []int{2}},
+		{
+			name:    "nothing kept",
+			sel:     StreamSelection{Streams: []StreamSelector{{Type: StreamSubtitle}}, DropSubtitles: true},
+			wantErr: "does not keep any stream",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := selectStreams(tt.sel, streams, base)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			var got []int
+			for _, stream := range selected {
+				got = append(got, stream.Index)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selected = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamMapArgs(t *testing.T) {
+	video := Stream{Index: 0, Type: StreamVideo, Codec: "h264"}
+	audio := Stream{Index: 1, Type: StreamAudio, Codec: "aac"}
+	cover := Stream{Index: 2, Type: StreamVideo, Codec: "mjpeg", Disposition: []string{"attached_pic"}}
+	font := Stream{Index: 3, Type: StreamAttachment, Codec: "ttf"}
+
+	tests := []struct {
+		name     string
+		sel      StreamSelection
+		selected []Stream
+		filtered bool
+		output   string
+		want     []string
+		wantErr  string
+	}{
+		{
+			name:     "plain map",
+			selected: []Stream{video, audio},
+			output:   "out.mp4",
+			want:     []string{"-map", "0:0", "-map", "0:1"},
+		},
+		{
+			name:     "filtered video",
+			selected: []Stream{video, audio},
+			filtered: true,
+			output:   "out.mp4",
+			want:     []string{"-map", "[vout]", "-map", "0:1"},
+		},
+		{
+			name:     "cover art is copied",
+			selected: []Stream{video, audio, cover},
+			filtered: true,
+			output:   "out.mp4",
+			want:     []string{"-map", "[vout]", "-map", "0:1", "-map", "0:2", "-c:v:1", "copy"},
+		},
+		{
+			name:     "cover art before the video",
+			selected: []Stream{cover, video},
+			filtered: true,
+			output:   "out.mkv",
+			want:     []string{"-map", "0:2", "-map", "[vout]", "-c:v:0", "copy"},
+		},
+		{
+			name:     "attachments are copied",
+			selected: []Stream{video, font},
+			output:   "out.mkv",
+			want:     []string{"-map", "0:0", "-map", "0:3", "-c:t", "copy"},
+		},
+		{
+			name:     "subtitles transcoded for mp4",
+			selected: []Stream{video, {Index: 4, Type: StreamSubtitle, Codec: "subrip"}},
+			output:   "out.mp4",
+			want:     []string{"-map", "0:0", "-map", "0:4", "-c:s:0", "mov_text"},
+		},
+		{
+			name:     "data copied",
+			selected: []Stream{video, {Index: 5, Type: StreamData, Codec: "tmcd"}},
+			output:   "out.mov",
+			want:     []string{"-map", "0:0", "-map", "0:5", "-c:d", "copy"},
+		},
+		{
+			name:     "stream options",
+			sel:      StreamSelection{StreamOptions: []StreamOptions{{Index: 1, Language: "fra", Title: "French", Disposition: "default"}}},
+			selected: []Stream{video, audio},
+			output:   "out.mkv",
+			want: []string{"-map", "0:0", "-map", "0:1",
+				"-metadata:s:1", "language=fra", "-metadata:s:1", "title=French", "-disposition:1", "default"},
+		},
+		{
+			name:     "cover art unsupported",
+			selected: []Stream{video, cover},
+			output:   "out.webm",
+			wantErr:  "stream 2: cover art is not supported in .webm",
+		},
+		{
+			name:     "attachments unsupported",
+			selected: []Stream{video, font},
+			output:   "out.mp4",
+			wantErr:  "stream 3: attachments are not supported in .mp4",
+		},
+		{
+			name:     "two filtered videos",
+			selected: []Stream{video, {Index: 6, Type: StreamVideo, Codec: "h264"}},
+			filtered: true,
+			output:   "out.mkv",
+			wantErr:  "only one video stream",
+		},
+		{
+			name:     "filters without video",
+			selected: []Stream{audio, cover},
+			filtered: true,
+			output:   "out.mkv",
+			wantErr:  "video filters require a selected video stream",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := streamMapArgs(tt.sel, tt.selected, tt.filtered, tt.output)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("args = %q\nwant   %q", got, tt.want)
+			}
+		})
+	}
+}
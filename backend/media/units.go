@@ -0,0 +1,80 @@
+package media
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rational represents an exact fraction such as a 30000/1001 frame rate
+type Rational struct {
+	Num int64 `json:"num"`
+	Den int64 `json:"den"`
+}
+
+// ParseRational parses "30000/1001", "16:9" or a plain number such as "25"
+func ParseRational(value string) (Rational, error) {
+	value = strings.TrimSpace(value)
+
+	sep := strings.IndexAny(value, "/:")
+	if sep < 0 {
+		num, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return Rational{}, fmt.Errorf("invalid rational '%s'", value)
+		}
+		return Rational{Num: num, Den: 1}, nil
+	}
+
+	num, err1 := strconv.ParseInt(value[:sep], 10, 64)
+	den, err2 := strconv.ParseInt(value[sep+1:], 10, 64)
+	if err1 != nil || err2 != nil || den < 0 {
+		return Rational{}, fmt.Errorf("invalid rational '%s'", value)
+	}
+	return Rational{Num: num, Den: den}, nil
+}
+
+// Float64 returns the value of the fraction, or 0 if it is undefined
+func (r Rational) Float64() float64 {
+	if r.Den == 0 {
+		return 0
+	}
+	return float64(r.Num) / float64(r.Den)
+}
+
+// Valid reports whether the fraction has a positive value
+func (r Rational) Valid() bool {
+	return r.Num > 0 && r.Den > 0
+}
+
+// String renders the fraction as num/den
+func (r Rational) String() string {
+	return fmt.Sprintf("%d/%d", r.Num, r.Den)
+}
+
+// formatBitrate formats bits per second with a human readable unit
+func formatBitrate(bps int64) string {
+	switch {
+	case bps >= 1_000_000:
+		return fmt.Sprintf("%.2f Mb/s", float64(bps)/1_000_000)
+	case bps >= 1_000:
+		return fmt.Sprintf("%.1f kb/s", float64(bps)/1_000)
+	default:
+		return fmt.Sprintf("%d b/s", bps)
+	}
+}
+
+// formatFrameRate formats a frame rate like "30 fps" or "29.97 fps"
+func formatFrameRate(rate Rational) string {
+	if rate.Den == 1 {
+		return fmt.Sprintf("%d fps", rate.Num)
+	}
+	return fmt.Sprintf("%.2f fps", rate.Float64())
+}
+
+// percentReduction returns how much smaller after is than before, in percent
+func percentReduction(before, after float64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return (before - after) / before * 100
+}
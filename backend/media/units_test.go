@@ -0,0 +1,83 @@
+package media
+
+import "testing"
+
+func TestParseRational(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Rational
+		wantErr bool
+	}{
+		{"30000/1001", Rational{Num: 30000, Den: 1001}, false},
+		{"16:9", Rational{Num: 16, Den: 9}, false},
+		{" 25 ", Rational{Num: 25, Den: 1}, false},
+		{"0/0", Rational{}, false},
+		{"1/-2", Rational{}, true},
+		{"29.97", Rational{}, true},
+		{"a/b", Rational{}, true},
+		{"", Rational{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRational(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRational(%q) error = %v, want error %t", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRational(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRational(t *testing.T) {
+	tests := []struct {
+		rate  Rational
+		float float64
+		valid bool
+		text  string
+	}{
+		{Rational{Num: 30000, Den: 1001}, 30000.0 / 1001, true, "29.97 fps"},
+		{Rational{Num: 25, Den: 1}, 25, true, "25 fps"},
+		{Rational{Num: 0, Den: 0}, 0, false, "0.00 fps"},
+		{Rational{Num: 1, Den: 0}, 0, false, "0.00 fps"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.rate.Float64(); got != tt.float {
+			t.Errorf("%v.Float64() = %v, want %v", tt.rate, got, tt.float)
+		}
+		if got := tt.rate.Valid(); got != tt.valid {
+			t.Errorf("%v.Valid() = %t, want %t", tt.rate, got, tt.valid)
+		}
+		if got := formatFrameRate(tt.rate); got != tt.text {
+			t.Errorf("formatFrameRate(%v) = %q, want %q", tt.rate, got, tt.text)
+		}
+	}
+}
+
+func TestFormatBitrate(t *testing.T) {
+	tests := map[int64]string{
+		0:         "0 b/s",
+		999:       "999 b/s",
+		128_000:   "128.0 kb/s",
+		4_500_000: "4.50 Mb/s",
+	}
+	for bps, want := range tests {
+		if got := formatBitrate(bps); got != want {
+			t.Errorf("formatBitrate(%d) = %q, want %q", bps, got, want)
+		}
+	}
+}
+
+func TestPercentReduction(t *testing.T) {
+	if got := percentReduction(200, 50); got != 75 {
+		t.Errorf("percentReduction(200, 50) = %v, want 75", got)
+	}
+	if got := percentReduction(100, 120); got != -20 {
+		t.Errorf("percentReduction(100, 120) = %v, want -20", got)
+	}
+	if got := percentReduction(0, 10); got != 0 {
+		t.Errorf("percentReduction(0, 10) = %v, want 0", got)
+	}
+}
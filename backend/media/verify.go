@@ -0,0 +1,252 @@
+package media
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Verification limits
+const (
+	DefaultMaxVerifyErrors = 100  // Decoder errors kept in the report
+	minDurationTolerance   = 0.5  // Seconds of difference always accepted
+	durationToleranceRatio = 0.01 // Share of the duration accepted as difference
+)
+
+// truncationMessages are FFmpeg messages that indicate an incomplete file
+var truncationMessages = []string{
+	"partial file",
+	"truncat",
+	"moov atom not found",
+	"unexpected end of file",
+	"end of file",
+	"ended prematurely",
+	"invalid data found when processing input",
+}
+
+// logSourceRegex matches the "[h264 @ 0x55d0c8a4b2c0] " prefix of FFmpeg log lines
+var logSourceRegex = regexp.MustCompile(`^\[([^\s\]]+) @ 0x[0-9a-fA-F]+\]\s*(.*)$`)
+
+// VerifyRequest represents a request to verify that a file decodes cleanly
+type VerifyRequest struct {
+	Input     string `json:"input"`
+	MaxErrors int    `json:"max_errors,omitempty"` // Errors kept in the report (default 100)
+}
+
+// DecodeError is an error reported by FFmpeg while decoding
+type DecodeError struct {
+	Time    float64 `json:"time"`             // Approximate position in seconds
+	Source  string  `json:"source,omitempty"` // Component that logged it, e.g. h264 or aac
+	Message string  `json:"message"`
+}
+
+// DurationMismatch reports a stream whose duration disagrees with the container
+type DurationMismatch struct {
+	StreamIndex       int     `json:"stream_index"`
+	Type              string  `json:"type"`
+	StreamDuration    float64 `json:"stream_duration"`
+	ContainerDuration float64 `json:"container_duration"`
+	Difference        float64 `json:"difference"`
+}
+
+// VerifyReport is the result of a full decode check
+type VerifyReport struct {
+	Filename           string             `json:"filename"`
+	Passed             bool               `json:"passed"`
+	ContainerDuration  float64            `json:"container_duration"`
+	DecodedDuration    float64            `json:"decoded_duration"`
+	Truncated          bool               `json:"truncated"`
+	ErrorCount         int                `json:"error_count"`
+	Errors             []DecodeError      `json:"errors"`
+	DurationMismatches []DurationMismatch `json:"duration_mismatches,omitempty"`
+}
+
+// VerifyMedia fully decodes every audio and video stream of a file and
+// reports decoder errors, truncation and duration mismatches. A file that
+// cannot be probed or decoded fails verification rather than returning an error.
+func VerifyMedia(req VerifyRequest) (VerifyReport, error) {
+	report := VerifyReport{Filename: req.Input, Errors: []DecodeError{}}
+
+	if _, err := os.Stat(req.Input); err != nil {
+		return report, fmt.Errorf("failed to access input: %w", err)
+	}
+	if req.MaxErrors <= 0 {
+		req.MaxErrors = DefaultMaxVerifyErrors
+	}
+
+	probe, err := probeFile(req.Input)
+	if err != nil {
+		report.addError(req.MaxErrors, DecodeError{Message: err.Error()})
+		return report, nil
+	}
+
+	report.ContainerDuration = parseFloatOrZero(probe.Format.Duration)
+	report.DurationMismatches = durationMismatches(probe.Streams, report.ContainerDuration)
+
+	// A full decode costs as much as an encode, so it takes a slot of EncodePool
+	if err := EncodePool.Run(func() error { return decodeCheck(req, &report) }); err != nil {
+		return report, err
+	}
+
+	report.finish()
+	return report, nil
+}
+
+// durationMismatches returns the audio and video streams whose duration
+// differs from the container's by more than the tolerance
+func durationMismatches(streams []ffprobeStream, containerDuration float64) []DurationMismatch {
+	var mismatches []DurationMismatch
+	tolerance := durationTolerance(containerDuration)
+	for _, raw := range streams {
+		stream := newStream(raw)
+		if stream.Duration <= 0 || containerDuration <= 0 {
+			continue
+		}
+		if stream.Type != StreamVideo && stream.Type != StreamAudio {
+			continue
+		}
+		diff := stream.Duration - containerDuration
+		if math.Abs(diff) > tolerance {
+			mismatches = append(mismatches, DurationMismatch{
+				StreamIndex:       stream.Index,
+				Type:              stream.Type,
+				StreamDuration:    stream.Duration,
+				ContainerDuration: containerDuration,
+				Difference:        diff,
+			})
+		}
+	}
+	return mismatches
+}
+
+// finish marks the report truncated when decoding stopped before the
+// container duration, and decides whether the file passed
+func (r *VerifyReport) finish() {
+	if r.ContainerDuration > 0 && r.DecodedDuration < r.ContainerDuration-durationTolerance(r.ContainerDuration) {
+		r.Truncated = true
+	}
+	r.Passed = r.ErrorCount == 0 && !r.Truncated && len(r.DurationMismatches) == 0
+}
+
+// decodeCheck decodes the file to the null muxer, collecting errors from
+// stderr and timestamping them with the latest position from -progress
+func decodeCheck(req VerifyRequest, report *VerifyReport) error {
+	args := []string{
+		"-hide_banner",
+		"-nostdin",
+		"-v", "error",
+		"-err_detect", "crccheck+bitstream+buffer",
+		"-i", req.Input,
+		"-map", "0:v?",
+		"-map", "0:a?",
+		"-progress", "pipe:1",
+		"-f", "null",
+		"-",
+	}
+	fmt.Printf("Executing: ffmpeg %s\n", strings.Join(args, " "))
+
+	cmd := exec.Command("ffmpeg", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	var mu sync.Mutex
+	position := 0.0
+
+	// Track the decode position from the progress output
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), "=")
+			if !ok || key != "out_time_us" {
+				continue
+			}
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+				mu.Lock()
+				position = float64(us) / 1e6
+				mu.Unlock()
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		mu.Lock()
+		at := position
+		mu.Unlock()
+		report.addLogLine(req.MaxErrors, scanner.Text(), at)
+	}
+	<-done
+
+	report.DecodedDuration = position
+	if err := cmd.Wait(); err != nil {
+		// A failing decode is a verification result, not a request error
+		report.addError(req.MaxErrors, DecodeError{
+			Time:    position,
+			Message: fmt.Sprintf("ffmpeg exited with error: %v", err),
+		})
+	}
+
+	return nil
+}
+
+// addLogLine records an FFmpeg stderr line as a decode error at the given
+// position, splitting off the component that logged it
+func (r *VerifyReport) addLogLine(limit int, line string, position float64) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	decodeErr := DecodeError{Time: position, Message: line}
+	if matches := logSourceRegex.FindStringSubmatch(line); len(matches) > 2 {
+		decodeErr.Source = matches[1]
+		decodeErr.Message = matches[2]
+	}
+
+	r.addError(limit, decodeErr)
+	if isTruncationMessage(decodeErr.Message) {
+		r.Truncated = true
+	}
+}
+
+// addError counts an error and keeps it if the report is below its limit
+func (r *VerifyReport) addError(limit int, decodeErr DecodeError) {
+	r.ErrorCount++
+	if len(r.Errors) < limit {
+		r.Errors = append(r.Errors, decodeErr)
+	}
+}
+
+// isTruncationMessage reports whether an FFmpeg message indicates missing data
+func isTruncationMessage(message string) bool {
+	message = strings.ToLower(message)
+	for _, m := range truncationMessages {
+		if strings.Contains(message, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// durationTolerance returns the accepted duration difference for a file
+func durationTolerance(duration float64) float64 {
+	return math.Max(minDurationTolerance, duration*durationToleranceRatio)
+}
@@ -0,0 +1,166 @@
+package media
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddLogLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		position  float64
+		want      []DecodeError
+		truncated bool
+	}{
+		{
+			name:     "decoder error",
+			line:     "[h264 @ 0x55d0c8a4b2c0] error while decoding MB 45 12, bytestream -7",
+			position: 12.48,
+			want:     []DecodeError{{Time: 12.48, Source: "h264", Message: "error while decoding MB 45 12, bytestream -7"}},
+		},
+		{
+			name:     "audio decoder error",
+			line:     "[aac @ 0x5581f6e0e7c0] Input buffer exhausted before END element found\n",
+			position: 3.2,
+			want:     []DecodeError{{Time: 3.2, Source: "aac", Message: "Input buffer exhausted before END element found"}},
+		},
+		{
+			name:      "partial file",
+			line:      "[mov,mp4,m4a,3gp,3g2,mj2 @ 0x5632a5c3e140] stream 1, offset 0x1a2b3c: partial file",
+			position:  41.5,
+			want:      []DecodeError{{Time: 41.5, Source: "mov,mp4,m4a,3gp,3g2,mj2", Message: "stream 1, offset 0x1a2b3c: partial file"}},
+			truncated: true,
+		},
+		{
+			name:      "missing moov atom",
+			line:      "[mov,mp4,m4a,3gp,3g2,mj2 @ 0x55c1d2b3a4c0] moov atom not found",
+			want:      []DecodeError{{Source: "mov,mp4,m4a,3gp,3g2,mj2", Message: "moov atom not found"}},
+			truncated: true,
+		},
+		{
+			name:      "Matroska cut short",
+			line:      "[matroska,webm @ 0x7f3c1c004a80] File ended prematurely at pos. 10485760 (0xa00000)",
+			position:  95.04,
+			want:      []DecodeError{{Time: 95.04, Source: "matroska,webm", Message: "File ended prematurely at pos. 10485760 (0xa00000)"}},
+			truncated: true,
+		},
+		{
+			name:      "unreadable input",
+			line:      "/media/in.mp4: Invalid data found when processing input",
+			want:      []DecodeError{{Message: "/media/in.mp4: Invalid data found when processing input"}},
+			truncated: true,
+		},
+		{
+			name: "blank line",
+			line: "   ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var report VerifyReport
+			report.addLogLine(DefaultMaxVerifyErrors, tt.line, tt.position)
+			if !reflect.DeepEqual(report.Errors, tt.want) {
+				t.Errorf("errors = %+v, want %+v", report.Errors, tt.want)
+			}
+			if report.ErrorCount != len(tt.want) || report.Truncated != tt.truncated {
+				t.Errorf("error count = %d, truncated = %v, want %d, %v", report.ErrorCount, report.Truncated, len(tt.want), tt.truncated)
+			}
+		})
+	}
+}
+
+func TestAddErrorLimit(t *testing.T) {
+	var report VerifyReport
+	for range 5 {
+		report.addLogLine(3, "[hevc @ 0x5601] Could not find ref with POC 12", 1)
+	}
+	if report.ErrorCount != 5 || len(report.Errors) != 3 {
+		t.Errorf("error count = %d, kept = %d, want 5 and 3", report.ErrorCount, len(report.Errors))
+	}
+}
+
+func TestDurationMismatches(t *testing.T) {
+	streams := []ffprobeStream{
+		{Index: 0, CodecType: StreamVideo, Duration: "120.400000"}, // within 1% of 120s
+		{Index: 1, CodecType: StreamAudio, Duration: "118.000000"}, // 2s short
+		{Index: 2, CodecType: "subtitle", Duration: "60.000000"},   // not decoded
+		{Index: 3, CodecType: StreamAudio, Duration: "N/A"},        // unknown
+		{Index: 4, CodecType: StreamVideo, Duration: "122.000000"}, // 2s long
+		{Index: 5, CodecType: StreamAudio, Duration: "121.100000"}, // within 1%
+		{Index: 6, CodecType: StreamVideo, Duration: "0.040000"},   // cover art frame
+	}
+	want := []DurationMismatch{
+		{StreamIndex: 1, Type: StreamAudio, StreamDuration: 118, ContainerDuration: 120, Difference: -2},
+		{StreamIndex: 4, Type: StreamVideo, StreamDuration: 122, ContainerDuration: 120, Difference: 2},
+		{StreamIndex: 6, Type: StreamVideo, StreamDuration: 0.04, ContainerDuration: 120, Difference: 0.04 - 120},
+	}
+	if got := durationMismatches(streams, 120); !reflect.DeepEqual(got, want) {
+		t.Errorf("durationMismatches() = %+v\nwant                  %+v", got, want)
+	}
+
+	// Short files accept half a second
+	if got := durationMismatches([]ffprobeStream{{CodecType: StreamAudio, Duration: "10.45"}}, 10); got != nil {
+		t.Errorf("durationMismatches() of a short file = %+v, want none", got)
+	}
+	if got := durationMismatches(streams, 0); got != nil {
+		t.Errorf("durationMismatches() without container duration = %+v, want none", got)
+	}
+}
+
+func TestReportFinish(t *testing.T) {
+	tests := []struct {
+		name      string
+		report    VerifyReport
+		truncated bool
+		passed    bool
+	}{
+		{name: "clean", report: VerifyReport{ContainerDuration: 60, DecodedDuration: 59.8}, passed: true},
+		{name: "decoding stopped early", report: VerifyReport{ContainerDuration: 60, DecodedDuration: 42}, truncated: true},
+		{name: "truncation message", report: VerifyReport{ContainerDuration: 60, DecodedDuration: 60, Truncated: true, ErrorCount: 1}, truncated: true},
+		{name: "decoder errors", report: VerifyReport{ContainerDuration: 60, DecodedDuration: 60, ErrorCount: 2}},
+		{name: "duration mismatch", report: VerifyReport{ContainerDuration: 60, DecodedDuration: 60, DurationMismatches: []DurationMismatch{{}}}},
+		{name: "unknown container duration", report: VerifyReport{DecodedDuration: 3}, passed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.report.finish()
+			if tt.report.Truncated != tt.truncated || tt.report.Passed != tt.passed {
+				t.Errorf("truncated = %v, passed = %v, want %v, %v", tt.report.Truncated, tt.report.Passed, tt.truncated, tt.passed)
+			}
+		})
+	}
+}
+
+func TestVerifyMedia(t *testing.T) {
+	input := fakeFFprobe(t, `{"streams": [{"index": 0, "codec_type": "video", "duration": "30.0"}], "format": {"duration": "30.0"}}`)
+
+	// An ffmpeg that stops decoding a third of the way in
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"echo out_time_us=10000000\n" +
+		"echo progress=end\n" +
+		"echo '[h264 @ 0x55d0c8a4b2c0] Invalid NAL unit size (1183 > 912).' >&2\n" +
+		"echo '[h264 @ 0x55d0c8a4b2c0] missing picture in access unit with size 912' >&2\n" +
+		"exit 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	report, err := VerifyMedia(VerifyRequest{Input: input})
+	if err != nil {
+		t.Fatalf("VerifyMedia() error = %v", err)
+	}
+	if report.Passed || !report.Truncated || report.DecodedDuration != 10 || report.ContainerDuration != 30 {
+		t.Errorf("report = %+v, want a failed, truncated 10s decode of 30s", report)
+	}
+	if report.ErrorCount != 3 || report.Errors[0].Source != "h264" || !strings.Contains(report.Errors[2].Message, "ffmpeg exited with error") {
+		t.Errorf("errors = %+v", report.Errors)
+	}
+}
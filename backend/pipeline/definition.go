@@ -0,0 +1,366 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Step types
+const (
+	StepProcess  = "process"  // Process Media request, run as a job
+	StepCompress = "compress" // Compress Media request, run as a job
+	StepCompare  = "compare"  // Compare Media request, run as a job
+	StepInfo     = "info"     // Media info of {"input"}
+	StepVerify   = "verify"   // Verify Media request; fails when the file does not pass
+)
+
+// stepTypes lists the valid step types
+var stepTypes = []string{StepProcess, StepCompress, StepCompare, StepInfo, StepVerify}
+
+// Condition operators
+var operators = []string{">", ">=", "<", "<=", "==", "!="}
+
+var (
+	// reference matches {{name}} placeholders in request strings
+	reference = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.\-]+)\s*\}\}`)
+	// stepID matches valid step IDs
+	stepID = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+)
+
+// Definition describes a pipeline: steps that run as soon as the steps they
+// depend on have finished
+type Definition struct {
+	Name        string                     `json:"name,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Params      map[string]json.RawMessage `json:"params,omitempty"` // Defaults for {{params.<name>}}; null if a run must set it
+	Steps       []Step                     `json:"steps"`
+}
+
+// Step is one operation of a pipeline
+type Step struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`            // process, compress, compare, info or verify
+	Needs   []string        `json:"needs,omitempty"` // Steps to wait for besides those referenced in the request
+	When    *Condition      `json:"when,omitempty"`  // The step is skipped unless the condition holds
+	Request json.RawMessage `json:"request"`         // Body of the matching endpoint; strings may hold {{references}}
+}
+
+// Condition compares a referenced value with a constant, e.g. the bitrate
+// an info step found
+type Condition struct {
+	Ref   string          `json:"ref"`   // e.g. steps.probe.result.bitrate_bps
+	Op    string          `json:"op"`    // >, >=, <, <=, == or !=
+	Value json.RawMessage `json:"value"` // May hold {{references}} like a request
+}
+
+// Validate checks the steps, their references and their dependencies, and
+// returns the steps each step depends on by ID
+func (d Definition) Validate() (map[string][]string, error) {
+	if len(d.Steps) == 0 {
+		return nil, fmt.Errorf("a pipeline needs at least one step")
+	}
+
+	ids := make(map[string]bool, len(d.Steps))
+	for _, step := range d.Steps {
+		if !stepID.MatchString(step.ID) {
+			return nil, fmt.Errorf("invalid step ID '%s': use letters, digits, - and _", step.ID)
+		}
+		if ids[step.ID] {
+			return nil, fmt.Errorf("duplicate step ID '%s'", step.ID)
+		}
+		ids[step.ID] = true
+	}
+
+	deps := make(map[string][]string, len(d.Steps))
+	for _, step := range d.Steps {
+		if !slices.Contains(stepTypes, step.Type) {
+			return nil, fmt.Errorf("step '%s': unknown type '%s': must be one of %s", step.ID, step.Type, strings.Join(stepTypes, ", "))
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(step.Request, &fields); err != nil || fields == nil {
+			return nil, fmt.Errorf("step '%s': request must be a JSON object", step.ID)
+		}
+
+		refs := references(step.Request)
+		if step.When != nil {
+			if !slices.Contains(operators, step.When.Op) {
+				return nil, fmt.Errorf("step '%s': unknown operator '%s' in when: must be one of %s", step.ID, step.When.Op, strings.Join(operators, " "))
+			}
+			if len(step.When.Value) == 0 {
+				return nil, fmt.Errorf("step '%s': when needs a value", step.ID)
+			}
+			refs = append(refs, strings.TrimSpace(strings.Trim(step.When.Ref, "{}")))
+			refs = append(refs, references(step.When.Value)...)
+		}
+
+		needs := append([]string(nil), step.Needs...)
+		for _, ref := range refs {
+			dep, err := d.checkReference(ref)
+			if err != nil {
+				return nil, fmt.Errorf("step '%s': %w", step.ID, err)
+			}
+			if dep != "" {
+				needs = append(needs, dep)
+			}
+		}
+
+		for _, dep := range needs {
+			if !ids[dep] {
+				return nil, fmt.Errorf("step '%s' needs unknown step '%s'", step.ID, dep)
+			}
+			if dep == step.ID {
+				return nil, fmt.Errorf("step '%s' depends on itself", step.ID)
+			}
+			if !slices.Contains(deps[step.ID], dep) {
+				deps[step.ID] = append(deps[step.ID], dep)
+			}
+		}
+		sort.Strings(deps[step.ID])
+	}
+
+	if cycle := findCycle(d.Steps, deps); cycle != nil {
+		return nil, fmt.Errorf("steps depend on each other in a cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return deps, nil
+}
+
+// checkReference checks that a reference names something the pipeline has
+// and returns the step it refers to, if any
+func (d Definition) checkReference(ref string) (string, error) {
+	parts := strings.Split(ref, ".")
+	switch parts[0] {
+	case "input", "pipeline":
+		if ref == "input" || ref == "input.name" || ref == "input.dir" || ref == "pipeline.id" {
+			return "", nil
+		}
+	case "params":
+		if len(parts) == 2 {
+			if _, ok := d.Params[parts[1]]; !ok {
+				return "", fmt.Errorf("unknown parameter '%s': declare it in params", parts[1])
+			}
+			return "", nil
+		}
+	case "steps":
+		if len(parts) >= 3 && (parts[2] == "output" && len(parts) == 3 || parts[2] == "result") {
+			return parts[1], nil
+		}
+	}
+	return "", fmt.Errorf("invalid reference '{{%s}}'", ref)
+}
+
+// findCycle returns the step IDs of a dependency cycle, or nil if there is none
+func findCycle(steps []Step, deps map[string][]string) []string {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(steps))
+	var path []string
+
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		switch state[id] {
+		case visiting:
+			for i, p := range path {
+				if p == id {
+					return append(append([]string(nil), path[i:]...), id)
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		state[id] = visiting
+		path = append(path, id)
+		for _, dep := range deps[id] {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+		return nil
+	}
+
+	for _, step := range steps {
+		if cycle := visit(step.ID); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// references returns the references used in the strings of a JSON value
+func references(data json.RawMessage) []string {
+	var refs []string
+	for _, match := range reference.FindAllSubmatch(data, -1) {
+		refs = append(refs, string(match[1]))
+	}
+	return refs
+}
+
+// resolver looks up the value of a reference
+type resolver func(ref string) (json.RawMessage, error)
+
+// substitute replaces the references in the strings of a JSON value. A
+// string that is a single reference takes the referenced value as is, so
+// numbers and objects keep their type; references inside longer strings are
+// replaced by their text.
+func substitute(data json.RawMessage, resolve resolver) (json.RawMessage, error) {
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	result, err := substituteValue(value, resolve)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
+
+// substituteValue replaces references in a decoded JSON value
+func substituteValue(value any, resolve resolver) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return substituteString(v, resolve)
+
+	case []any:
+		for i, item := range v {
+			substituted, err := substituteValue(item, resolve)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = substituted
+		}
+
+	case map[string]any:
+		for key, item := range v {
+			substituted, err := substituteValue(item, resolve)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = substituted
+		}
+	}
+	return value, nil
+}
+
+// substituteString replaces the references in one string
+func substituteString(s string, resolve resolver) (any, error) {
+	if match := reference.FindStringSubmatch(s); match != nil && match[0] == s {
+		raw, err := resolve(match[1])
+		if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(raw), nil
+	}
+
+	var resolveErr error
+	result := reference.ReplaceAllStringFunc(s, func(placeholder string) string {
+		raw, err := resolve(reference.FindStringSubmatch(placeholder)[1])
+		if err != nil {
+			resolveErr = err
+			return placeholder
+		}
+		return text(raw)
+	})
+	if resolveErr != nil {
+		return nil, resolveErr
+	}
+	return result, nil
+}
+
+// evaluate reports whether a condition holds for the referenced value.
+// Numbers, and strings that hold numbers such as ffprobe bitrates, are
+// compared as numbers; other values only with == and !=.
+func (c Condition) evaluate(resolve resolver) (bool, error) {
+	raw, err := resolve(strings.TrimSpace(strings.Trim(c.Ref, "{}")))
+	if err != nil {
+		return false, err
+	}
+
+	value, err := substitute(c.Value, resolve)
+	if err != nil {
+		return false, err
+	}
+
+	left, leftNumeric := number(raw)
+	right, rightNumeric := number(value)
+	if leftNumeric && rightNumeric {
+		switch c.Op {
+		case ">":
+			return left > right, nil
+		case ">=":
+			return left >= right, nil
+		case "<":
+			return left < right, nil
+		case "<=":
+			return left <= right, nil
+		case "==":
+			return left == right, nil
+		case "!=":
+			return left != right, nil
+		}
+	}
+
+	switch c.Op {
+	case "==":
+		return text(raw) == text(value), nil
+	case "!=":
+		return text(raw) != text(value), nil
+	}
+	return false, fmt.Errorf("cannot compare %s %s %s: both sides must be numbers", text(raw), c.Op, text(value))
+}
+
+// number returns the value of a JSON number or of a string holding one
+func number(raw json.RawMessage) (float64, bool) {
+	n, err := strconv.ParseFloat(text(raw), 64)
+	return n, err == nil
+}
+
+// text returns a JSON value as text: strings without quotes, other values
+// as JSON
+func text(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+// lookup follows a dotted path into a JSON value. Numeric segments index
+// arrays, e.g. streams.0.codec.
+func lookup(raw json.RawMessage, path []string) (json.RawMessage, error) {
+	for i, key := range path {
+		var array []json.RawMessage
+		if json.Unmarshal(raw, &array) == nil {
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(array) {
+				return nil, fmt.Errorf("no element '%s' in %d elements", strings.Join(path[:i+1], "."), len(array))
+			}
+			raw = array[index]
+			continue
+		}
+
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return nil, fmt.Errorf("'%s' is not an object", strings.Join(path[:i], "."))
+		}
+		value, ok := object[key]
+		if !ok {
+			return nil, fmt.Errorf("no field '%s'", strings.Join(path[:i+1], "."))
+		}
+		raw = value
+	}
+	return raw, nil
+}
@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDefinitionValidate(t *testing.T) {
+	step := func(id, stepType, request string, needs ...string) Step {
+		return Step{ID: id, Type: stepType, Needs: needs, Request: json.RawMessage(request)}
+	}
+
+	tests := []struct {
+		name       string
+		definition Definition
+		want       map[string][]string
+		wantErr    string
+	}{
+		{name: "no steps", wantErr: "at least one step"},
+		{
+			name: "dependencies from references and needs",
+			definition: Definition{
+				Params: map[string]json.RawMessage{"height": json.RawMessage("720")},
+				Steps: []Step{
+					step("probe", StepInfo, `{"input": "{{input}}"}`),
+					step("small", StepProcess, `{"input": "{{input}}", "height": "{{params.height}}"}`, "probe"),
+					step("check", StepVerify, `{"input": "{{steps.small.output}}"}`),
+				},
+			},
+			want: map[string][]string{"small": {"probe"}, "check": {"small"}},
+		},
+		{
+			name:       "condition references are dependencies",
+			definition: Definition{Steps: []Step{step("probe", StepInfo, `{}`), {ID: "small", Type: StepCompress, Request: json.RawMessage(`{}`), When: &Condition{Ref: "{{steps.probe.result.bitrate_bps}}", Op: ">", Value: json.RawMessage("1000")}}}},
+			want:       map[string][]string{"small": {"probe"}},
+		},
+		{name: "invalid step ID", definition: Definition{Steps: []Step{step("a b", StepInfo, `{}`)}}, wantErr: "invalid step ID 'a b'"},
+		{name: "duplicate step ID", definition: Definition{Steps: []Step{step("a", StepInfo, `{}`), step("a", StepInfo, `{}`)}}, wantErr: "duplicate step ID 'a'"},
+		{name: "unknown type", definition: Definition{Steps: []Step{step("a", "upload", `{}`)}}, wantErr: "unknown type 'upload'"},
+		{name: "request is not an object", definition: Definition{Steps: []Step{step("a", StepInfo, `[]`)}}, wantErr: "request must be a JSON object"},
+		{name: "unknown parameter", definition: Definition{Steps: []Step{step("a", StepInfo, `{"input": "{{params.file}}"}`)}}, wantErr: "unknown parameter 'file'"},
+		{name: "invalid reference", definition: Definition{Steps: []Step{step("a", StepInfo, `{"input": "{{output}}"}`)}}, wantErr: "invalid reference '{{output}}'"},
+		{name: "unknown step", definition: Definition{Steps: []Step{step("a", StepInfo, `{}`, "b")}}, wantErr: "needs unknown step 'b'"},
+		{name: "depends on itself", definition: Definition{Steps: []Step{step("a", StepInfo, `{"input": "{{steps.a.output}}"}`)}}, wantErr: "depends on itself"},
+		{
+			name:       "unknown operator",
+			definition: Definition{Steps: []Step{{ID: "a", Type: StepInfo, Request: json.RawMessage(`{}`), When: &Condition{Ref: "input", Op: "=~", Value: json.RawMessage(`"x"`)}}}},
+			wantErr:    "unknown operator '=~'",
+		},
+		{
+			name:       "cycle",
+			definition: Definition{Steps: []Step{step("a", StepInfo, `{}`, "c"), step("b", StepInfo, `{}`, "a"), step("c", StepInfo, `{}`, "b")}},
+			wantErr:    "cycle: a -> c -> b -> a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.definition.Validate()
+			checkError(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+			for id, deps := range got {
+				if len(deps) == 0 {
+					delete(got, id)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	steps := []Step{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}}
+
+	tests := []struct {
+		name string
+		deps map[string][]string
+		want []string
+	}{
+		{name: "no dependencies"},
+		{name: "chain", deps: map[string][]string{"b": {"a"}, "c": {"b"}, "d": {"b", "c"}}},
+		{name: "diamond", deps: map[string][]string{"b": {"a"}, "c": {"a"}, "d": {"b", "c"}}},
+		{name: "two steps", deps: map[string][]string{"a": {"b"}, "b": {"a"}}, want: []string{"a", "b", "a"}},
+		{name: "cycle after a chain", deps: map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"d"}, "d": {"b"}}, want: []string{"b", "c", "d", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findCycle(steps, tt.deps); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("findCycle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	values := map[string]string{
+		"input":         `"/media/talk.mov"`,
+		"input.name":    `"talk"`,
+		"params.height": `720`,
+		"params.size":   `{"width": 1280}`,
+	}
+	resolve := func(ref string) (json.RawMessage, error) {
+		if value, ok := values[ref]; ok {
+			return json.RawMessage(value), nil
+		}
+		return nil, fmt.Errorf("invalid reference '{{%s}}'", ref)
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr string
+	}{
+		{name: "no references", data: `{"crf": "23", "width": 1280}`, want: `{"crf":"23","width":1280}`},
+		{name: "whole string keeps the type", data: `{"height": "{{params.height}}"}`, want: `{"height":720}`},
+		{name: "objects are inserted", data: `{"size": "{{ params.size }}"}`, want: `{"size":{"width":1280}}`},
+		{name: "text inside a string", data: `{"output": "out/{{input.name}}_{{params.height}}p.mp4"}`, want: `{"output":"out/talk_720p.mp4"}`},
+		{name: "arrays", data: `{"inputs": ["{{input}}", "b.mov"]}`, want: `{"inputs":["/media/talk.mov","b.mov"]}`},
+		{name: "large numbers keep their digits", data: `{"bitrate": 12345678901234567}`, want: `{"bitrate":12345678901234567}`},
+		{name: "unknown reference", data: `{"input": "a/{{input.dir}}"}`, wantErr: "invalid reference '{{input.dir}}'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := substitute(json.RawMessage(tt.data), resolve)
+			checkError(t, err, tt.wantErr)
+			if tt.wantErr == "" && string(got) != tt.want {
+				t.Fatalf("substitute() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	result := json.RawMessage(`{"bitrate_bps": 4200000, "streams": [{"codec": "h264"}, {"codec": "aac", "tags": {"language": "eng"}}]}`)
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr string
+	}{
+		{path: "", want: string(result)},
+		{path: "bitrate_bps", want: "4200000"},
+		{path: "streams.0.codec", want: `"h264"`},
+		{path: "streams.1.tags.language", want: `"eng"`},
+		{path: "streams.2.codec", wantErr: "no element 'streams.2' in 2 elements"},
+		{path: "streams.first", wantErr: "no element 'streams.first'"},
+		{path: "streams.-1", wantErr: "no element 'streams.-1'"},
+		{path: "duration", wantErr: "no field 'duration'"},
+		{path: "bitrate_bps.value", wantErr: "'bitrate_bps' is not an object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var path []string
+			if tt.path != "" {
+				path = strings.Split(tt.path, ".")
+			}
+			got, err := lookup(result, path)
+			checkError(t, err, tt.wantErr)
+			if tt.wantErr == "" && string(got) != tt.want {
+				t.Fatalf("lookup() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// checkError fails the test unless err matches want: nil if want is empty,
+// otherwise an error containing want
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case want != "" && err == nil:
+		t.Fatalf("expected an error containing %q", want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Fatalf("error = %q, want it to contain %q", err, want)
+	}
+}
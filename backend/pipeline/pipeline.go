@@ -0,0 +1,483 @@
+package pipeline
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Promptzy/terminal-devtool/backend/jobs"
+	"github.com/Promptzy/terminal-devtool/backend/media"
+)
+
+// Run and step statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+// PollInterval is how often the status of a step's job is checked
+const PollInterval = 500 * time.Millisecond
+
+// ErrUnknownRun is returned when a pipeline run does not exist
+var ErrUnknownRun = errors.New("unknown pipeline run")
+
+// SubmitFunc queues a request of a job type for a client
+type SubmitFunc func(jobType string, request json.RawMessage, priority, client string) (jobs.Job, error)
+
+// StepStatus is the state of one step of a run
+type StepStatus struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Needs      []string        `json:"needs,omitempty"`   // Steps this step waited for
+	Status     string          `json:"status"`            // pending, running, succeeded, failed or skipped
+	Reason     string          `json:"reason,omitempty"`  // Why the step was skipped
+	Request    json.RawMessage `json:"request,omitempty"` // Request with references replaced, once started
+	JobID      string          `json:"job_id,omitempty"`
+	Output     string          `json:"output,omitempty"` // File the step wrote, or the file info and verify steps read
+	Result     json.RawMessage `json:"result,omitempty"` // Result of info, verify and compare steps
+	Error      string          `json:"error,omitempty"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Run is one execution of a pipeline
+type Run struct {
+	ID         string                     `json:"id"`
+	Name       string                     `json:"name,omitempty"`
+	Template   string                     `json:"template,omitempty"` // Template the run was started from
+	Input      string                     `json:"input"`
+	Params     map[string]json.RawMessage `json:"params,omitempty"`
+	Client     string                     `json:"client"`
+	Status     string                     `json:"status"` // running, succeeded or failed
+	Steps      []StepStatus               `json:"steps"`
+	CreatedAt  time.Time                  `json:"created_at"`
+	FinishedAt *time.Time                 `json:"finished_at,omitempty"`
+}
+
+// RunOptions are the settings of a run besides its definition
+type RunOptions struct {
+	Template string
+	Input    string                     // Absolute path of {{input}}
+	Params   map[string]json.RawMessage // Override the definition's defaults
+	Priority string                     // Priority of the run's jobs
+	Client   string
+}
+
+// run is a run with the definition it executes
+type run struct {
+	Run
+	definition Definition
+	priority   string
+}
+
+// Manager starts pipeline runs and keeps their status
+type Manager struct {
+	BaseDir string
+	Queue   *jobs.Queue
+	Submit  SubmitFunc
+
+	// Retention is how long finished runs are kept before they are dropped;
+	// they are kept forever if zero
+	Retention time.Duration
+
+	mu    sync.Mutex
+	runs  map[string]*run
+	order []string
+}
+
+// NewManager creates a manager that runs job steps through submit
+func NewManager(baseDir string, queue *jobs.Queue, submit SubmitFunc) *Manager {
+	return &Manager{
+		BaseDir:   baseDir,
+		Queue:     queue,
+		Submit:    submit,
+		Retention: jobs.DefaultRetention,
+		runs:      make(map[string]*run),
+	}
+}
+
+// Start validates a definition and runs it in the background
+func (m *Manager) Start(definition Definition, options RunOptions) (Run, error) {
+	params := make(map[string]json.RawMessage, len(definition.Params))
+	for name, value := range definition.Params {
+		params[name] = value
+	}
+	for name, value := range options.Params {
+		if _, ok := params[name]; !ok {
+			return Run{}, fmt.Errorf("unknown parameter '%s'", name)
+		}
+		params[name] = value
+	}
+	for name, value := range params {
+		if len(value) == 0 || string(value) == "null" {
+			return Run{}, fmt.Errorf("parameter '%s' is required", name)
+		}
+	}
+	definition.Params = params
+
+	deps, err := definition.Validate()
+	if err != nil {
+		return Run{}, err
+	}
+	if options.Input == "" {
+		return Run{}, fmt.Errorf("input is required")
+	}
+
+	r := &run{
+		Run: Run{
+			ID:        newID(),
+			Name:      definition.Name,
+			Template:  options.Template,
+			Input:     options.Input,
+			Params:    params,
+			Client:    options.Client,
+			Status:    StatusRunning,
+			CreatedAt: time.Now(),
+		},
+		definition: definition,
+		priority:   options.Priority,
+	}
+	for _, step := range definition.Steps {
+		r.Steps = append(r.Steps, StepStatus{ID: step.ID, Type: step.Type, Needs: deps[step.ID], Status: StatusPending})
+	}
+
+	m.mu.Lock()
+	m.prune(r.CreatedAt)
+	m.runs[r.ID] = r
+	m.order = append(m.order, r.ID)
+	status := r.snapshot()
+	m.mu.Unlock()
+
+	log.Printf("Pipeline %s: started with %d steps on %s", r.ID, len(r.Steps), r.Input)
+	go m.execute(r)
+	return status, nil
+}
+
+// prune drops the runs that finished longer than the retention period
+// before now. Callers hold m.mu.
+func (m *Manager) prune(now time.Time) {
+	if m.Retention <= 0 {
+		return
+	}
+
+	kept := m.order[:0]
+	for _, id := range m.order {
+		if r := m.runs[id]; r.FinishedAt != nil && now.Sub(*r.FinishedAt) > m.Retention {
+			delete(m.runs, id)
+			continue
+		}
+		kept = append(kept, id)
+	}
+	m.order = kept
+}
+
+// Get returns the run with the given ID
+func (m *Manager) Get(id string) (Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.runs[id]
+	if !ok {
+		return Run{}, fmt.Errorf("%w '%s'", ErrUnknownRun, id)
+	}
+	return r.snapshot(), nil
+}
+
+// List returns all runs in start order
+func (m *Manager) List() []Run {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	runs := make([]Run, 0, len(m.order))
+	for _, id := range m.order {
+		runs = append(runs, m.runs[id].snapshot())
+	}
+	return runs
+}
+
+// execute starts every step whose dependencies have finished, in parallel,
+// until no step is left
+func (m *Manager) execute(r *run) {
+	finished := make(chan struct{})
+	running := 0
+
+	for {
+		m.mu.Lock()
+		for _, i := range m.ready(r) {
+			running++
+			go func(i int) {
+				m.runStep(r, i)
+				finished <- struct{}{}
+			}(i)
+		}
+
+		if running == 0 {
+			m.finish(r)
+			m.mu.Unlock()
+			return
+		}
+		m.mu.Unlock()
+
+		<-finished
+		running--
+	}
+}
+
+// ready marks the pending steps whose dependencies have finished as running
+// and returns their indexes. Steps whose dependencies failed or were skipped,
+// or whose condition does not hold, are skipped. Callers hold m.mu.
+func (m *Manager) ready(r *run) []int {
+	var started []int
+	for changed := true; changed; {
+		changed = false
+		for i := range r.Steps {
+			step := &r.Steps[i]
+			if step.Status != StatusPending {
+				continue
+			}
+
+			waiting, reason := false, ""
+			for _, dep := range step.Needs {
+				switch r.step(dep).Status {
+				case StatusPending, StatusRunning:
+					waiting = true
+				case StatusFailed:
+					reason = fmt.Sprintf("step '%s' failed", dep)
+				case StatusSkipped:
+					reason = fmt.Sprintf("step '%s' was skipped", dep)
+				}
+			}
+			if waiting {
+				continue
+			}
+			changed = true
+
+			if reason == "" {
+				if when := r.definition.Steps[i].When; when != nil {
+					holds, err := when.evaluate(r.resolve)
+					if err != nil {
+						r.fail(step, "evaluating when: "+err.Error())
+						continue
+					}
+					if !holds {
+						reason = fmt.Sprintf("condition %s %s %s is false", when.Ref, when.Op, text(when.Value))
+					}
+				}
+			}
+			if reason != "" {
+				now := time.Now()
+				step.Status = StatusSkipped
+				step.Reason = reason
+				step.FinishedAt = &now
+				log.Printf("Pipeline %s: step %s skipped: %s", r.ID, step.ID, reason)
+				continue
+			}
+
+			now := time.Now()
+			step.Status = StatusRunning
+			step.StartedAt = &now
+			started = append(started, i)
+		}
+	}
+	return started
+}
+
+// runStep executes one step and records its outcome
+func (m *Manager) runStep(r *run, i int) {
+	m.mu.Lock()
+	definition := r.definition.Steps[i]
+	request, err := substitute(definition.Request, r.resolve)
+	if err == nil {
+		r.Steps[i].Request = request
+	}
+	m.mu.Unlock()
+
+	var output string
+	var result json.RawMessage
+	if err == nil {
+		log.Printf("Pipeline %s: step %s running %s", r.ID, definition.ID, definition.Type)
+		output, result, err = m.perform(r, i, definition.Type, request)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	step := &r.Steps[i]
+	if err != nil {
+		r.fail(step, err.Error())
+		return
+	}
+	now := time.Now()
+	step.Status = StatusSucceeded
+	step.Output = output
+	step.Result = result
+	step.FinishedAt = &now
+	log.Printf("Pipeline %s: step %s succeeded", r.ID, step.ID)
+}
+
+// perform runs a step's request. Inspection steps run here in a slot of the
+// encode pool; the others run as jobs, so they are scheduled and retried
+// like any job.
+func (m *Manager) perform(r *run, i int, stepType string, request json.RawMessage) (string, json.RawMessage, error) {
+	switch stepType {
+	case StepInfo:
+		var req struct {
+			Input string `json:"input"`
+		}
+		if err := json.Unmarshal(request, &req); err != nil || req.Input == "" {
+			return "", nil, fmt.Errorf("info needs an input")
+		}
+		path := m.resolvePath(req.Input)
+		var info media.MediaInfo
+		err := media.EncodePool.Run(func() error {
+			var err error
+			info, err = media.GetMediaInfo(path)
+			return err
+		})
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to get media info: %w", err)
+		}
+		result, err := json.Marshal(info)
+		return path, result, err
+
+	case StepVerify:
+		var req media.VerifyRequest
+		if err := json.Unmarshal(request, &req); err != nil || req.Input == "" {
+			return "", nil, fmt.Errorf("verify needs an input")
+		}
+		req.Input = m.resolvePath(req.Input)
+		report, err := media.VerifyMedia(req)
+		if err != nil {
+			return "", nil, fmt.Errorf("verification failed: %w", err)
+		}
+		result, err := json.Marshal(report)
+		if err == nil && !report.Passed {
+			err = fmt.Errorf("%s did not pass verification (decode errors: %d, truncated: %t)", filepath.Base(req.Input), report.ErrorCount, report.Truncated)
+		}
+		return req.Input, result, err
+	}
+
+	job, err := m.Submit(stepType, request, r.priority, r.Client)
+	if err != nil {
+		return "", nil, err
+	}
+	m.mu.Lock()
+	r.Steps[i].JobID = job.ID
+	m.mu.Unlock()
+
+	for !job.Done() {
+		time.Sleep(PollInterval)
+		var ok bool
+		if job, ok = m.Queue.Get(job.ID); !ok {
+			return "", nil, fmt.Errorf("job was lost")
+		}
+	}
+	if job.Status == jobs.StatusFailed {
+		return "", nil, errors.New(job.Error)
+	}
+	return job.Output, job.Result, nil
+}
+
+// finish sets the status of a run whose steps are all done. Callers hold m.mu.
+func (m *Manager) finish(r *run) {
+	now := time.Now()
+	r.Status = StatusSucceeded
+	r.FinishedAt = &now
+	for _, step := range r.Steps {
+		if step.Status == StatusFailed {
+			r.Status = StatusFailed
+		}
+	}
+	log.Printf("Pipeline %s: %s", r.ID, r.Status)
+}
+
+// resolvePath resolves a path relative to the base directory if not absolute
+func (m *Manager) resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(m.BaseDir, path)
+}
+
+// resolve returns the value of a reference. Callers hold the manager's lock.
+func (r *run) resolve(ref string) (json.RawMessage, error) {
+	parts := strings.Split(ref, ".")
+	switch {
+	case ref == "input":
+		return json.Marshal(r.Input)
+	case ref == "input.name":
+		name := filepath.Base(r.Input)
+		return json.Marshal(strings.TrimSuffix(name, filepath.Ext(name)))
+	case ref == "input.dir":
+		return json.Marshal(filepath.Dir(r.Input))
+	case ref == "pipeline.id":
+		return json.Marshal(r.ID)
+	case parts[0] == "params" && len(parts) == 2:
+		if value, ok := r.Params[parts[1]]; ok {
+			return value, nil
+		}
+	case parts[0] == "steps" && len(parts) >= 3:
+		step := r.step(parts[1])
+		if step == nil {
+			break
+		}
+		if step.Status != StatusSucceeded {
+			return nil, fmt.Errorf("{{%s}}: step '%s' has not succeeded", ref, step.ID)
+		}
+		if parts[2] == "output" {
+			return json.Marshal(step.Output)
+		}
+		if len(step.Result) == 0 {
+			return nil, fmt.Errorf("{{%s}}: step '%s' has no result", ref, step.ID)
+		}
+		value, err := lookup(step.Result, parts[3:])
+		if err != nil {
+			return nil, fmt.Errorf("{{%s}}: %w", ref, err)
+		}
+		return value, nil
+	}
+	return nil, fmt.Errorf("invalid reference '{{%s}}'", ref)
+}
+
+// step returns the status of the step with the given ID
+func (r *run) step(id string) *StepStatus {
+	for i := range r.Steps {
+		if r.Steps[i].ID == id {
+			return &r.Steps[i]
+		}
+	}
+	return nil
+}
+
+// fail marks a step as failed. Callers hold the manager's lock.
+func (r *run) fail(step *StepStatus, message string) {
+	now := time.Now()
+	step.Status = StatusFailed
+	step.Error = message
+	step.FinishedAt = &now
+	log.Printf("Pipeline %s: step %s failed: %s", r.ID, step.ID, message)
+}
+
+// snapshot returns a copy of the run's status. Callers hold the manager's lock.
+func (r *run) snapshot() Run {
+	status := r.Run
+	status.Steps = append([]StepStatus(nil), r.Steps...)
+	return status
+}
+
+// newID returns a random run ID
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,34 @@
+package pipeline
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestManagerPrune(t *testing.T) {
+	m := NewManager("", nil, nil)
+	now := time.Now()
+	finished := now.Add(-m.Retention - time.Minute)
+	recent := now.Add(-time.Minute)
+
+	for id, finishedAt := range map[string]*time.Time{"old": &finished, "recent": &recent, "running": nil} {
+		m.runs[id] = &run{Run: Run{ID: id, FinishedAt: finishedAt}}
+		m.order = append(m.order, id)
+	}
+
+	m.prune(now)
+	if _, err := m.Get("old"); !errors.Is(err, ErrUnknownRun) {
+		t.Fatalf("Get() of expired run error = %v, want ErrUnknownRun", err)
+	}
+	if len(m.List()) != 2 {
+		t.Fatalf("runs after prune = %d, want 2", len(m.List()))
+	}
+
+	m.Retention = 0
+	m.runs["recent"].FinishedAt = &finished
+	m.prune(now)
+	if len(m.List()) != 2 {
+		t.Fatalf("runs without retention = %d, want 2", len(m.List()))
+	}
+}
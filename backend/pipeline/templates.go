@@ -0,0 +1,179 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrUnknownTemplate is returned when a pipeline template does not exist
+var ErrUnknownTemplate = errors.New("unknown pipeline template")
+
+// templateFile is the layout of the templates file
+type templateFile struct {
+	Templates []Definition `json:"templates"`
+}
+
+// TemplateStore keeps named pipeline definitions in a JSON file
+type TemplateStore struct {
+	path string
+
+	mu        sync.RWMutex
+	templates []Definition
+}
+
+// NewTemplateStore creates a store for the templates file at path. Call Load
+// to read it.
+func NewTemplateStore(path string) *TemplateStore {
+	return &TemplateStore{path: path}
+}
+
+// Path returns the templates file path
+func (s *TemplateStore) Path() string {
+	return s.path
+}
+
+// Load reads and validates the templates file. A missing file is an empty
+// store.
+func (s *TemplateStore) Load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read templates file: %w", err)
+	}
+
+	var file templateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid templates file %s: %w", s.path, err)
+	}
+	names := make(map[string]bool, len(file.Templates))
+	for _, template := range file.Templates {
+		if err := checkTemplate(template); err != nil {
+			return fmt.Errorf("invalid templates file %s: %w", s.path, err)
+		}
+		if names[template.Name] {
+			return fmt.Errorf("invalid templates file %s: duplicate template '%s'", s.path, template.Name)
+		}
+		names[template.Name] = true
+	}
+
+	s.mu.Lock()
+	s.templates = file.Templates
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns the template with the given name
+func (s *TemplateStore) Get(name string) (Definition, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, template := range s.templates {
+		if template.Name == name {
+			return template, true
+		}
+	}
+	return Definition{}, false
+}
+
+// List returns all templates in file order
+func (s *TemplateStore) List() []Definition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]Definition(nil), s.templates...)
+}
+
+// Put validates a template, adds it or replaces the one of the same name,
+// and saves the file. It reports whether the template was new.
+func (s *TemplateStore) Put(template Definition) (bool, error) {
+	if err := checkTemplate(template); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	templates := append([]Definition(nil), s.templates...)
+	created := true
+	for i := range templates {
+		if templates[i].Name == template.Name {
+			templates[i] = template
+			created = false
+		}
+	}
+	if created {
+		templates = append(templates, template)
+	}
+
+	if err := s.save(templates); err != nil {
+		return false, err
+	}
+	s.templates = templates
+	return created, nil
+}
+
+// Delete removes a template and saves the file
+func (s *TemplateStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	templates := make([]Definition, 0, len(s.templates))
+	for _, template := range s.templates {
+		if template.Name != name {
+			templates = append(templates, template)
+		}
+	}
+	if len(templates) == len(s.templates) {
+		return fmt.Errorf("%w '%s'", ErrUnknownTemplate, name)
+	}
+
+	if err := s.save(templates); err != nil {
+		return err
+	}
+	s.templates = templates
+	return nil
+}
+
+// save writes the templates to a temporary file and renames it over the
+// templates file, so readers never see a partial file. Callers hold s.mu.
+func (s *TemplateStore) save(templates []Definition) error {
+	data, err := json.MarshalIndent(templateFile{Templates: templates}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".pipelines-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to save templates: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save templates: %w", err)
+	}
+	return nil
+}
+
+// checkTemplate validates a definition stored as a template
+func checkTemplate(template Definition) error {
+	if !stepID.MatchString(template.Name) {
+		return fmt.Errorf("invalid template name '%s': use letters, digits, - and _", template.Name)
+	}
+	if _, err := template.Validate(); err != nil {
+		return fmt.Errorf("template '%s': %w", template.Name, err)
+	}
+	return nil
+}
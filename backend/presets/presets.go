@@ -0,0 +1,212 @@
+package presets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Promptzy/terminal-devtool/backend/media"
+)
+
+// PreviewInput is the input path used to show a preset's ffmpeg command
+const PreviewInput = "input.mp4"
+
+// reservedFields are request fields a preset may not set
+var reservedFields = []string{"input", "output", "preset_name", "dry_run"}
+
+// Preset is a named set of process request options
+type Preset struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description,omitempty"`
+	Options     map[string]json.RawMessage `json:"options"` // Process request fields, e.g. codec, crf, resolution
+}
+
+// presetFile is the layout of the presets file
+type presetFile struct {
+	Presets []Preset `json:"presets"`
+}
+
+// Store holds the presets loaded from a file and reloads them when it changes
+type Store struct {
+	path string
+
+	mu      sync.RWMutex
+	presets []Preset
+	modTime time.Time
+}
+
+// NewStore creates a store for the presets file at path. Call Load to read it.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Path returns the presets file path
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Load reads and validates the presets file. On error the presets loaded
+// before are kept.
+func (s *Store) Load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read presets file: %w", err)
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read presets file: %w", err)
+	}
+
+	presets, err := parsePresets(data)
+	if err != nil {
+		return fmt.Errorf("invalid presets file %s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	s.presets = presets
+	s.modTime = info.ModTime()
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Watch polls the presets file and reloads it when its modification time
+// changes, until stop is closed
+func (s *Store) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(s.path)
+			if err != nil {
+				continue
+			}
+
+			s.mu.RLock()
+			changed := !info.ModTime().Equal(s.modTime)
+			s.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err := s.Load(); err != nil {
+				log.Printf("Presets not reloaded: %v", err)
+				// Do not retry the same broken file on every tick
+				s.mu.Lock()
+				s.modTime = info.ModTime()
+				s.mu.Unlock()
+				continue
+			}
+			log.Printf("Reloaded %d presets from %s", len(s.List()), s.path)
+		}
+	}
+}
+
+// Get returns the preset with the given name
+func (s *Store) Get(name string) (Preset, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, preset := range s.presets {
+		if preset.Name == name {
+			return preset, true
+		}
+	}
+	return Preset{}, false
+}
+
+// List returns all presets in file order
+func (s *Store) List() []Preset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]Preset(nil), s.presets...)
+}
+
+// Merge overlays request fields on the preset's options and returns the
+// combined JSON object. Fields present in the request always win.
+func (p Preset) Merge(fields map[string]json.RawMessage) ([]byte, error) {
+	merged := make(map[string]json.RawMessage, len(p.Options)+len(fields))
+	for key, value := range p.Options {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return json.Marshal(merged)
+}
+
+// Request returns the preset's options as a process request
+func (p Preset) Request() (media.ProcessRequest, error) {
+	var req media.ProcessRequest
+	err := p.Decode(&req)
+	return req, err
+}
+
+// Decode decodes the preset's options into v, rejecting options v has no
+// field for, such as a resolution applied to a compress request
+func (p Preset) Decode(v any) error {
+	data, err := json.Marshal(p.Options)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("preset '%s': %w", p.Name, err)
+	}
+	return nil
+}
+
+// Command returns the ffmpeg command the preset produces for a placeholder
+// input. Options that depend on the input (auto crop, trimming, HDR handling,
+// stream selection and chunking) are left out since there is no file to read.
+func (p Preset) Command() (string, error) {
+	req, err := p.Request()
+	if err != nil {
+		return "", err
+	}
+	req.Input = PreviewInput
+	return media.ProcessCommand(req)
+}
+
+// parsePresets decodes and validates the contents of a presets file
+func parsePresets(data []byte) ([]Preset, error) {
+	var file presetFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, preset := range file.Presets {
+		if preset.Name == "" {
+			return nil, fmt.Errorf("preset without a name")
+		}
+		if seen[preset.Name] {
+			return nil, fmt.Errorf("duplicate preset '%s'", preset.Name)
+		}
+		seen[preset.Name] = true
+
+		for _, field := range reservedFields {
+			if _, ok := preset.Options[field]; ok {
+				return nil, fmt.Errorf("preset '%s' cannot set '%s'", preset.Name, field)
+			}
+		}
+		// Catch typos and wrong types when the file is loaded, not when it is used
+		if _, err := preset.Request(); err != nil {
+			return nil, err
+		}
+	}
+
+	return file.Presets, nil
+}
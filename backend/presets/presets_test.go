@@ -0,0 +1,157 @@
+package presets
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePresets(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			data: `{"presets": [{"name": "web-720p", "options": {"codec": "libx264", "height": 720}}, {"name": "archive", "options": {"codec": "libx265", "crf": "20"}}]}`,
+			want: []string{"web-720p", "archive"},
+		},
+		{name: "empty file", data: `{}`},
+		{name: "not JSON", data: `presets:`, wantErr: "invalid character"},
+		{name: "missing name", data: `{"presets": [{"options": {"codec": "libx264"}}]}`, wantErr: "preset without a name"},
+		{
+			name:    "duplicate name",
+			data:    `{"presets": [{"name": "web", "options": {}}, {"name": "web", "options": {"crf": "30"}}]}`,
+			wantErr: "duplicate preset 'web'",
+		},
+		{name: "sets input", data: `{"presets": [{"name": "web", "options": {"input": "a.mp4"}}]}`, wantErr: "preset 'web' cannot set 'input'"},
+		{name: "sets output", data: `{"presets": [{"name": "web", "options": {"output": "b.mp4"}}]}`, wantErr: "preset 'web' cannot set 'output'"},
+		{name: "sets preset_name", data: `{"presets": [{"name": "web", "options": {"preset_name": "web"}}]}`, wantErr: "preset 'web' cannot set 'preset_name'"},
+		{name: "sets dry_run", data: `{"presets": [{"name": "web", "options": {"dry_run": true}}]}`, wantErr: "preset 'web' cannot set 'dry_run'"},
+		{name: "unknown field", data: `{"presets": [{"name": "web", "options": {"resolutoin": "1280x720"}}]}`, wantErr: `preset 'web': json: unknown field "resolutoin"`},
+		{name: "wrong type", data: `{"presets": [{"name": "web", "options": {"height": "720"}}]}`, wantErr: "preset 'web': json: cannot unmarshal string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			presets, err := parsePresets([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parsePresets() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePresets() error = %v", err)
+			}
+			var names []string
+			for _, preset := range presets {
+				names = append(names, preset.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("presets = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	preset := Preset{Name: "web", Options: map[string]json.RawMessage{
+		"codec":  json.RawMessage(`"libx264"`),
+		"crf":    json.RawMessage(`"23"`),
+		"height": json.RawMessage(`720`),
+	}}
+
+	data, err := preset.Merge(map[string]json.RawMessage{
+		"input":  json.RawMessage(`"in.mov"`),
+		"crf":    json.RawMessage(`"18"`),
+		"height": json.RawMessage(`null`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"codec":"libx264","crf":"18","height":null,"input":"in.mov"}`
+	if string(data) != want {
+		t.Errorf("Merge() = %s, want %s", data, want)
+	}
+	if string(preset.Options["crf"]) != `"23"` {
+		t.Errorf("Merge() changed the preset's options: %s", preset.Options["crf"])
+	}
+}
+
+func TestDecode(t *testing.T) {
+	preset := Preset{Name: "web", Options: map[string]json.RawMessage{
+		"codec":  json.RawMessage(`"libx264"`),
+		"height": json.RawMessage(`720`),
+	}}
+
+	var narrow struct {
+		Codec string `json:"codec"`
+	}
+	if err := preset.Decode(&narrow); err == nil || !strings.Contains(err.Error(), `preset 'web': json: unknown field "height"`) {
+		t.Errorf("Decode() into a type without height error = %v", err)
+	}
+
+	req, err := preset.Request()
+	if err != nil || req.Codec != "libx264" || req.Height != 720 {
+		t.Errorf("Request() = %+v, %v", req, err)
+	}
+}
+
+func TestWatchKeepsPresetsOnBadReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "presets.json")
+	write := func(data string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write(`{"presets": [{"name": "web", "options": {"crf": "23"}}]}`, start)
+	store := NewStore(path)
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go store.Watch(time.Millisecond, stop)
+
+	// A broken file is skipped and the presets loaded before stay active
+	write(`{"presets": [{"name": "web", "options": {"crf": 23}}]}`, start.Add(time.Minute))
+	waitFor("the broken file to be seen", func() bool {
+		store.mu.RLock()
+		defer store.mu.RUnlock()
+		return store.modTime.Equal(start.Add(time.Minute))
+	})
+	if preset, ok := store.Get("web"); !ok || string(preset.Options["crf"]) != `"23"` {
+		t.Fatalf("presets after a bad reload = %+v", store.List())
+	}
+
+	// Fixing the file loads it
+	write(`{"presets": [{"name": "web", "options": {"crf": "30"}}, {"name": "small", "options": {}}]}`, start.Add(2*time.Minute))
+	waitFor("the fixed file to load", func() bool { return len(store.List()) == 2 })
+	if preset, _ := store.Get("web"); string(preset.Options["crf"]) != `"30"` {
+		t.Fatalf("web preset after reload = %+v", preset)
+	}
+}
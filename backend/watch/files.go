@@ -0,0 +1,70 @@
+package watch
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// moveFile moves a file into dir, adding _1, _2, ... to its name if dir
+// already has a file of that name, and returns the new path. Files are
+// copied when dir is on another filesystem.
+func moveFile(path, dir string) (string, error) {
+	target, err := uniquePath(dir, filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(path, target); err == nil {
+		return target, nil
+	}
+
+	// Rename fails across filesystems, so copy and remove the original
+	if err := copyFile(path, target); err != nil {
+		os.Remove(target)
+		return "", err
+	}
+	if err := os.Remove(path); err != nil {
+		return target, err
+	}
+	return target, nil
+}
+
+// uniquePath returns a path in dir for name that no file uses yet
+func uniquePath(dir, name string) (string, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	for i := 0; i < 1000; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = fmt.Sprintf("%s_%d%s", stem, i, ext)
+		}
+		path := filepath.Join(dir, candidate)
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no free name for %s in %s", name, dir)
+}
+
+// copyFile copies the contents of a file to a new file
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
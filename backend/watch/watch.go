@@ -0,0 +1,572 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/Promptzy/terminal-devtool/backend/jobs"
+	"github.com/Promptzy/terminal-devtool/backend/presets"
+)
+
+// Defaults for watch folders
+const (
+	DefaultInterval    = 2 * time.Second
+	DefaultStableAfter = 5 * time.Second
+	MaxActions         = 100 // Actions kept per folder for the status endpoint
+
+	workDir     = ".processing"          // Hidden folder in each hot folder for outputs being written
+	settleDelay = 250 * time.Millisecond // Wait after a change notification so a burst of events causes one scan
+)
+
+// Actions recorded for files in a watch folder
+const (
+	ActionDetected = "detected" // A new file appeared
+	ActionQueued   = "queued"   // The file stopped growing and its job was queued
+	ActionOutput   = "output"   // The job succeeded and its output was moved to the destination
+	ActionDone     = "done"     // The original was moved to the done folder
+	ActionFailed   = "failed"   // The job failed and the original was moved to the failed folder
+	ActionError    = "error"    // A file could not be moved
+)
+
+// Folder configures one hot folder
+type Folder struct {
+	Name        string   `json:"name"`
+	Path        string   `json:"path"`                 // Hot folder to watch
+	Preset      string   `json:"preset"`               // Preset run on each new file
+	Destination string   `json:"destination"`          // Folder that receives the outputs
+	Done        string   `json:"done,omitempty"`       // Folder for originals that were processed (default <path>/done)
+	Failed      string   `json:"failed,omitempty"`     // Folder for originals that failed (default <path>/failed)
+	Extensions  []string `json:"extensions,omitempty"` // File extensions to pick up, e.g. [".mov"]; all if empty
+	StableFor   float64  `json:"stable_seconds,omitempty"`
+	Priority    string   `json:"priority,omitempty"` // Job priority (default low)
+}
+
+// Config is the layout of the watch folders file
+type Config struct {
+	Interval float64  `json:"interval,omitempty"` // Seconds between scans (default 2)
+	Folders  []Folder `json:"folders"`
+}
+
+// LoadConfig reads a watch folders file. Relative paths are resolved against
+// baseDir and missing folders are created.
+func LoadConfig(path, baseDir string) (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read watch file: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("invalid watch file %s: %w", path, err)
+	}
+
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(baseDir, p)
+	}
+
+	names := make(map[string]bool)
+	for i := range config.Folders {
+		folder := &config.Folders[i]
+		if folder.Path == "" || folder.Preset == "" || folder.Destination == "" {
+			return config, fmt.Errorf("invalid watch file %s: folder %d needs a path, preset and destination", path, i+1)
+		}
+		if folder.Name == "" {
+			folder.Name = filepath.Base(folder.Path)
+		}
+		if names[folder.Name] {
+			return config, fmt.Errorf("invalid watch file %s: duplicate folder name '%s'", path, folder.Name)
+		}
+		names[folder.Name] = true
+		if folder.Priority == "" {
+			folder.Priority = jobs.PriorityLow
+		}
+		if !jobs.ValidPriority(folder.Priority) {
+			return config, fmt.Errorf("invalid watch file %s: folder '%s' has unknown priority '%s'", path, folder.Name, folder.Priority)
+		}
+
+		folder.Path = resolve(folder.Path)
+		folder.Destination = resolve(folder.Destination)
+		folder.Done = resolve(folder.Done)
+		folder.Failed = resolve(folder.Failed)
+		if folder.Done == "" {
+			folder.Done = filepath.Join(folder.Path, "done")
+		}
+		if folder.Failed == "" {
+			folder.Failed = filepath.Join(folder.Path, "failed")
+		}
+		for j, ext := range folder.Extensions {
+			folder.Extensions[j] = strings.ToLower("." + strings.TrimPrefix(ext, "."))
+		}
+
+		for _, dir := range []string{folder.Path, folder.Destination, folder.Done, folder.Failed} {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return config, fmt.Errorf("watch folder '%s': %w", folder.Name, err)
+			}
+		}
+	}
+	return config, nil
+}
+
+// Action is an entry in a watch folder's log
+type Action struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	File   string    `json:"file"`
+	Detail string    `json:"detail,omitempty"` // Where the file went, or the error
+	JobID  string    `json:"job_id,omitempty"`
+}
+
+// FolderStatus is the state of a watch folder
+type FolderStatus struct {
+	Folder
+	Waiting    []string     `json:"waiting"`    // Files that are still being written
+	Processing []ActiveFile `json:"processing"` // Files whose jobs have not finished
+	Stuck      []string     `json:"stuck"`      // Originals that could not be moved out; skipped until they change
+	Actions    []Action     `json:"actions"`    // Recent actions, newest last
+}
+
+// ActiveFile is a file whose job is queued or running
+type ActiveFile struct {
+	Input string `json:"input"`
+	JobID string `json:"job_id"`
+}
+
+// SubmitFunc queues a process request as a job for a client
+type SubmitFunc func(request json.RawMessage, priority, client string) (jobs.Job, error)
+
+// fileState is the last size and modification time seen for a file
+type fileState struct {
+	size    int64
+	modTime time.Time
+	since   time.Time // When the size and modification time last changed
+}
+
+// activeFile is a file being processed
+type activeFile struct {
+	input  string
+	output string // Output in the work folder
+	jobID  string
+}
+
+// finishedFile is an active file whose job has finished or was lost
+type finishedFile struct {
+	file *activeFile
+	job  jobs.Job
+	ok   bool // Whether the job was found
+}
+
+// folderState tracks the files of one hot folder
+type folderState struct {
+	Folder
+	seen    map[string]fileState
+	active  map[string]*activeFile
+	stuck   map[string]fileState // Originals left in the hot folder because moving them failed
+	actions []Action
+}
+
+// Watcher watches hot folders and runs a preset on every file once it has
+// stopped changing
+type Watcher struct {
+	Presets  *presets.Store
+	Queue    *jobs.Queue
+	Submit   SubmitFunc
+	Interval time.Duration
+
+	mu      sync.Mutex
+	folders []*folderState
+}
+
+// NewWatcher creates a watcher for the configured folders
+func NewWatcher(config Config, store *presets.Store, queue *jobs.Queue, submit SubmitFunc) *Watcher {
+	w := &Watcher{Presets: store, Queue: queue, Submit: submit, Interval: DefaultInterval}
+	if config.Interval > 0 {
+		w.Interval = time.Duration(config.Interval * float64(time.Second))
+	}
+	for _, folder := range config.Folders {
+		w.folders = append(w.folders, &folderState{
+			Folder: folder,
+			seen:   make(map[string]fileState),
+			active: make(map[string]*activeFile),
+			stuck:  make(map[string]fileState),
+		})
+	}
+	return w
+}
+
+// Run scans the folders every interval until stop is closed. Folders that
+// support change notifications are also scanned shortly after each change.
+func (w *Watcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if notify := w.notifications(); notify != nil {
+		defer notify.Close()
+		events, errs = notify.Events, notify.Errors
+	}
+
+	changed := make(map[*folderState]bool)
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, folder := range w.folders {
+				w.poll(folder)
+			}
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			folder := w.folderOf(event.Name)
+			if folder == nil {
+				continue
+			}
+			changed[folder] = true
+			if settle == nil {
+				settle = time.After(settleDelay)
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			log.Printf("Watch notifications: %v", err)
+		case <-settle:
+			settle = nil
+			for folder := range changed {
+				w.poll(folder)
+				delete(changed, folder)
+			}
+		}
+	}
+}
+
+// notifications starts change notifications for the folders. Folders that
+// cannot be watched, such as some network mounts, are only polled.
+func (w *Watcher) notifications() *fsnotify.Watcher {
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Watch: change notifications unavailable, polling every %s: %v", w.Interval, err)
+		return nil
+	}
+	for _, folder := range w.folders {
+		if err := notify.Add(folder.Path); err != nil {
+			log.Printf("Watch %s: change notifications unavailable, polling every %s: %v", folder.Name, w.Interval, err)
+		}
+	}
+	return notify
+}
+
+// folderOf returns the folder a changed file belongs to, or nil for hidden
+// files and files outside the hot folders
+func (w *Watcher) folderOf(path string) *folderState {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	for _, folder := range w.folders {
+		if filepath.Clean(folder.Path) == dir {
+			return folder
+		}
+	}
+	return nil
+}
+
+// poll queues the folder's new files and moves the files of finished jobs.
+// Files are moved without holding w.mu, since copying them to another
+// filesystem can take a while.
+func (w *Watcher) poll(folder *folderState) {
+	w.mu.Lock()
+	ready := w.scan(folder)
+	finished := w.collect(folder)
+	w.mu.Unlock()
+
+	for _, input := range ready {
+		w.start(folder, input)
+	}
+	for _, f := range finished {
+		switch {
+		case !f.ok:
+			w.fail(folder, f.file, "job was lost")
+		case f.job.Status == jobs.StatusFailed:
+			w.fail(folder, f.file, f.job.Error)
+		default:
+			w.succeed(folder, f.file)
+		}
+	}
+}
+
+// Status returns the state of every folder
+func (w *Watcher) Status() []FolderStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	statuses := make([]FolderStatus, 0, len(w.folders))
+	for _, folder := range w.folders {
+		status := FolderStatus{
+			Folder:     folder.Folder,
+			Waiting:    []string{},
+			Processing: []ActiveFile{},
+			Stuck:      []string{},
+			Actions:    append([]Action{}, folder.actions...),
+		}
+		for path := range folder.stuck {
+			status.Stuck = append(status.Stuck, filepath.Base(path))
+		}
+		for path := range folder.seen {
+			status.Waiting = append(status.Waiting, filepath.Base(path))
+		}
+		for _, file := range folder.active {
+			status.Processing = append(status.Processing, ActiveFile{Input: filepath.Base(file.input), JobID: file.jobID})
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// scan looks for new files and returns those whose size and modification
+// time have not changed for the folder's stable time. Callers hold w.mu.
+func (w *Watcher) scan(folder *folderState) []string {
+	entries, err := os.ReadDir(folder.Path)
+	if err != nil {
+		log.Printf("Watch %s: %v", folder.Name, err)
+		return nil
+	}
+
+	stableFor := DefaultStableAfter
+	if folder.StableFor > 0 {
+		stableFor = time.Duration(folder.StableFor * float64(time.Second))
+	}
+
+	now := time.Now()
+	present := make(map[string]bool)
+	var ready []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !folder.accepts(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		path := filepath.Join(folder.Path, entry.Name())
+		present[path] = true
+		if _, busy := folder.active[path]; busy {
+			continue
+		}
+		if state, ok := folder.stuck[path]; ok {
+			if state.size == info.Size() && state.modTime.Equal(info.ModTime()) {
+				continue
+			}
+			// A new file replaced the one that could not be moved
+			delete(folder.stuck, path)
+		}
+
+		state, ok := folder.seen[path]
+		if !ok {
+			folder.record(ActionDetected, path, "", "")
+		}
+		if !ok || state.size != info.Size() || !state.modTime.Equal(info.ModTime()) {
+			folder.seen[path] = fileState{size: info.Size(), modTime: info.ModTime(), since: now}
+			continue
+		}
+		if now.Sub(state.since) < stableFor {
+			continue
+		}
+
+		delete(folder.seen, path)
+		ready = append(ready, path)
+	}
+
+	// Forget files that were removed before they were picked up, or after
+	// they got stuck
+	for path := range folder.seen {
+		if !present[path] {
+			delete(folder.seen, path)
+		}
+	}
+	for path := range folder.stuck {
+		if !present[path] {
+			delete(folder.stuck, path)
+		}
+	}
+	return ready
+}
+
+// start queues the folder's preset for a file. Files that cannot be queued
+// go to the failed folder.
+func (w *Watcher) start(folder *folderState, input string) {
+	file := &activeFile{input: input}
+	if err := w.submit(folder, file); err != nil {
+		w.fail(folder, file, err.Error())
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	folder.active[input] = file
+	folder.record(ActionQueued, input, folder.Preset, file.jobID)
+}
+
+// submit queues the job for a file and records its output and job ID
+func (w *Watcher) submit(folder *folderState, file *activeFile) error {
+	output, err := w.outputPath(folder, file.input)
+	if err != nil {
+		return err
+	}
+	file.output = output
+
+	request, err := json.Marshal(map[string]string{
+		"preset_name": folder.Preset,
+		"input":       file.input,
+		"output":      output,
+	})
+	if err != nil {
+		return err
+	}
+
+	job, err := w.Submit(request, folder.Priority, "watch:"+folder.Name)
+	if err != nil {
+		return err
+	}
+	file.jobID = job.ID
+	return nil
+}
+
+// outputPath returns where the job for input writes: a folder of its own in
+// the work folder, named after the input with the preset's extension
+func (w *Watcher) outputPath(folder *folderState, input string) (string, error) {
+	if w.Presets == nil {
+		return "", fmt.Errorf("no presets are configured")
+	}
+	preset, ok := w.Presets.Get(folder.Preset)
+	if !ok {
+		return "", fmt.Errorf("unknown preset '%s'", folder.Preset)
+	}
+	req, err := preset.Request()
+	if err != nil {
+		return "", err
+	}
+	req.Input = input
+
+	name := filepath.Base(input)
+	name = strings.TrimSuffix(name, filepath.Ext(name)) + filepath.Ext(req.OutputPath())
+	return filepath.Join(folder.Path, workDir, filepath.Base(input), name), nil
+}
+
+// collect takes the files whose jobs have finished or were lost out of the
+// active files and returns them. Callers hold w.mu.
+func (w *Watcher) collect(folder *folderState) []finishedFile {
+	var finished []finishedFile
+	for input, file := range folder.active {
+		job, ok := w.Queue.Get(file.jobID)
+		if ok && !job.Done() {
+			continue
+		}
+		delete(folder.active, input)
+		finished = append(finished, finishedFile{file: file, job: job, ok: ok})
+	}
+	return finished
+}
+
+// succeed moves a finished output to the destination and the original to
+// the done folder
+func (w *Watcher) succeed(folder *folderState, file *activeFile) {
+	target, err := moveFile(file.output, folder.Destination)
+	if err != nil {
+		w.fail(folder, file, "moving the output failed: "+err.Error())
+		return
+	}
+	os.RemoveAll(filepath.Dir(file.output))
+	w.record(folder, ActionOutput, file.input, target, file.jobID)
+
+	target, err = moveFile(file.input, folder.Done)
+	if err != nil {
+		w.stuck(folder, file, err)
+		return
+	}
+	w.record(folder, ActionDone, file.input, target, file.jobID)
+}
+
+// fail moves the original of a failed file to the failed folder with a
+// <name>.error.txt note next to it
+func (w *Watcher) fail(folder *folderState, file *activeFile, reason string) {
+	if file.output != "" {
+		os.RemoveAll(filepath.Dir(file.output))
+	}
+
+	target, err := moveFile(file.input, folder.Failed)
+	if err != nil {
+		w.stuck(folder, file, err)
+		return
+	}
+	if err := os.WriteFile(target+".error.txt", []byte(reason+"\n"), 0644); err != nil {
+		log.Printf("Watch %s: writing the error note for %s failed: %v", folder.Name, target, err)
+	}
+	w.record(folder, ActionFailed, file.input, reason, file.jobID)
+}
+
+// stuck records that the original of a file could not be moved out of the
+// hot folder, so scans skip it until it is removed or replaced instead of
+// processing it again
+func (w *Watcher) stuck(folder *folderState, file *activeFile, moveErr error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if info, err := os.Stat(file.input); err == nil {
+		folder.stuck[file.input] = fileState{size: info.Size(), modTime: info.ModTime()}
+	}
+	folder.record(ActionError, file.input, "moving the original failed: "+moveErr.Error(), file.jobID)
+}
+
+// record logs an action of a folder while holding w.mu
+func (w *Watcher) record(folder *folderState, action, path, detail, jobID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	folder.record(action, path, detail, jobID)
+}
+
+// accepts reports whether a file name has one of the folder's extensions
+func (f *folderState) accepts(name string) bool {
+	if len(f.Extensions) == 0 {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, allowed := range f.Extensions {
+		if ext == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// record logs an action and keeps it for the status endpoint
+func (f *folderState) record(action, path, detail, jobID string) {
+	name := filepath.Base(path)
+	if detail != "" {
+		log.Printf("Watch %s: %s %s: %s", f.Name, action, name, detail)
+	} else {
+		log.Printf("Watch %s: %s %s", f.Name, action, name)
+	}
+
+	f.actions = append(f.actions, Action{Time: time.Now(), Action: action, File: name, Detail: detail, JobID: jobID})
+	if len(f.actions) > MaxActions {
+		f.actions = f.actions[len(f.actions)-MaxActions:]
+	}
+}
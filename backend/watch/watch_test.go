@@ -0,0 +1,90 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScanSkipsStuckFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clip.mov")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWatcher(Config{Folders: []Folder{{Name: "in", Path: dir, StableFor: 0.001}}}, nil, nil, nil)
+	folder := w.folders[0]
+	folder.stuck[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+
+	// An unchanged stuck file is never picked up again
+	for range 2 {
+		if ready := w.scan(folder); len(ready) != 0 {
+			t.Fatalf("scan() = %v, want no files", ready)
+		}
+	}
+	if len(folder.seen) != 0 {
+		t.Fatalf("stuck file is waiting: %v", folder.seen)
+	}
+
+	// A file that replaces it is processed like a new one
+	if err := os.WriteFile(path, []byte("replacement"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.scan(folder)
+	if _, ok := folder.stuck[path]; ok {
+		t.Fatalf("replaced file is still stuck")
+	}
+	if _, ok := folder.seen[path]; !ok {
+		t.Fatalf("replaced file is not waiting")
+	}
+
+	// Removing it forgets it
+	folder.stuck[path] = fileState{}
+	os.Remove(path)
+	w.scan(folder)
+	if len(folder.stuck) != 0 {
+		t.Fatalf("removed file is still stuck")
+	}
+}
+
+func TestRunScansOnChange(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWatcher(Config{Interval: 3600, Folders: []Folder{{Name: "in", Path: dir}}}, nil, nil, nil)
+	folder := w.folders[0]
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		w.Run(stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	// Give Run time to start watching before the file appears
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(dir, "clip.mov"), []byte("media"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is seen long before the hour-long interval
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		w.mu.Lock()
+		seen := len(folder.seen)
+		w.mu.Unlock()
+		if seen == 1 {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("new file was not detected without polling")
+}
@@ -0,0 +1,386 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Promptzy/terminal-devtool/backend/jobs"
+)
+
+// Delivery settings
+const (
+	MaxAttempts     = 5
+	InitialBackoff  = time.Second // Doubles after each failed attempt
+	DeliveryTimeout = 10 * time.Second
+	MaxJobLogs      = 1000 // Jobs whose delivery logs are kept; the oldest are dropped first
+	MaxPending      = 1000 // Deliveries waiting for one URL; progress events are dropped first
+)
+
+// errDropped is the error of a delivery dropped from a full URL queue
+var errDropped = errors.New("dropped: too many deliveries waiting for this URL")
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Headers sent with each delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Events lists the job events a subscription can receive
+var Events = []string{jobs.EventStarted, jobs.EventProgress, jobs.EventSucceeded, jobs.EventFailed}
+
+// ErrUnknownSubscription is returned when a subscription does not exist
+var ErrUnknownSubscription = errors.New("unknown subscription")
+
+// Subscription receives the events of every job
+type Subscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // Signs deliveries; only shown when the subscription is created
+	Events    []string  `json:"events"`           // Events to deliver; all if empty
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	ID        string    `json:"id"` // Same as the X-Webhook-Delivery header
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Job       jobs.Job  `json:"job"` // The job when the event happened
+}
+
+// Delivery records the delivery of one event to one URL
+type Delivery struct {
+	ID           string     `json:"id"`
+	Event        string     `json:"event"`
+	URL          string     `json:"url"`
+	Subscription string     `json:"subscription,omitempty"` // Subscription ID; empty for the job's callback_url
+	Status       string     `json:"status"`
+	Attempts     int        `json:"attempts"`
+	StatusCode   int        `json:"status_code,omitempty"` // Response status of the last attempt
+	Error        string     `json:"error,omitempty"`       // Error of the last attempt
+	CreatedAt    time.Time  `json:"created_at"`
+	DeliveredAt  *time.Time `json:"delivered_at,omitempty"`
+
+	payload []byte
+	secret  string
+}
+
+// urlQueue holds the deliveries waiting for one URL. They are sent one at a
+// time in event order, so a receiver never sees succeeded before started,
+// while a slow receiver only holds up its own deliveries.
+type urlQueue struct {
+	pending []*Delivery
+}
+
+// add queues a delivery. When limit deliveries are already waiting, the
+// oldest progress event, or the oldest event if none is a progress event,
+// is removed and returned.
+func (q *urlQueue) add(d *Delivery, limit int) *Delivery {
+	var dropped *Delivery
+	if len(q.pending) >= limit {
+		i := slices.IndexFunc(q.pending, func(p *Delivery) bool { return p.Event == jobs.EventProgress })
+		if i < 0 {
+			i = 0
+		}
+		dropped = q.pending[i]
+		q.pending = slices.Delete(q.pending, i, i+1)
+	}
+	q.pending = append(q.pending, d)
+	return dropped
+}
+
+// Notifier delivers job events to callback URLs and subscriptions
+type Notifier struct {
+	Secret string // Signs deliveries to callback URLs; unsigned if empty
+
+	client        *http.Client
+	backoff       time.Duration
+	maxPending    int
+	mu            sync.Mutex
+	subscriptions map[string]*Subscription
+	order         []string
+	logs          map[string][]*Delivery // Deliveries of each job, oldest first
+	logOrder      []string               // Jobs with a log, oldest first
+	queues        map[string]*urlQueue   // URLs with deliveries being sent
+}
+
+// NewNotifier creates a notifier that signs callback deliveries with secret
+func NewNotifier(secret string) *Notifier {
+	return &Notifier{
+		Secret:        secret,
+		client:        &http.Client{Timeout: DeliveryTimeout},
+		backoff:       InitialBackoff,
+		maxPending:    MaxPending,
+		subscriptions: make(map[string]*Subscription),
+		logs:          make(map[string][]*Delivery),
+		queues:        make(map[string]*urlQueue),
+	}
+}
+
+// Subscribe adds a subscription and returns it with its ID set. A secret is
+// generated if none is given.
+func (n *Notifier) Subscribe(sub Subscription) (Subscription, error) {
+	if err := ValidateURL(sub.URL); err != nil {
+		return sub, err
+	}
+	for _, event := range sub.Events {
+		if !knownEvent(event) {
+			return sub, fmt.Errorf("unknown event '%s'", event)
+		}
+	}
+	if sub.Secret == "" {
+		sub.Secret = newID(16)
+	}
+	if sub.Events == nil {
+		sub.Events = []string{}
+	}
+	sub.ID = newID(8)
+	sub.CreatedAt = time.Now()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.subscriptions[sub.ID] = &sub
+	n.order = append(n.order, sub.ID)
+	return sub, nil
+}
+
+// Unsubscribe removes a subscription. Deliveries already queued are still sent.
+func (n *Notifier) Unsubscribe(id string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.subscriptions[id]; !ok {
+		return fmt.Errorf("%w '%s'", ErrUnknownSubscription, id)
+	}
+	delete(n.subscriptions, id)
+	for i, subID := range n.order {
+		if subID == id {
+			n.order = append(n.order[:i], n.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Subscriptions returns the subscriptions in creation order, without secrets
+func (n *Notifier) Subscriptions() []Subscription {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	subs := make([]Subscription, 0, len(n.order))
+	for _, id := range n.order {
+		sub := *n.subscriptions[id]
+		sub.Secret = ""
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// Deliveries returns the delivery log of a job, oldest first
+func (n *Notifier) Deliveries(jobID string) []Delivery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	deliveries := []Delivery{}
+	for _, d := range n.logs[jobID] {
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries
+}
+
+// JobEvent queues an event for the job's callback URL and every subscription
+// that wants it. It does not block, so it can be used as jobs.Queue.OnEvent.
+func (n *Notifier) JobEvent(event string, job jobs.Job) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var deliveries []*Delivery
+	if job.CallbackURL != "" {
+		deliveries = append(deliveries, n.newDelivery(event, job, job.CallbackURL, "", n.Secret))
+	}
+	for _, id := range n.order {
+		sub := n.subscriptions[id]
+		if len(sub.Events) == 0 || slices.Contains(sub.Events, event) {
+			deliveries = append(deliveries, n.newDelivery(event, job, sub.URL, sub.ID, sub.Secret))
+		}
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if _, ok := n.logs[job.ID]; !ok {
+		n.logOrder = append(n.logOrder, job.ID)
+		if len(n.logOrder) > MaxJobLogs {
+			// Queued deliveries of a dropped log are still sent
+			delete(n.logs, n.logOrder[0])
+			n.logOrder = n.logOrder[1:]
+		}
+	}
+	n.logs[job.ID] = append(n.logs[job.ID], deliveries...)
+
+	for _, d := range deliveries {
+		queue, sending := n.queues[d.URL]
+		if !sending {
+			queue = &urlQueue{}
+			n.queues[d.URL] = queue
+			go n.send(d.URL)
+		}
+		if dropped := queue.add(d, n.maxPending); dropped != nil {
+			dropped.Status = StatusFailed
+			dropped.Error = errDropped.Error()
+			log.Printf("Webhook %s to %s %v", dropped.Event, dropped.URL, errDropped)
+		}
+	}
+}
+
+// newDelivery builds a pending delivery of an event. Callers hold n.mu.
+func (n *Notifier) newDelivery(event string, job jobs.Job, target, subscription, secret string) *Delivery {
+	d := &Delivery{
+		ID:           newID(8),
+		Event:        event,
+		URL:          target,
+		Subscription: subscription,
+		Status:       StatusPending,
+		CreatedAt:    time.Now(),
+		secret:       secret,
+	}
+	d.payload, _ = json.Marshal(Payload{ID: d.ID, Event: event, CreatedAt: d.CreatedAt, Job: job})
+	return d
+}
+
+// send delivers the pending deliveries of a URL in order until none are left
+func (n *Notifier) send(target string) {
+	for {
+		n.mu.Lock()
+		queue := n.queues[target]
+		if len(queue.pending) == 0 {
+			delete(n.queues, target)
+			n.mu.Unlock()
+			return
+		}
+		d := queue.pending[0]
+		queue.pending = queue.pending[1:]
+		n.mu.Unlock()
+
+		n.deliver(d)
+	}
+}
+
+// deliver posts a delivery, retrying with backoff until it succeeds, the
+// receiver rejects it or the attempts run out
+func (n *Notifier) deliver(d *Delivery) {
+	backoff := n.backoff
+	for attempt := 1; ; attempt++ {
+		status, err := n.post(d)
+
+		n.mu.Lock()
+		d.Attempts = attempt
+		d.StatusCode = status
+		d.Error = ""
+		if err != nil {
+			d.Error = err.Error()
+		}
+		done := err == nil || !retryable(status) || attempt == MaxAttempts
+		if err == nil {
+			now := time.Now()
+			d.Status = StatusDelivered
+			d.DeliveredAt = &now
+		} else if done {
+			d.Status = StatusFailed
+		}
+		n.mu.Unlock()
+
+		if done {
+			if err != nil {
+				log.Printf("Webhook %s to %s failed after %d attempts: %v", d.Event, d.URL, attempt, err)
+			}
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends a delivery once and returns the response status
+func (n *Notifier) post(d *Delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "terminal-devtool-webhooks")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, d.ID)
+	if d.secret != "" {
+		req.Header.Set(HeaderSignature, Sign(d.secret, d.payload))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value of a payload: sha256= followed by
+// the hex HMAC-SHA256 of the body
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateURL checks that a webhook URL is an absolute http or https URL
+func ValidateURL(target string) error {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL '%s': must be an http or https URL", target)
+	}
+	return nil
+}
+
+// retryable reports whether a failed attempt is worth repeating: the
+// receiver was unreachable, failed, timed out or asked to slow down
+func retryable(status int) bool {
+	return status == 0 || status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+// knownEvent reports whether event is a job event
+func knownEvent(event string) bool {
+	return slices.Contains(Events, event)
+}
+
+// newID returns a random hex ID of n bytes
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,277 @@
+package webhooks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Promptzy/terminal-devtool/backend/jobs"
+)
+
+// receiver records the events posted to it and answers with the next of its
+// statuses, then 200 once they run out
+type receiver struct {
+	mu         sync.Mutex
+	statuses   []int
+	events     []string
+	signatures []string
+	bodies     [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.events = append(rc.events, r.Header.Get(HeaderEvent))
+	rc.signatures = append(rc.signatures, r.Header.Get(HeaderSignature))
+	rc.bodies = append(rc.bodies, body)
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// received returns the events posted so far
+func (rc *receiver) received() []string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return slices.Clone(rc.events)
+}
+
+// newTestNotifier returns a notifier that retries without waiting
+func newTestNotifier(secret string) *Notifier {
+	n := NewNotifier(secret)
+	n.backoff = time.Millisecond
+	return n
+}
+
+// waitDeliveries waits until every delivery of a job is finished
+func waitDeliveries(t *testing.T, n *Notifier, jobID string, count int) []Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries := n.Deliveries(jobID)
+		done := len(deliveries) == count
+		for _, d := range deliveries {
+			done = done && d.Status != StatusPending
+		}
+		if done {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries of %s not finished: %+v", jobID, deliveries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSign(t *testing.T) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	n := newTestNotifier("secret")
+	n.JobEvent(jobs.EventSucceeded, jobs.Job{ID: "job", CallbackURL: server.URL})
+	waitDeliveries(t, n, "job", 1)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	got := rc.signatures[0]
+	if want := Sign("secret", rc.bodies[0]); got != want {
+		t.Fatalf("signature = %s, want %s", got, want)
+	}
+	if got, want := Sign("secret", []byte("message")), "sha256=8b5f48702995c1598c573db1e21866a9b825d4a794d169d7060a03605796360b"; got != want {
+		t.Fatalf("Sign() = %s, want %s", got, want)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		status   string
+		attempts int
+	}{
+		{name: "delivered first time", status: StatusDelivered, attempts: 1},
+		{name: "server error is retried", statuses: []int{500, 503}, status: StatusDelivered, attempts: 3},
+		{name: "rate limit is retried", statuses: []int{429}, status: StatusDelivered, attempts: 2},
+		{name: "client error is not retried", statuses: []int{400}, status: StatusFailed, attempts: 1},
+		{name: "attempts run out", statuses: []int{500, 500, 500, 500, 500}, status: StatusFailed, attempts: MaxAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &receiver{statuses: tt.statuses}
+			server := httptest.NewServer(rc)
+			defer server.Close()
+
+			n := newTestNotifier("")
+			n.JobEvent(jobs.EventSucceeded, jobs.Job{ID: "job", CallbackURL: server.URL})
+			d := waitDeliveries(t, n, "job", 1)[0]
+
+			if d.Status != tt.status || d.Attempts != tt.attempts {
+				t.Fatalf("delivery = %s after %d attempts, want %s after %d", d.Status, d.Attempts, tt.status, tt.attempts)
+			}
+			if got := len(rc.received()); got != tt.attempts {
+				t.Fatalf("receiver got %d requests, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestDeliveryOrder(t *testing.T) {
+	// The first delivery fails once, so later events would overtake it if
+	// they were not queued behind it
+	rc := &receiver{statuses: []int{500}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	n := newTestNotifier("")
+	job := jobs.Job{ID: "job", CallbackURL: server.URL}
+	events := []string{jobs.EventStarted, jobs.EventProgress, jobs.EventSucceeded}
+	for _, event := range events {
+		n.JobEvent(event, job)
+	}
+	waitDeliveries(t, n, "job", len(events))
+
+	want := append([]string{jobs.EventStarted}, events...)
+	if got := rc.received(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+}
+
+func TestSlowReceiver(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	rc := &receiver{}
+	fast := httptest.NewServer(rc)
+	defer fast.Close()
+
+	n := newTestNotifier("")
+	if _, err := n.Subscribe(Subscription{URL: fast.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The slow callback URL must not hold up the subscription
+	n.JobEvent(jobs.EventStarted, jobs.Job{ID: "job", CallbackURL: slow.URL})
+	n.JobEvent(jobs.EventSucceeded, jobs.Job{ID: "job", CallbackURL: slow.URL})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := len(rc.received())
+		if got == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("subscription got %d events while the callback URL was slow, want 2", got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestURLQueueAdd(t *testing.T) {
+	delivery := func(id, event string) *Delivery { return &Delivery{ID: id, Event: event} }
+	ids := func(deliveries []*Delivery) []string {
+		var ids []string
+		for _, d := range deliveries {
+			ids = append(ids, d.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name    string
+		pending []*Delivery
+		dropped string
+		want    []string
+	}{
+		{name: "room left", pending: []*Delivery{delivery("a", jobs.EventStarted)}, want: []string{"a", "new"}},
+		{
+			name:    "oldest progress event is dropped",
+			pending: []*Delivery{delivery("a", jobs.EventStarted), delivery("b", jobs.EventProgress), delivery("c", jobs.EventProgress)},
+			dropped: "b",
+			want:    []string{"a", "c", "new"},
+		},
+		{
+			name:    "oldest event without progress events",
+			pending: []*Delivery{delivery("a", jobs.EventStarted), delivery("b", jobs.EventSucceeded), delivery("c", jobs.EventStarted)},
+			dropped: "a",
+			want:    []string{"b", "c", "new"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &urlQueue{pending: tt.pending}
+			dropped := q.add(delivery("new", jobs.EventFailed), 3)
+			if (dropped == nil && tt.dropped != "") || (dropped != nil && dropped.ID != tt.dropped) {
+				t.Errorf("dropped = %+v, want %q", dropped, tt.dropped)
+			}
+			if got := ids(q.pending); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pending = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPendingLimit(t *testing.T) {
+	release := make(chan struct{})
+	rc := &receiver{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		rc.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	n := newTestNotifier("")
+	n.maxPending = 2
+	job := jobs.Job{ID: "job", CallbackURL: server.URL}
+
+	// Hold the first delivery at the receiver while the rest queue up
+	n.JobEvent(jobs.EventStarted, job)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n.mu.Lock()
+		taken := len(n.queues[server.URL].pending) == 0
+		n.mu.Unlock()
+		if taken {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("first delivery was not sent")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	n.JobEvent(jobs.EventProgress, job)
+	n.JobEvent(jobs.EventProgress, job)
+	n.JobEvent(jobs.EventSucceeded, job)
+	close(release)
+
+	deliveries := waitDeliveries(t, n, "job", 4)
+	var statuses []string
+	for _, d := range deliveries {
+		statuses = append(statuses, d.Status)
+	}
+	want := []string{StatusDelivered, StatusFailed, StatusDelivered, StatusDelivered}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("statuses = %v, want %v", statuses, want)
+	}
+	if deliveries[1].Error != errDropped.Error() || deliveries[1].Attempts != 0 {
+		t.Errorf("dropped delivery = %+v", deliveries[1])
+	}
+	if got, want := rc.received(), []string{jobs.EventStarted, jobs.EventProgress, jobs.EventSucceeded}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}